@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 )
 
 // this file is used as a helper file.
@@ -19,19 +20,44 @@ type Error struct {
 // It includes all fields (common + platform-specific) for all supported platforms.
 type TotalFields struct {
 	// --- Common fields ---
-	Platforms   []string `json:"platforms"`   // e.g. ["youtube", "pinterest", "linkedin"]
+	Platforms   []string `json:"platforms"`   // e.g. ["youtube", "pinterest", "linkedin"], "instagram:brand2" posts to a specific account
 	Title       string   `json:"title"`       // shared by YouTube, Pinterest, Reddit
 	Description string   `json:"description"` // shared by YouTube, Pinterest
 	Caption     string   `json:"caption"`     // Instagram, optional for others
-	MediaFile   string   `json:"media_file"`  // base64 or URL from frontend
+	MediaID     string   `json:"media_id"`    // id returned by /upload/file, used for every platform that takes a file
+	MediaFile   string   `json:"media_file"`  // media id, if media_id is not set
+	// photos and videos are published without EXIF/GPS metadata unless this is set
+	KeepMetadata bool `json:"keep_metadata"`
+	// platform -> media id of the image to use as the video's thumbnail/cover (youtube, pinterest), e.g. a frame from /media/{id}/frames
+	Thumbnails map[string]string `json:"thumbnails"`
+	// watermark profile put on the media of every platform, watermarks overrides it per platform ("none" for no watermark)
+	Watermark  string            `json:"watermark"`
+	Watermarks map[string]string `json:"watermarks"`
+	// media id of the artwork audio is published over, for platforms that only take video (podcasts on youtube)
+	CoverImage string `json:"cover_image"`
+	Waveform   bool   `json:"waveform"` // draw the audio's waveform over the cover
+	// text field -> name of a saved caption template to fill it from, e.g. {"caption": "episode"}, rendered per platform
+	Templates map[string]string      `json:"templates"`
+	Variables map[string]interface{} `json:"variables"` // values the templates use, e.g. {"Number": 12, "Title": "..."}
+	// "markdown" turns the body text (description, caption, text) into each platform's own formatting, default "plain"
+	Format string `json:"format"`
+	// what to do with text over a platform's length limit: "reject" the post (default) or "truncate" it
+	TextOverflow string `json:"text_overflow"`
 
 	// --- YouTube-specific ---
 	PrivacyStatus string   `json:"privacy_status"` // "public", "private", or "unlisted"
 	CategoryID    string   `json:"category_id"`    // YouTube
-	Tags          []string `json:"tags"`           // YouTube
+	Tags          []string `json:"tags"`           // every platform, see captions/hashtags.go
+
+	// names of saved hashtag sets whose tags are added to tags
+	HashtagSets []string `json:"hashtag_sets"`
+	// utm_campaign of the links in the post, when UTM tagging is on (see links/utm.go)
+	UTMCampaign string `json:"utm_campaign"`
+	// post links as they are instead of as short links, when ShortLinkURL is set (see links/shortener.go)
+	KeepLinks bool `json:"keep_links"`
 
 	// --- Instagram-specific ---
-	ImageURL   string `json:"image_url"`   // URL if remote; could reuse media_file
+	ImageURL   string `json:"image_url"`   // media id, if media_id is not set
 	LocationID string `json:"location_id"` // optional
 	UserTags   string `json:"user_tags"`   // optional, comma-separated
 
@@ -56,6 +82,17 @@ type TotalFields struct {
 	MediaStatus    string `json:"media_status"`    // "READY"
 	MediaPath      string `json:"media_path"`      // URN or URL
 	Visibility     string `json:"visibility"`      // "PUBLIC"
+
+	// --- Per-target overrides ---
+	// keyed by platform ("reddit") or platform and account ("instagram:brand2"), each value holds any of the fields
+	// above and replaces them for that target only. account overrides are applied after platform ones.
+	Overrides map[string]json.RawMessage `json:"overrides"`
+}
+
+// SplitTarget splits an entry of Platforms into the platform and the account ("" for the default one).
+func SplitTarget(target string) (string, string) {
+	platform, account, _ := strings.Cut(target, ":")
+	return platform, account
 }
 
 func writeError(w http.ResponseWriter, message string, code int) {
@@ -79,6 +116,14 @@ var (
 	HandleRequestError = func(w http.ResponseWriter, err error) {
 		writeError(w, err.Error(), http.StatusBadRequest)
 	}
+	// the requested resource does not exist.
+	HandleNotFoundError = func(w http.ResponseWriter, message string) {
+		writeError(w, message, http.StatusNotFound)
+	}
+	// any other status, for errors that need a specific code (413, 415, 502, ...).
+	HandleStatusError = func(w http.ResponseWriter, message string, code int) {
+		writeError(w, message, code)
+	}
 	// internal error. we log it speerately!
 	HandleInternalError = func(w http.ResponseWriter) {
 		writeError(w, "An Unexpected Error Occured", http.StatusInternalServerError)
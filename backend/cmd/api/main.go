@@ -3,9 +3,16 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/TanishqM1/SocialContentDistributer/internal/captions"
 	"github.com/TanishqM1/SocialContentDistributer/internal/handlers"
+	"github.com/TanishqM1/SocialContentDistributer/internal/jobs"
+	"github.com/TanishqM1/SocialContentDistributer/internal/links"
+	"github.com/TanishqM1/SocialContentDistributer/internal/media"
+	"github.com/TanishqM1/SocialContentDistributer/internal/storage"
 	"github.com/go-chi/chi"
+	"github.com/joho/godotenv"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -14,12 +21,56 @@ import (
 func main() {
 	log.SetReportCaller(true)
 
+	// media lives on local disk or in an s3 bucket, depending on MediaStore in config/.env.
+	godotenv.Load("config/.env")
+	mediaStore, err := storage.FromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	media.SetStore(mediaStore)
+
+	// load the media library index (and pick up files uploaded before it existed).
+	if err := media.LoadLibrary(); err != nil {
+		log.Error(err)
+	}
+
+	// pick up any upload-post requests that were still processing when we last shut down. this comes after the
+	// media library, finished posts give back their media references.
+	if err := jobs.Load(); err != nil {
+		log.Error(err)
+	}
+	jobs.Resume()
+
+	if err := media.LoadWatermarks(); err != nil {
+		log.Error(err)
+	}
+	if err := captions.LoadTemplates(); err != nil {
+		log.Error(err)
+	}
+	if err := captions.LoadHashtagSets(); err != nil {
+		log.Error(err)
+	}
+	if err := links.LoadUTM(); err != nil {
+		log.Error(err)
+	}
+	if err := links.LoadLinks(); err != nil {
+		log.Error(err)
+	}
+	// clear out media nothing references any more and abandoned resumable uploads, once an hour.
+	go func() {
+		for range time.Tick(time.Hour) {
+			if _, err := handlers.CollectGarbage(); err != nil {
+				log.Error(err)
+			}
+		}
+	}()
+
 	var r *chi.Mux = chi.NewRouter()
 	// pass to handler
 	handlers.Handler(r)
 	fmt.Println("Starting My Local Go API Service!")
 
-	err := http.ListenAndServe("localhost:8000", r)
+	err = http.ListenAndServe("localhost:8000", r)
 
 	// if for some reason the server does not start.
 	if err != nil {
@@ -0,0 +1,226 @@
+package captions
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/TanishqM1/SocialContentDistributer/internal/store"
+)
+
+// a post's "tags" (plus the tags of any saved hashtag sets it names in "hashtag_sets") are one list for every
+// platform. tags are normalized (no "#", spaces or punctuation, "Go Lang!" -> "GoLang"), deduplicated ignoring case
+// and then written the way each platform takes them: YouTube as keywords, Instagram, LinkedIn and Pinterest as
+// hashtags at the end of the text (Pinterest indexes them as keywords), up to each platform's count. tags the
+// text already has as a hashtag are not repeated. sets are saved to hashtag_sets.json in the data directory.
+
+// ErrHashtagSetNotFound is returned for a hashtag set name that does not exist.
+var ErrHashtagSetNotFound = errors.New("hashtag set not found")
+
+// InvalidHashtagSetError says why a hashtag set could not be saved.
+type InvalidHashtagSetError struct {
+	Reason string
+}
+
+func (e *InvalidHashtagSetError) Error() string {
+	return "invalid hashtag set: " + e.Reason
+}
+
+// HashtagSet is a named list of tags, e.g. the tags every post of a series gets.
+type HashtagSet struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+// tagStyle is how a platform takes tags.
+type tagStyle struct {
+	Field    string // json name of the text field hashtags are added to, "" for keywords
+	Max      int    // most tags the platform takes (hashtags already in the text count too)
+	MaxChars int    // keywords only, the total length of the keywords
+}
+
+// tagStyles are the platforms that take tags. reddit has no tags.
+var tagStyles = map[string]tagStyle{
+	"youtube":   {MaxChars: 500},
+	"instagram": {Field: "caption", Max: 30},
+	"linkedin":  {Field: "text_linkedin", Max: 5},
+	"pinterest": {Field: "description", Max: 20},
+}
+
+var (
+	hashtagSetsMu sync.Mutex
+	hashtagSets   = map[string]HashtagSet{}
+)
+
+var hashtagPattern = regexp.MustCompile(`#([\p{L}\p{N}_]+)`)
+
+func hashtagSetsPath() string {
+	return store.Path("hashtag_sets.json")
+}
+
+// LoadHashtagSets reads hashtag_sets.json. Call it once on startup.
+func LoadHashtagSets() error {
+	hashtagSetsMu.Lock()
+	defer hashtagSetsMu.Unlock()
+	return store.Load(hashtagSetsPath(), &hashtagSets)
+}
+
+// NormalizeTag returns tag without "#", spaces and punctuation, or "" if nothing usable is left
+// (hashtags made only of digits do not link on most platforms).
+func NormalizeTag(tag string) string {
+	tag = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) || r == '_' {
+			return r
+		}
+		return -1
+	}, tag)
+	if strings.IndexFunc(tag, unicode.IsLetter) < 0 {
+		return ""
+	}
+	return tag
+}
+
+// NormalizeTags normalizes tags and drops duplicates (ignoring case), keeping the first spelling and the order.
+func NormalizeTags(tags []string) []string {
+	list := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		list = append(list, tag)
+	}
+	return list
+}
+
+// SaveHashtagSet creates or replaces a hashtag set, with its tags normalized.
+func SaveHashtagSet(set HashtagSet) (HashtagSet, error) {
+	if set.Name == "" || strings.ContainsAny(set.Name, "/\\") || len(set.Name) > 64 {
+		return HashtagSet{}, &InvalidHashtagSetError{Reason: "name must be 1 to 64 characters without slashes"}
+	}
+	set.Tags = NormalizeTags(set.Tags)
+	if len(set.Tags) == 0 {
+		return HashtagSet{}, &InvalidHashtagSetError{Reason: "tags is empty"}
+	}
+
+	hashtagSetsMu.Lock()
+	defer hashtagSetsMu.Unlock()
+
+	hashtagSets[set.Name] = set
+	return set, store.Save(hashtagSetsPath(), hashtagSets)
+}
+
+// GetHashtagSet returns the hashtag set with the given name.
+func GetHashtagSet(name string) (HashtagSet, error) {
+	hashtagSetsMu.Lock()
+	defer hashtagSetsMu.Unlock()
+
+	set, ok := hashtagSets[name]
+	if !ok {
+		return HashtagSet{}, ErrHashtagSetNotFound
+	}
+	return set, nil
+}
+
+// ListHashtagSets returns every hashtag set, by name.
+func ListHashtagSets() []HashtagSet {
+	hashtagSetsMu.Lock()
+	defer hashtagSetsMu.Unlock()
+
+	list := make([]HashtagSet, 0, len(hashtagSets))
+	for _, set := range hashtagSets {
+		list = append(list, set)
+	}
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].Name < list[b].Name
+	})
+	return list
+}
+
+// DeleteHashtagSet removes a hashtag set.
+func DeleteHashtagSet(name string) error {
+	hashtagSetsMu.Lock()
+	defer hashtagSetsMu.Unlock()
+
+	if _, ok := hashtagSets[name]; !ok {
+		return ErrHashtagSetNotFound
+	}
+	delete(hashtagSets, name)
+	return store.Save(hashtagSetsPath(), hashtagSets)
+}
+
+// ResolveTags returns a post's tags followed by the tags of the named sets, normalized.
+func ResolveTags(tags []string, sets []string) ([]string, error) {
+	all := append([]string(nil), tags...)
+	for _, name := range sets {
+		set, err := GetHashtagSet(name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", err, name)
+		}
+		all = append(all, set.Tags...)
+	}
+	return NormalizeTags(all), nil
+}
+
+// Hashtags writes tags as hashtags for platform. reddit has no hashtags, so the words are just listed there.
+func Hashtags(platform string, tags []string) string {
+	list := NormalizeTags(tags)
+	if platform != "reddit" {
+		for i, tag := range list {
+			list[i] = "#" + tag
+		}
+	}
+	return strings.Join(list, " ")
+}
+
+// RenderTags puts normalized tags where platform takes them. fields maps json names to the post's text fields;
+// hashtags are added to the platform's field, and the keywords (for platforms that take them) are returned.
+func RenderTags(platform string, tags []string, fields map[string]*string) []string {
+	style, ok := tagStyles[platform]
+	if !ok || len(tags) == 0 {
+		return nil
+	}
+
+	if style.Field == "" {
+		keywords := []string{}
+		chars := 0
+		for _, tag := range tags {
+			// keywords are sent comma separated.
+			if chars+len([]rune(tag))+len(keywords) > style.MaxChars {
+				break
+			}
+			chars += len([]rune(tag))
+			keywords = append(keywords, tag)
+		}
+		return keywords
+	}
+
+	text := fields[style.Field]
+	have := map[string]bool{}
+	for _, m := range hashtagPattern.FindAllStringSubmatch(*text, -1) {
+		have[strings.ToLower(m[1])] = true
+	}
+	add := []string{}
+	for _, tag := range tags {
+		if len(have)+len(add) >= style.Max {
+			break
+		}
+		if !have[strings.ToLower(tag)] {
+			add = append(add, "#"+tag)
+		}
+	}
+	if len(add) == 0 {
+		return nil
+	}
+	if *text != "" {
+		*text += "\n\n"
+	}
+	*text += strings.Join(add, " ")
+	return nil
+}
@@ -0,0 +1,88 @@
+package captions
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	got := NormalizeTags([]string{"#Go Lang!", "golang", "GoLang", "  rust ", "2024", "c++", "#", "über_cool", "café"})
+	want := []string{"GoLang", "rust", "c", "über_cool", "café"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("NormalizeTags = %q, want %q", got, want)
+	}
+}
+
+func TestResolveTags(t *testing.T) {
+	t.Setenv("DataDir", t.TempDir())
+	if _, err := SaveHashtagSet(HashtagSet{Name: "series", Tags: []string{"#Podcast", "golang", "go lang"}}); err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteHashtagSet("series")
+
+	got, err := ResolveTags([]string{"GoLang", "news"}, []string{"series"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the post's own tags come first and keep their spelling, the set's duplicates are dropped.
+	if want := "GoLang,news,Podcast"; strings.Join(got, ",") != want {
+		t.Errorf("ResolveTags = %q, want %s", got, want)
+	}
+
+	if got, err := ResolveTags(nil, nil); err != nil || len(got) != 0 {
+		t.Errorf("ResolveTags(nil, nil) = %q, %v", got, err)
+	}
+	if _, err := ResolveTags([]string{"a"}, []string{"missing"}); !errors.Is(err, ErrHashtagSetNotFound) || !strings.Contains(err.Error(), `"missing"`) {
+		t.Errorf("unknown set: %v", err)
+	}
+}
+
+func TestRenderTags(t *testing.T) {
+	many := []string{}
+	for i := 0; i < 40; i++ {
+		many = append(many, "tag"+string(rune('a'+i%26))+strings.Repeat("x", i/26))
+	}
+
+	cases := []struct {
+		name, platform, field, text string
+		tags                        []string
+		want                        string // the field afterwards
+	}{
+		{"appended after a blank line", "instagram", "caption", "New episode", []string{"Podcast", "GoLang"}, "New episode\n\n#Podcast #GoLang"},
+		{"empty text", "pinterest", "description", "", []string{"Podcast"}, "#Podcast"},
+		{"hashtags already in the text are not repeated", "instagram", "caption", "Out now #golang", []string{"GoLang", "Podcast"}, "Out now #golang\n\n#Podcast"},
+		{"all of them already there", "instagram", "caption", "#podcast", []string{"Podcast"}, "#podcast"},
+		{"linkedin takes five, counting the text's", "linkedin", "text_linkedin", "Hi #one #two", []string{"a", "b", "c", "d"}, "Hi #one #two\n\n#a #b #c"},
+		{"instagram takes thirty", "instagram", "caption", "x", many, "x\n\n#" + strings.Join(many[:30], " #")},
+		{"no tags", "instagram", "caption", "x", nil, "x"},
+	}
+	for _, c := range cases {
+		text := c.text
+		keywords := RenderTags(c.platform, c.tags, map[string]*string{c.field: &text})
+		if keywords != nil {
+			t.Errorf("%s: keywords %q for a hashtag platform", c.name, keywords)
+		}
+		if text != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, text, c.want)
+		}
+	}
+
+	// youtube takes keywords, at most 500 characters with the commas between them.
+	text := "description"
+	keywords := RenderTags("youtube", many, map[string]*string{"description": &text})
+	if len(keywords) != len(many) || text != "description" {
+		t.Errorf("youtube: %d keywords, description %q", len(keywords), text)
+	}
+	long := []string{strings.Repeat("a", 300), strings.Repeat("b", 199), "c", "d"}
+	keywords = RenderTags("youtube", long, map[string]*string{})
+	if n := len(strings.Join(keywords, ",")); len(keywords) != 2 || n > 500 {
+		t.Errorf("youtube: %d keywords, %d characters", len(keywords), n)
+	}
+
+	// reddit has no tags.
+	text = "body"
+	if keywords := RenderTags("reddit", []string{"a"}, map[string]*string{"text": &text}); keywords != nil || text != "body" {
+		t.Errorf("reddit: %q %q", keywords, text)
+	}
+}
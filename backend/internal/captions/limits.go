@@ -0,0 +1,220 @@
+package captions
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/TanishqM1/SocialContentDistributer/internal/links"
+)
+
+// every network caps its text fields, and counts differently: what a person sees as one character (an emoji with a
+// skin tone, a flag, an accented letter) can be several code points, and some platforms count UTF-16 units (so most
+// emoji count twice) or give every link the same weight however long it is. text is measured here the way the
+// platform does, and a post over a limit is either rejected before anything is sent or, if it asks for it,
+// shortened on a word (or at least a grapheme) boundary and ended with an ellipsis.
+
+// counting rules.
+const (
+	CountGraphemes = "graphemes" // user-perceived characters
+	CountUTF16     = "utf16"     // UTF-16 code units
+	CountWeighted  = "weighted"  // graphemes, with every link counting as urlWeight
+)
+
+// urlWeight is how much a link counts under CountWeighted.
+const urlWeight = 23
+
+// ellipsis ends truncated text.
+const ellipsis = "…"
+
+// overflow modes a post can pick with "text_overflow".
+const (
+	OverflowReject   = "reject"
+	OverflowTruncate = "truncate"
+)
+
+// Limit is the maximum length of one text field on one platform.
+type Limit struct {
+	Field string `json:"field"` // json name of the field in the post
+	Max   int    `json:"max"`
+	Count string `json:"count"` // counting rule
+}
+
+// Limits are the text limits of each platform.
+var Limits = map[string][]Limit{
+	"youtube": {
+		{Field: "title", Max: 100, Count: CountGraphemes},
+		{Field: "description", Max: 5000, Count: CountGraphemes},
+	},
+	"instagram": {
+		{Field: "caption", Max: 2200, Count: CountUTF16},
+	},
+	"pinterest": {
+		{Field: "title", Max: 100, Count: CountGraphemes},
+		{Field: "description", Max: 500, Count: CountGraphemes},
+	},
+	"reddit": {
+		{Field: "title", Max: 300, Count: CountGraphemes},
+		{Field: "text", Max: 40000, Count: CountGraphemes},
+	},
+	"linkedin": {
+		{Field: "text_linkedin", Max: 3000, Count: CountWeighted},
+	},
+}
+
+// Change records a field that was shortened to fit a platform.
+type Change struct {
+	Field  string `json:"field"`
+	Limit  int    `json:"limit"`
+	Count  string `json:"count"`
+	Length int    `json:"length"` // before
+	Text   string `json:"text"`   // after
+}
+
+// TooLongError is returned when a field is over a platform's limit and the post did not ask for truncation.
+type TooLongError struct {
+	Platform string
+	Limit
+	Length int
+}
+
+func (e *TooLongError) Error() string {
+	return fmt.Sprintf("%s for %s is %d characters (counted as %s), the limit is %d; shorten it or set \"text_overflow\": \"truncate\"",
+		e.Field, e.Platform, e.Length, e.Count, e.Max)
+}
+
+// unit is a piece of text that is never split: a grapheme, or a whole link when links are weighted.
+type unit struct {
+	text   string
+	weight int
+}
+
+// units splits s into what the counting rule counts.
+func units(s string, count string) []unit {
+	list := []unit{}
+	add := func(s string) {
+		for _, g := range Graphemes(s) {
+			w := 1
+			if count == CountUTF16 {
+				w = len(utf16.Encode([]rune(g)))
+			}
+			list = append(list, unit{text: g, weight: w})
+		}
+	}
+	if count != CountWeighted {
+		add(s)
+		return list
+	}
+	last := 0
+	for _, loc := range links.URLPattern.FindAllStringIndex(s, -1) {
+		add(s[last:loc[0]])
+		list = append(list, unit{text: s[loc[0]:loc[1]], weight: urlWeight})
+		last = loc[1]
+	}
+	add(s[last:])
+	return list
+}
+
+// Length measures s with the given counting rule.
+func Length(s string, count string) int {
+	n := 0
+	for _, u := range units(s, count) {
+		n += u.weight
+	}
+	return n
+}
+
+// shorten cuts s to at most max (counted with count) including the ellipsis. it prefers the last word boundary,
+// unless that throws away more than a third of what fits, and never splits a grapheme or a link.
+func shorten(s string, max int, count string) string {
+	list := units(s, count)
+	room := max - Length(ellipsis, count)
+	if room <= 0 {
+		return ""
+	}
+
+	fits, used := 0, 0
+	for fits < len(list) && used+list[fits].weight <= room {
+		used += list[fits].weight
+		fits++
+	}
+	cut := fits
+	if fits < len(list) {
+		for i := fits; i > fits*2/3; i-- {
+			if strings.TrimSpace(list[i].text) == "" {
+				cut = i
+				break
+			}
+		}
+	}
+
+	var out strings.Builder
+	for _, u := range list[:cut] {
+		out.WriteString(u.text)
+	}
+	return strings.TrimRightFunc(out.String(), unicode.IsSpace) + ellipsis
+}
+
+// Fit checks every limited text field of a platform. fields maps json names to the field values; with truncate
+// the values over their limit are shortened in place and reported, otherwise the first one over is an error.
+func Fit(platform string, fields map[string]*string, truncate bool) ([]Change, error) {
+	changes := []Change{}
+	for _, limit := range Limits[platform] {
+		field, ok := fields[limit.Field]
+		if !ok || *field == "" {
+			continue
+		}
+		n := Length(*field, limit.Count)
+		if n <= limit.Max {
+			continue
+		}
+		if !truncate {
+			return nil, &TooLongError{Platform: platform, Limit: limit, Length: n}
+		}
+		*field = shorten(*field, limit.Max, limit.Count)
+		changes = append(changes, Change{Field: limit.Field, Limit: limit.Max, Count: limit.Count, Length: n, Text: *field})
+	}
+	return changes, nil
+}
+
+// Graphemes splits s into user-perceived characters. it follows the main rules of Unicode text segmentation
+// (UAX #29): combining marks, variation selectors, emoji modifiers and tags stay with the character before them,
+// zero width joiners glue emoji sequences together, regional indicators pair up into flags and CR LF is one.
+func Graphemes(s string) []string {
+	list := []string{}
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		j := i + 1
+		if runes[i] == '\r' && j < len(runes) && runes[j] == '\n' {
+			j++
+		} else if regionalIndicator(runes[i]) && j < len(runes) && regionalIndicator(runes[j]) {
+			j++
+		}
+		for j < len(runes) {
+			if runes[j] == '\u200d' {
+				j = min(j+2, len(runes))
+				continue
+			}
+			if !extends(runes[j]) {
+				break
+			}
+			j++
+		}
+		list = append(list, string(runes[i:j]))
+		i = j
+	}
+	return list
+}
+
+// extends reports whether r belongs to the character before it.
+func extends(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) ||
+		(r >= 0xFE00 && r <= 0xFE0F) || // variation selectors
+		(r >= 0x1F3FB && r <= 0x1F3FF) || // skin tones
+		(r >= 0xE0020 && r <= 0xE007F) // tags (subdivision flags)
+}
+
+func regionalIndicator(r rune) bool {
+	return r >= 0x1F1E6 && r <= 0x1F1FF
+}
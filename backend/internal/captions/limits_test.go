@@ -0,0 +1,139 @@
+package captions
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const (
+	family = "\U0001F469\u200d\U0001F469\u200d\U0001F467" // woman, zwj, woman, zwj, girl
+	thumbs = "\U0001F44D\U0001F3FD"                       // thumbs up, medium skin tone
+	us     = "\U0001F1FA\U0001F1F8"
+	fr     = "\U0001F1EB\U0001F1F7"
+	de     = "\U0001F1E9\U0001F1EA"
+	// black flag, tag letters "gbsct", cancel tag: the flag of Scotland.
+	scotland = "\U0001F3F4\U000E0067\U000E0062\U000E0073\U000E0063\U000E0074\U000E007F"
+)
+
+func TestGraphemes(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{"", []string{}},
+		{"abc", []string{"a", "b", "c"}},
+		{"e\u0301a", []string{"e\u0301", "a"}}, // combining acute accent
+		{family + "!", []string{family, "!"}},
+		{thumbs + thumbs, []string{thumbs, thumbs}},
+		{us + fr + de, []string{us, fr, de}},
+		{us + "\U0001F1EB", []string{us, "\U0001F1EB"}}, // a lone regional indicator
+		{scotland + "x", []string{scotland, "x"}},
+		{"a\r\nb", []string{"a", "\r\n", "b"}},
+		{"\n\r", []string{"\n", "\r"}},
+		{"\u2764\uFE0F", []string{"\u2764\uFE0F"}}, // heart with emoji presentation
+		{"a\u200d", []string{"a\u200d"}},           // a joiner at the end
+	}
+	for _, c := range cases {
+		got := Graphemes(c.in)
+		if strings.Join(got, "|") != strings.Join(c.want, "|") || len(got) != len(c.want) {
+			t.Errorf("Graphemes(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestLength(t *testing.T) {
+	link := "https://example.com/a/very/long/path/that/is/longer/than/twenty/three"
+	cases := []struct {
+		in, count string
+		want      int
+	}{
+		{"hello", CountGraphemes, 5},
+		{"hello", CountUTF16, 5},
+		{"e\u0301", CountGraphemes, 1},
+		{"e\u0301", CountUTF16, 2},
+		{family, CountGraphemes, 1},
+		{family, CountUTF16, 8},
+		{us + fr, CountGraphemes, 2},
+		{us + fr, CountUTF16, 8},
+		{"a\r\nb", CountGraphemes, 3},
+		{"a\r\nb", CountUTF16, 4},
+		{"see " + link + " ok", CountWeighted, 4 + urlWeight + 3},
+		{"see " + link + " ok", CountGraphemes, 4 + len(link) + 3},
+		{"http://a.b", CountWeighted, urlWeight}, // short links count 23 too
+		{family + " " + link, CountWeighted, 2 + urlWeight},
+		{"", CountWeighted, 0},
+	}
+	for _, c := range cases {
+		if got := Length(c.in, c.count); got != c.want {
+			t.Errorf("Length(%q, %s) = %d, want %d", c.in, c.count, got, c.want)
+		}
+	}
+}
+
+func TestShorten(t *testing.T) {
+	cases := []struct {
+		name, in string
+		max      int
+		count    string
+		want     string
+	}{
+		{"word boundary", "the quick brown fox", 12, CountGraphemes, "the quick…"},
+		// the last space is more than a third back, so the word is cut instead.
+		{"no boundary close enough", "hello world foo", 10, CountGraphemes, "hello wor…"},
+		{"zwj sequence kept whole", "ab" + family + "cd", 4, CountGraphemes, "ab" + family + "…"},
+		{"zwj sequence does not fit", "ab" + family + "cd", 6, CountUTF16, "ab…"},
+		{"flags kept whole", us + fr + de, 3, CountGraphemes, us + fr + "…"},
+		{"flag does not fit in utf16", "a" + us + fr, 6, CountUTF16, "a" + us + "…"},
+		{"skin tone kept", "a" + thumbs + "bcd", 3, CountGraphemes, "a" + thumbs + "…"},
+		{"cr lf not split", "ab\r\ncd", 4, CountGraphemes, "ab…"},
+		{"link at the cut", "read https://example.com/x now", 20, CountWeighted, "read…"},
+		{"link fits", "read https://example.com/x now", 30, CountWeighted, "read https://example.com/x…"},
+		{"room is zero", "abc", 1, CountGraphemes, ""},
+		{"room is negative", "abc", 0, CountUTF16, ""},
+		{"room for one", "abc", 2, CountGraphemes, "a…"},
+	}
+	for _, c := range cases {
+		got := shorten(c.in, c.max, c.count)
+		if got != c.want {
+			t.Errorf("%s: shorten(%q, %d, %s) = %q, want %q", c.name, c.in, c.max, c.count, got, c.want)
+		}
+		if Length(got, c.count) > c.max {
+			t.Errorf("%s: %q is over %d", c.name, got, c.max)
+		}
+	}
+}
+
+func TestFit(t *testing.T) {
+	long := strings.Repeat("word ", 30) // 150 graphemes
+	title, description := long, "short"
+	fields := map[string]*string{"title": &title, "description": &description}
+
+	_, err := Fit("youtube", fields, false)
+	var tooLong *TooLongError
+	if !errors.As(err, &tooLong) || tooLong.Field != "title" || tooLong.Length != 150 || tooLong.Max != 100 {
+		t.Fatalf("Fit without truncate: %v", err)
+	}
+	if title != long {
+		t.Error("Fit changed the text while rejecting it")
+	}
+
+	changes, err := Fit("youtube", fields, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Field != "title" || changes[0].Length != 150 || changes[0].Text != title {
+		t.Errorf("changes %+v", changes)
+	}
+	if n := Length(title, CountGraphemes); n > 100 || !strings.HasSuffix(title, ellipsis) {
+		t.Errorf("title is %d long: %q", n, title)
+	}
+	if description != "short" {
+		t.Errorf("description changed to %q", description)
+	}
+
+	// platforms without limits, and fields a platform does not limit, are left alone.
+	if changes, err := Fit("unknown", fields, false); err != nil || len(changes) != 0 {
+		t.Errorf("unknown platform: %v %v", changes, err)
+	}
+}
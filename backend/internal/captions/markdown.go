@@ -0,0 +1,244 @@
+package captions
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/TanishqM1/SocialContentDistributer/internal/links"
+)
+
+// writers draft in Markdown, but only Reddit renders it. a post with "format": "markdown" has its body text turned
+// into what each platform shows natively:
+//
+//	reddit     kept as it is
+//	youtube    YouTube's own *bold*, _italic_ and -strikethrough-, links as "text (url)"
+//	linkedin   bold and italic as Unicode letters (𝗯𝗼𝗹𝗱, 𝘪𝘵𝘢𝘭𝘪𝘤), links as "text (url)"
+//	instagram  same as linkedin, links are not clickable there but the address still shows
+//	pinterest  emphasis removed, links as "text (url)"
+//
+// headings become a line in bold, list bullets become "•", code and quotes lose their markers.
+
+// formats a post's body text can be written in.
+const (
+	FormatPlain    = "plain"
+	FormatMarkdown = "markdown"
+)
+
+// markdownStyle is how a platform shows emphasis. nil functions mean Markdown is kept as it is.
+type markdownStyle struct {
+	bold, italic, boldItalic, strike func(string) string
+}
+
+var (
+	keepMarkdown = markdownStyle{}
+	youtubeStyle = markdownStyle{
+		bold:       func(s string) string { return "*" + s + "*" },
+		italic:     func(s string) string { return "_" + s + "_" },
+		boldItalic: func(s string) string { return "*_" + s + "_*" },
+		strike:     func(s string) string { return "-" + s + "-" },
+	}
+	unicodeStyle = markdownStyle{
+		bold:       unicodeBold,
+		italic:     unicodeItalic,
+		boldItalic: unicodeBoldItalic,
+		strike:     unicodeStrike,
+	}
+	plainStyle = markdownStyle{
+		bold:       func(s string) string { return s },
+		italic:     func(s string) string { return s },
+		boldItalic: func(s string) string { return s },
+		strike:     func(s string) string { return s },
+	}
+)
+
+// markdownStyles is the style of each platform, platforms not listed get plainStyle.
+var markdownStyles = map[string]markdownStyle{
+	"reddit":    keepMarkdown,
+	"youtube":   youtubeStyle,
+	"linkedin":  unicodeStyle,
+	"instagram": unicodeStyle,
+	"pinterest": plainStyle,
+}
+
+// MarkdownFields are the body text fields "format" applies to, by json name. titles are always plain.
+var MarkdownFields = []string{"description", "caption", "text", "text_linkedin"}
+
+var (
+	fencePattern    = regexp.MustCompile("^\\s*(```|~~~)")
+	headingPattern  = regexp.MustCompile(`^\s{0,3}#{1,6}\s+(.*?)\s*#*\s*$`)
+	bulletPattern   = regexp.MustCompile(`^(\s*)[-*+]\s+`)
+	quotePattern    = regexp.MustCompile(`^\s{0,3}>\s?`)
+	rulePattern     = regexp.MustCompile(`^\s{0,3}(-(\s*-){2,}|\*(\s*\*){2,}|_(\s*_){2,})\s*$`)
+	codePattern     = regexp.MustCompile("`([^`]+)`")
+	escapePattern   = regexp.MustCompile(`\\([\\` + "`" + `*_{}\[\]()#+\-.!~>|])`)
+	imagePattern    = regexp.MustCompile(`!\[([^\]]*)\]\(<?([^)\s>]+)>?(?:\s+"[^"]*")?\)`)
+	linkPattern     = regexp.MustCompile(`\[([^\]]+)\]\(<?([^)\s>]+)>?(?:\s+"[^"]*")?\)`)
+	autolinkPattern = regexp.MustCompile(`<(https?://[^>\s]+)>`)
+	bothPattern     = regexp.MustCompile(`\*\*\*(\S(?:.*?\S)?)\*\*\*|___(\S(?:.*?\S)?)___`)
+	boldPattern     = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*|__(\S(?:.*?\S)?)__`)
+	strikePattern   = regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`)
+	starPattern     = regexp.MustCompile(`\*(\S(?:.*?\S)?)\*`)
+	underPattern    = regexp.MustCompile(`(^|[^\p{L}\p{N}_])_(\S(?:.*?\S)?)_($|[^\p{L}\p{N}_])`)
+)
+
+// FromMarkdown converts Markdown to what platform shows natively.
+func FromMarkdown(platform string, text string) string {
+	style, ok := markdownStyles[platform]
+	if !ok {
+		style = plainStyle
+	}
+	if style.bold == nil {
+		return text
+	}
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	out := make([]string, 0, len(lines))
+	inCode := false
+	for _, line := range lines {
+		// code blocks are copied as they are, without their fences.
+		if fencePattern.MatchString(line) {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			out = append(out, line)
+			continue
+		}
+
+		switch {
+		case rulePattern.MatchString(line):
+			out = append(out, "———")
+		case headingPattern.MatchString(line):
+			out = append(out, inline(headingPattern.FindStringSubmatch(line)[1], style, true))
+		default:
+			line = quotePattern.ReplaceAllString(line, "")
+			line = bulletPattern.ReplaceAllString(line, "$1• ")
+			out = append(out, inline(line, style, false))
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// inline converts the Markdown inside one line, all of it in bold for a heading. code, escaped characters, links
+// and styled text are set aside in numbered slots as they are done, so emphasis markers inside them (a_b in a url,
+// YouTube's own *bold*) are left alone.
+func inline(line string, style markdownStyle, heading bool) string {
+	slots := []string{}
+	hold := func(s string) string {
+		slots = append(slots, s)
+		return slot(len(slots) - 1)
+	}
+	link := func(text string, url string) string {
+		if text == "" || text == url {
+			return hold(url)
+		}
+		return text + " (" + hold(url) + ")"
+	}
+
+	line = codePattern.ReplaceAllStringFunc(line, func(m string) string {
+		return hold(codePattern.FindStringSubmatch(m)[1])
+	})
+	line = escapePattern.ReplaceAllStringFunc(line, func(m string) string {
+		return hold(m[1:])
+	})
+	line = imagePattern.ReplaceAllStringFunc(line, func(m string) string {
+		sub := imagePattern.FindStringSubmatch(m)
+		return link(sub[1], sub[2])
+	})
+	line = linkPattern.ReplaceAllStringFunc(line, func(m string) string {
+		sub := linkPattern.FindStringSubmatch(m)
+		return link(sub[1], sub[2])
+	})
+	line = autolinkPattern.ReplaceAllStringFunc(line, func(m string) string {
+		return hold(autolinkPattern.FindStringSubmatch(m)[1])
+	})
+	line = links.URLPattern.ReplaceAllStringFunc(line, hold)
+
+	if heading {
+		// emphasis inside a heading is dropped, the whole line is bold already.
+		line = hold(style.bold(emphasis(line, plainStyle, func(s string) string { return s })))
+	} else {
+		line = emphasis(line, style, hold)
+	}
+
+	// a slot can hold an earlier one (an escape inside a link's url), so they are filled in from the last.
+	for i := len(slots) - 1; i >= 0; i-- {
+		line = strings.ReplaceAll(line, slot(i), slots[i])
+	}
+	return line
+}
+
+// emphasis converts bold italic, bold, strikethrough and italic text, inside out.
+func emphasis(line string, style markdownStyle, hold func(string) string) string {
+	line = bothPattern.ReplaceAllStringFunc(line, func(m string) string {
+		sub := bothPattern.FindStringSubmatch(m)
+		return hold(style.boldItalic(emphasis(sub[1]+sub[2], style, hold)))
+	})
+	line = boldPattern.ReplaceAllStringFunc(line, func(m string) string {
+		sub := boldPattern.FindStringSubmatch(m)
+		return hold(style.bold(emphasis(sub[1]+sub[2], style, hold)))
+	})
+	line = strikePattern.ReplaceAllStringFunc(line, func(m string) string {
+		return hold(style.strike(emphasis(strikePattern.FindStringSubmatch(m)[1], style, hold)))
+	})
+	line = starPattern.ReplaceAllStringFunc(line, func(m string) string {
+		return hold(style.italic(starPattern.FindStringSubmatch(m)[1]))
+	})
+	return underPattern.ReplaceAllStringFunc(line, func(m string) string {
+		sub := underPattern.FindStringSubmatch(m)
+		return sub[1] + hold(style.italic(sub[2])) + sub[3]
+	})
+}
+
+// slot is the placeholder for slot i, a private use character no style changes.
+func slot(i int) string {
+	return string(rune(0xE000 + i))
+}
+
+// mapLetters replaces ASCII letters and digits with the matching characters of a Unicode mathematical alphabet.
+// digits == 0 leaves digits alone (there are no italic digits).
+func mapLetters(s string, upper rune, lower rune, digits rune) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			b.WriteRune(upper + r - 'A')
+		case r >= 'a' && r <= 'z':
+			b.WriteRune(lower + r - 'a')
+		case r >= '0' && r <= '9' && digits != 0:
+			b.WriteRune(digits + r - '0')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// unicodeBold writes s in mathematical sans-serif bold.
+func unicodeBold(s string) string {
+	return mapLetters(s, 0x1D5D4, 0x1D5EE, 0x1D7EC)
+}
+
+// unicodeItalic writes s in mathematical sans-serif italic.
+func unicodeItalic(s string) string {
+	return mapLetters(s, 0x1D608, 0x1D622, 0)
+}
+
+// unicodeBoldItalic writes s in mathematical sans-serif bold italic.
+func unicodeBoldItalic(s string) string {
+	return mapLetters(s, 0x1D63C, 0x1D656, 0x1D7EC)
+}
+
+// unicodeStrike puts a combining long stroke over every character of s.
+func unicodeStrike(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + utf8.RuneCountInString(s)*2)
+	for _, r := range s {
+		b.WriteRune(r)
+		if r != ' ' && (r < 0xE000 || r > 0xF8FF) {
+			b.WriteRune('\u0336')
+		}
+	}
+	return b.String()
+}
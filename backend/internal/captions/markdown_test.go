@@ -0,0 +1,56 @@
+package captions
+
+import "testing"
+
+func TestFromMarkdown(t *testing.T) {
+	cases := []struct {
+		platform, in, want string
+	}{
+		// reddit renders Markdown itself.
+		{"reddit", "**bold** and *it* [docs](https://x.com)", "**bold** and *it* [docs](https://x.com)"},
+		{"reddit", "a\r\nb", "a\r\nb"},
+
+		// youtube has its own markers.
+		{"youtube", "**bold** and *it* and _it2_ and ~~gone~~", "*bold* and _it_ and _it2_ and -gone-"},
+		{"youtube", "***both***", "*_both_*"},
+		{"youtube", "**bold with *it* inside**", "*bold with _it_ inside*"},
+		{"youtube", "# Title *x*", "*Title x*"},
+
+		// linkedin and instagram get Unicode letters, digits in bold too.
+		{"linkedin", "**Go 123** is *fast*", "𝗚𝗼 𝟭𝟮𝟯 is 𝘧𝘢𝘴𝘵"},
+		{"linkedin", "***both***", "𝙗𝙤𝙩𝙝"},
+		{"instagram", "~~no~~", "n̶o̶"},
+		{"instagram", "## Big news", "𝗕𝗶𝗴 𝗻𝗲𝘄𝘀"},
+
+		// pinterest and platforms without a style lose the emphasis.
+		{"pinterest", "**bold** and *it* and ~~gone~~", "bold and it and gone"},
+		{"pinterest", "***both***", "both"},
+		{"tiktok", "**bold**", "bold"},
+
+		// links and images become "text (url)", emphasis markers inside urls are left alone.
+		{"pinterest", "see [the docs](https://x.com/a_b_c) now", "see the docs (https://x.com/a_b_c) now"},
+		{"linkedin", "[https://x.com](https://x.com)", "https://x.com"},
+		{"youtube", "![alt](https://x.com/i.png \"title\")", "alt (https://x.com/i.png)"},
+		{"youtube", "<https://x.com/a_b>", "https://x.com/a_b"},
+		{"youtube", "https://x.com/__init__ and *it*", "https://x.com/__init__ and _it_"},
+		{"linkedin", "**[docs](https://x.com/a_b)**", "𝗱𝗼𝗰𝘀 (https://x.com/a_b)"},
+
+		// code and escapes are kept as written.
+		{"pinterest", "use `a*b*c` here", "use a*b*c here"},
+		{"pinterest", "```\n**raw**\n```", "**raw**"},
+		{"pinterest", "\\*not italic\\*", "*not italic*"},
+		{"linkedin", "snake_case_name stays", "snake_case_name stays"},
+
+		// block markers.
+		{"pinterest", "- a\n* b\n  + c", "• a\n• b\n  • c"},
+		{"pinterest", "> quote", "quote"},
+		{"pinterest", "---", "———"},
+		{"pinterest", "1. one\r\n2. two", "1. one\n2. two"},
+		{"pinterest", "", ""},
+	}
+	for _, c := range cases {
+		if got := FromMarkdown(c.platform, c.in); got != c.want {
+			t.Errorf("FromMarkdown(%s, %q) = %q, want %q", c.platform, c.in, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package captions
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/TanishqM1/SocialContentDistributer/internal/store"
+)
+
+// caption templates are Go text/template snippets saved by name, e.g.
+//
+//	Episode {{.Number}}: {{.Title}} — watch at {{.Link}} {{hashtags .Tags}}
+//
+// a post fills a text field from one with "templates": {"caption": "episode"} and the values in "variables".
+// templates are rendered once per platform (after that platform's overrides), so the helpers below write
+// hashtags and mentions the way each platform expects them. they are saved to templates.json in the data directory.
+
+// ErrTemplateNotFound is returned for a template name that does not exist.
+var ErrTemplateNotFound = errors.New("caption template not found")
+
+// InvalidTemplateError says why a template could not be saved or rendered.
+type InvalidTemplateError struct {
+	Reason string
+}
+
+func (e *InvalidTemplateError) Error() string {
+	return "invalid caption template: " + e.Reason
+}
+
+// Template is a named caption template.
+type Template struct {
+	Name string `json:"name"`
+	Body string `json:"body"`
+}
+
+var (
+	templatesMu sync.Mutex
+	templates   = map[string]Template{}
+)
+
+func templatesPath() string {
+	return store.Path("templates.json")
+}
+
+// LoadTemplates reads templates.json. Call it once on startup.
+func LoadTemplates() error {
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+	return store.Load(templatesPath(), &templates)
+}
+
+// funcs returns the helper functions templates can call, written for platform.
+func funcs(platform string) template.FuncMap {
+	return template.FuncMap{
+		"platform": func() string { return platform },
+		"hashtags": func(tags interface{}) string { return Hashtags(platform, toStrings(tags)) },
+		"mention":  func(handle string) string { return Mention(platform, handle) },
+		"truncate": Truncate,
+	}
+}
+
+// parse parses a template body with the helpers for platform. a variable the post does not give is an error
+// rather than "<no value>" in a published caption.
+func parse(t Template, platform string) (*template.Template, error) {
+	parsed, err := template.New(t.Name).Funcs(funcs(platform)).Option("missingkey=error").Parse(t.Body)
+	if err != nil {
+		return nil, &InvalidTemplateError{Reason: err.Error()}
+	}
+	return parsed, nil
+}
+
+// SaveTemplate creates or replaces a template, after checking it parses.
+func SaveTemplate(t Template) (Template, error) {
+	if t.Name == "" || strings.ContainsAny(t.Name, "/\\") || len(t.Name) > 64 {
+		return Template{}, &InvalidTemplateError{Reason: "name must be 1 to 64 characters without slashes"}
+	}
+	if strings.TrimSpace(t.Body) == "" {
+		return Template{}, &InvalidTemplateError{Reason: "body is empty"}
+	}
+	if _, err := parse(t, ""); err != nil {
+		return Template{}, err
+	}
+
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+
+	old, existed := templates[t.Name]
+	templates[t.Name] = t
+	if err := store.Save(templatesPath(), templates); err != nil {
+		// keep memory in line with what is on disk.
+		if existed {
+			templates[t.Name] = old
+		} else {
+			delete(templates, t.Name)
+		}
+		return Template{}, err
+	}
+	return t, nil
+}
+
+// GetTemplate returns the template with the given name.
+func GetTemplate(name string) (Template, error) {
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+
+	t, ok := templates[name]
+	if !ok {
+		return Template{}, ErrTemplateNotFound
+	}
+	return t, nil
+}
+
+// ListTemplates returns every template, by name.
+func ListTemplates() []Template {
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+
+	list := make([]Template, 0, len(templates))
+	for _, t := range templates {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].Name < list[b].Name
+	})
+	return list
+}
+
+// DeleteTemplate removes a template.
+func DeleteTemplate(name string) error {
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+
+	old, ok := templates[name]
+	if !ok {
+		return ErrTemplateNotFound
+	}
+	delete(templates, name)
+	if err := store.Save(templatesPath(), templates); err != nil {
+		templates[name] = old
+		return err
+	}
+	return nil
+}
+
+// Render renders the named template for platform with the given variables.
+func Render(name string, platform string, variables map[string]interface{}) (string, error) {
+	t, err := GetTemplate(name)
+	if err != nil {
+		return "", err
+	}
+	parsed, err := parse(t, platform)
+	if err != nil {
+		return "", err
+	}
+	if variables == nil {
+		variables = map[string]interface{}{}
+	}
+
+	var out strings.Builder
+	if err := parsed.Execute(&out, variables); err != nil {
+		return "", &InvalidTemplateError{Reason: err.Error()}
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// toStrings accepts the ways a list of tags can arrive in json variables: an array, or one comma separated string.
+func toStrings(v interface{}) []string {
+	switch v := v.(type) {
+	case []string:
+		return v
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			list = append(list, fmt.Sprint(item))
+		}
+		return list
+	case string:
+		return strings.Split(v, ",")
+	case nil:
+		return nil
+	}
+	return []string{fmt.Sprint(v)}
+}
+
+// Mention writes a handle the way platform links to a user.
+func Mention(platform string, handle string) string {
+	handle = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(handle), "@"), "u/")
+	if handle == "" {
+		return ""
+	}
+	if platform == "reddit" {
+		return "u/" + handle
+	}
+	return "@" + handle
+}
+
+// Truncate shortens s to at most n characters (graphemes), on a word boundary, ending with an ellipsis.
+func Truncate(n int, s string) string {
+	if n <= 0 || Length(s, CountGraphemes) <= n {
+		return s
+	}
+	return shorten(s, n, CountGraphemes)
+}
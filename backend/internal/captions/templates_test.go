@@ -0,0 +1,141 @@
+package captions
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRenderHelpers(t *testing.T) {
+	t.Setenv("DataDir", t.TempDir())
+
+	vars := map[string]interface{}{
+		"Tags":  []interface{}{"#Go Lang!", "podcast", "golang"},
+		"List":  "go, rust",
+		"Host":  "@gopher",
+		"User":  "u/gopher",
+		"Title": "A fairly long episode title about Go",
+	}
+	cases := []struct {
+		body, platform, want string
+	}{
+		{"{{hashtags .Tags}}", "instagram", "#GoLang #podcast"},
+		{"{{hashtags .Tags}}", "linkedin", "#GoLang #podcast"},
+		{"{{hashtags .Tags}}", "reddit", "GoLang podcast"},
+		{"{{hashtags .List}}", "pinterest", "#go #rust"},
+		{`{{hashtags ""}}`, "instagram", ""},
+		{"with {{mention .Host}}", "instagram", "with @gopher"},
+		{"with {{mention .Host}}", "reddit", "with u/gopher"},
+		{"with {{mention .User}}", "youtube", "with @gopher"},
+		{"with {{mention .User}}", "reddit", "with u/gopher"},
+		{"with {{mention \"\"}}", "instagram", "with"},
+		{"{{truncate 20 .Title}}", "youtube", "A fairly long…"},
+		{"{{truncate 100 .Title}}", "youtube", "A fairly long episode title about Go"},
+		{"{{truncate 0 .Title}}", "youtube", "A fairly long episode title about Go"},
+		{"on {{platform}}", "pinterest", "on pinterest"},
+	}
+	for _, c := range cases {
+		if _, err := SaveTemplate(Template{Name: "helpers", Body: c.body}); err != nil {
+			t.Fatalf("%q: %v", c.body, err)
+		}
+		got, err := Render("helpers", c.platform, vars)
+		if err != nil {
+			t.Errorf("%q on %s: %v", c.body, c.platform, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%q on %s = %q, want %q", c.body, c.platform, got, c.want)
+		}
+	}
+}
+
+func TestRenderMissingVariable(t *testing.T) {
+	t.Setenv("DataDir", t.TempDir())
+	if _, err := SaveTemplate(Template{Name: "episode", Body: "Episode {{.Number}}: {{.Title}}"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var invalid *InvalidTemplateError
+	for _, vars := range []map[string]interface{}{nil, {"Number": 12}} {
+		if got, err := Render("episode", "instagram", vars); !errors.As(err, &invalid) {
+			t.Errorf("Render with %v = %q, %v, want an InvalidTemplateError", vars, got, err)
+		}
+	}
+	if got, err := Render("episode", "instagram", map[string]interface{}{"Number": 12, "Title": "Go"}); err != nil || got != "Episode 12: Go" {
+		t.Errorf("Render = %q, %v", got, err)
+	}
+	if _, err := Render("missing", "instagram", nil); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("unknown template: %v", err)
+	}
+}
+
+func TestSaveTemplateValidates(t *testing.T) {
+	t.Setenv("DataDir", t.TempDir())
+
+	cases := []struct {
+		name string
+		t    Template
+		ok   bool
+	}{
+		{"plain name", Template{Name: "episode", Body: "x"}, true},
+		{"64 characters", Template{Name: strings.Repeat("a", 64), Body: "x"}, true},
+		{"empty name", Template{Name: "", Body: "x"}, false},
+		{"65 characters", Template{Name: strings.Repeat("a", 65), Body: "x"}, false},
+		{"slash", Template{Name: "a/b", Body: "x"}, false},
+		{"backslash", Template{Name: `a\b`, Body: "x"}, false},
+		{"blank body", Template{Name: "blank", Body: " \n "}, false},
+		{"does not parse", Template{Name: "broken", Body: "{{.Title"}, false},
+		{"unknown helper", Template{Name: "helper", Body: "{{shout .Title}}"}, false},
+	}
+	for _, c := range cases {
+		_, err := SaveTemplate(c.t)
+		var invalid *InvalidTemplateError
+		if c.ok && err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+		if !c.ok && !errors.As(err, &invalid) {
+			t.Errorf("%s: %v, want an InvalidTemplateError", c.name, err)
+		}
+		if _, getErr := GetTemplate(c.t.Name); (getErr == nil) != c.ok {
+			t.Errorf("%s: saved %v", c.name, getErr == nil)
+		}
+	}
+}
+
+// a template that could not be written to templates.json is not kept in memory either.
+func TestTemplatesRollBackFailedSaves(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DataDir", dir)
+	if _, err := SaveTemplate(Template{Name: "kept", Body: "old"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// replace the data directory with a file, so nothing can be saved.
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(dir) })
+
+	if _, err := SaveTemplate(Template{Name: "new", Body: "x"}); err == nil {
+		t.Fatal("saving into a broken data directory worked")
+	}
+	if _, err := GetTemplate("new"); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("unsaved template is kept: %v", err)
+	}
+	if _, err := SaveTemplate(Template{Name: "kept", Body: "new"}); err == nil {
+		t.Fatal("saving into a broken data directory worked")
+	}
+	if got, err := GetTemplate("kept"); err != nil || got.Body != "old" {
+		t.Errorf("replaced template is %+v, %v", got, err)
+	}
+	if err := DeleteTemplate("kept"); err == nil {
+		t.Fatal("deleting from a broken data directory worked")
+	}
+	if _, err := GetTemplate("kept"); err != nil {
+		t.Errorf("template is gone from memory: %v", err)
+	}
+}
@@ -2,73 +2,135 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
-	"strings"
-	"time"
+
+	"github.com/TanishqM1/SocialContentDistributer/internal/media"
 )
 
-// UploadFile handles single file uploads
+// multipartSlack covers the boundaries and part headers around the file when comparing Content-Length to our limits.
+const multipartSlack = 1 << 20
+
+// UploadFile handles single file uploads.
+// The file is streamed straight from the request body to disk, nothing is buffered in memory or in temp files.
+// Media is stored by content, uploading a file we already have returns the existing media id.
 func UploadFile(w http.ResponseWriter, r *http.Request) {
-	// Parse the multipart form
-	err := r.ParseMultipartForm(10 << 20) // 10 MB max file size
+	// a client that already knows the sha256 of its file can skip the upload entirely if we have it
+	if checksum := r.Header.Get("X-Content-Sha256"); checksum != "" {
+		if item, ok := media.FindByChecksum(checksum); ok {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(uploadResponse(item, true))
+			return
+		}
+	}
+
+	maxSize := media.MaxUploadSize() + multipartSlack
+
+	// Reject oversized uploads before reading anything
+	if r.ContentLength > maxSize {
+		http.Error(w, fmt.Sprintf("File too large (limit is %d MB)", media.MaxUploadSize()>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+
+	// Find the "file" part of the multipart body
+	reader, err := r.MultipartReader()
 	if err != nil {
 		http.Error(w, "Unable to parse form", http.StatusBadRequest)
 		return
 	}
 
-	// Get the file from the form
-	file, handler, err := r.FormFile("file")
-	if err != nil {
+	var part io.ReadCloser
+	var originalName string
+	for {
+		p, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			http.Error(w, "Unable to parse form", http.StatusBadRequest)
+			return
+		}
+		if p.FormName() == "file" {
+			part = p
+			originalName = p.FileName()
+			break
+		}
+		p.Close()
+	}
+	if part == nil {
 		http.Error(w, "Unable to get file from form", http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
+	defer part.Close()
 
-	// Create uploads directory if it doesn't exist
-	uploadDir := "uploads/media"
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
+	filePath, err := media.StagingPath()
+	if err != nil {
 		log.Printf("Error creating upload directory: %v", err)
 		http.Error(w, "Unable to create upload directory", http.StatusInternalServerError)
 		return
 	}
 
-	// Generate unique filename
-	ext := filepath.Ext(handler.Filename)
-	timestamp := time.Now().Format("20060102_150405")
-	uniqueFilename := fmt.Sprintf("%s_%s%s", strings.TrimSuffix(handler.Filename, ext), timestamp, ext)
-	filePath := filepath.Join(uploadDir, uniqueFilename)
-
-	// Create the file on disk
-	dst, err := os.Create(filePath)
+	// Stream the upload to disk (checks the per-type limit and hashes as it goes)
+	saved, err := media.Save(part, filePath)
 	if err != nil {
-		log.Printf("Error creating file: %v", err)
-		http.Error(w, "Unable to create file", http.StatusInternalServerError)
+		writeSaveError(w, err)
 		return
 	}
-	defer dst.Close()
 
-	// Copy the uploaded file to the destination
-	_, err = io.Copy(dst, file)
+	// Register it in the media library (moves it to its content addressed path, or drops it if we already have it)
+	item, duplicate, err := media.Add(saved, originalName)
 	if err != nil {
-		log.Printf("Error copying file: %v", err)
+		log.Printf("Error adding file to media library: %v", err)
 		http.Error(w, "Unable to save file", http.StatusInternalServerError)
 		return
 	}
 
 	// Return success response with file path
-	response := map[string]interface{}{
-		"success":    true,
-		"filename":   uniqueFilename,
-		"file_path":  filePath,
-		"file_size":  handler.Size,
-		"file_type":  handler.Header.Get("Content-Type"),
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(uploadResponse(item, duplicate))
+}
+
+// uploadResponse is the json returned for a finished upload (by UploadFile and the tus endpoint).
+// duplicate is set when the content was already in the library and the existing item is returned.
+func uploadResponse(item media.Item, duplicate bool) map[string]interface{} {
+	return map[string]interface{}{
+		"success":   true,
+		"duplicate": duplicate,
+		"media_id":  item.ID,
+		"filename":  item.Filename,
+		"file_path": item.Filename,
+		"file_size": item.Size,
+		"file_type": item.MimeType,
+		"checksum":  item.Checksum,
+		"width":     item.Width,
+		"height":    item.Height,
+		"duration":  item.Duration,
+
+		"orientation": item.Orientation,
+		"video_codec": item.VideoCodec,
+		"audio_codec": item.AudioCodec,
+		"frame_rate":  item.FrameRate,
+		"bitrate":     item.Bitrate,
 	}
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+// writeSaveError maps an error from media.Save to a response.
+func writeSaveError(w http.ResponseWriter, err error) {
+	var tooLarge *media.TooLargeError
+	var maxBytes *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, "File too large: "+tooLarge.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, media.ErrEmptyFile):
+		http.Error(w, "Uploaded file is empty", http.StatusBadRequest)
+	case errors.As(err, &maxBytes):
+		http.Error(w, fmt.Sprintf("File too large (limit is %d MB)", media.MaxUploadSize()>>20), http.StatusRequestEntityTooLarge)
+	default:
+		log.Printf("Error saving file: %v", err)
+		http.Error(w, "Unable to save file", http.StatusInternalServerError)
+	}
 }
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/TanishqM1/SocialContentDistributer/api"
+	"github.com/TanishqM1/SocialContentDistributer/internal/captions"
+)
+
+// in this file, I handle the saved hashtag sets (internal/captions/hashtags.go) a post can add with "hashtag_sets".
+
+// writeHashtagSetError sends a 404 for unknown sets, a 400 for invalid ones and logs anything else as internal.
+func writeHashtagSetError(w http.ResponseWriter, err error) {
+	var invalid *captions.InvalidHashtagSetError
+	switch {
+	case errors.Is(err, captions.ErrHashtagSetNotFound):
+		api.HandleNotFoundError(w, err.Error())
+	case errors.As(err, &invalid):
+		api.HandleRequestError(w, err)
+	default:
+		log.Error(err)
+		api.HandleInternalError(w)
+	}
+}
+
+// ListHashtagSets returns every hashtag set.
+func ListHashtagSets(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, captions.ListHashtagSets())
+}
+
+// GetHashtagSet returns one set.
+func GetHashtagSet(w http.ResponseWriter, r *http.Request) {
+	set, err := captions.GetHashtagSet(chi.URLParam(r, "name"))
+	if err != nil {
+		writeHashtagSetError(w, err)
+		return
+	}
+	writeJSON(w, set)
+}
+
+// SaveHashtagSet creates or replaces the set named in the url. The response has the tags normalized.
+// Body: {"tags": ["golang", "#Go Lang", "backend"]}
+func SaveHashtagSet(w http.ResponseWriter, r *http.Request) {
+	var set captions.HashtagSet
+	if err := json.NewDecoder(r.Body).Decode(&set); err != nil {
+		api.HandleRequestError(w, err)
+		return
+	}
+	set.Name = chi.URLParam(r, "name")
+
+	saved, err := captions.SaveHashtagSet(set)
+	if err != nil {
+		writeHashtagSetError(w, err)
+		return
+	}
+	writeJSON(w, saved)
+}
+
+// DeleteHashtagSet removes a set.
+func DeleteHashtagSet(w http.ResponseWriter, r *http.Request) {
+	if err := captions.DeleteHashtagSet(chi.URLParam(r, "name")); err != nil {
+		writeHashtagSetError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/TanishqM1/SocialContentDistributer/api"
+	"github.com/TanishqM1/SocialContentDistributer/internal/jobs"
+	"github.com/TanishqM1/SocialContentDistributer/internal/links"
+)
+
+// in this file, I handle the settings for the links that go out in posts (internal/links).
+
+// GetUTM returns the UTM rules.
+func GetUTM(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, links.GetUTM())
+}
+
+// SaveUTM replaces the UTM rules.
+// Body: {"enabled": true, "medium": "social", "exclude": ["youtube.com"], "platforms": {"reddit": {"medium": "community"}}}
+func SaveUTM(w http.ResponseWriter, r *http.Request) {
+	var config links.UTMConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		api.HandleRequestError(w, err)
+		return
+	}
+
+	saved, err := links.SaveUTM(config)
+	var invalid *links.InvalidUTMError
+	switch {
+	case errors.As(err, &invalid):
+		api.HandleRequestError(w, err)
+	case err != nil:
+		log.Error(err)
+		api.HandleInternalError(w)
+	default:
+		writeJSON(w, saved)
+	}
+}
+
+// FollowLink redirects a short link to where it goes and records the click.
+func FollowLink(w http.ResponseWriter, r *http.Request) {
+	url, err := links.Follow(chi.URLParam(r, "code"), r.Referer())
+	if err != nil {
+		api.HandleNotFoundError(w, err.Error())
+		return
+	}
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// GetPostLinks returns the short links of a post with their click counts and latest clicks, and the clicks per platform.
+func GetPostLinks(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, ok := jobs.Get(id); !ok {
+		api.HandleNotFoundError(w, "post not found")
+		return
+	}
+
+	list := links.ForPost(id)
+	byPlatform := map[string]int{}
+	for _, l := range list {
+		byPlatform[l.Platform] += l.ClickCount
+	}
+	writeJSON(w, map[string]interface{}{
+		"post_id":            id,
+		"links":              list,
+		"clicks_by_platform": byPlatform,
+	})
+}
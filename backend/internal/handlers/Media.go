@@ -0,0 +1,496 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/TanishqM1/SocialContentDistributer/api"
+	"github.com/TanishqM1/SocialContentDistributer/internal/media"
+	"github.com/TanishqM1/SocialContentDistributer/internal/storage"
+	"github.com/go-chi/chi"
+)
+
+// media library endpoints. everything is looked up through the library index (internal/media), never the directory.
+
+type tagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+type transcodeRequest struct {
+	Platform string `json:"platform"`
+}
+
+type variantsRequest struct {
+	Platforms []string     `json:"platforms"`
+	Focus     *media.Point `json:"focus"` // optional, overrides the item's focal point
+}
+
+type framesRequest struct {
+	Times []float64 `json:"times"` // seconds from the start, optional
+}
+
+type renderRequest struct {
+	Cover    string `json:"cover"` // media id of the image
+	Waveform bool   `json:"waveform"`
+	Platform string `json:"platform"` // sizes the video, optional
+}
+
+type importRequest struct {
+	URL  string   `json:"url"`
+	Tags []string `json:"tags"` // optional, added to the imported item
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeMediaError sends a 404 for unknown media, a 409 for media a post still uses, a 422 for images too big to
+// decode and logs anything else as internal.
+func writeMediaError(w http.ResponseWriter, err error) {
+	if errors.Is(err, media.ErrNotFound) {
+		api.HandleNotFoundError(w, err.Error())
+		return
+	}
+	if errors.Is(err, media.ErrInUse) {
+		api.HandleStatusError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, media.ErrImageTooLarge) {
+		api.HandleStatusError(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	log.Error(err)
+	api.HandleInternalError(w)
+}
+
+// ListMedia returns the library, newest first. Optional filters: ?kind=image|video|audio|other and ?tag=...
+func ListMedia(w http.ResponseWriter, r *http.Request) {
+	items := media.List(media.Filter{
+		Kind: r.URL.Query().Get("kind"),
+		Tag:  r.URL.Query().Get("tag"),
+	})
+	writeJSON(w, map[string]interface{}{
+		"media": items,
+		"count": len(items),
+	})
+}
+
+// GetMedia describes a single media item.
+func GetMedia(w http.ResponseWriter, r *http.Request) {
+	item, err := media.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		writeMediaError(w, err)
+		return
+	}
+	writeJSON(w, item)
+}
+
+// DeleteMedia removes a media item and its file, unless a post that has not finished uses it.
+func DeleteMedia(w http.ResponseWriter, r *http.Request) {
+	if err := media.Delete(chi.URLParam(r, "id")); err != nil {
+		writeMediaError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetMediaTags replaces the tags of a media item (PUT) or adds to them (POST). Body: {"tags": ["a", "b"]}
+func SetMediaTags(w http.ResponseWriter, r *http.Request) {
+	var body tagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		api.HandleRequestError(w, err)
+		return
+	}
+
+	var item media.Item
+	var err error
+	if r.Method == http.MethodPut {
+		item, err = media.SetTags(chi.URLParam(r, "id"), body.Tags)
+	} else {
+		item, err = media.AddTags(chi.URLParam(r, "id"), body.Tags)
+	}
+	if err != nil {
+		writeMediaError(w, err)
+		return
+	}
+	writeJSON(w, item)
+}
+
+// DeleteMediaTag takes one tag off a media item.
+func DeleteMediaTag(w http.ResponseWriter, r *http.Request) {
+	item, err := media.RemoveTag(chi.URLParam(r, "id"), chi.URLParam(r, "tag"))
+	if err != nil {
+		writeMediaError(w, err)
+		return
+	}
+	writeJSON(w, item)
+}
+
+// CollectMediaGarbage removes files no longer referenced by the library or any post, and expired resumable uploads.
+func CollectMediaGarbage(w http.ResponseWriter, r *http.Request) {
+	report, err := CollectGarbage()
+	if err != nil {
+		log.Error(err)
+		api.HandleInternalError(w)
+		return
+	}
+	writeJSON(w, report)
+}
+
+// CollectGarbage runs media.GC and ExpireTusUploads, the tus files count as orphans in the report.
+func CollectGarbage() (media.GCReport, error) {
+	report, err := media.GC()
+	if err != nil {
+		return report, err
+	}
+	expired, freed, err := ExpireTusUploads()
+	report.Orphans = append(report.Orphans, expired...)
+	report.FreedBytes += freed
+	return report, err
+}
+
+// GetMediaURL returns a presigned download link for a media item. ?expires= is in seconds (default one hour).
+func GetMediaURL(w http.ResponseWriter, r *http.Request) {
+	expires := time.Hour
+	if v := r.URL.Query().Get("expires"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds <= 0 {
+			api.HandleRequestError(w, errors.New("expires must be a positive number of seconds"))
+			return
+		}
+		expires = time.Duration(seconds) * time.Second
+	}
+
+	url, err := media.PresignURL(r.Context(), chi.URLParam(r, "id"), expires)
+	if err != nil {
+		writeMediaError(w, err)
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"url":        url,
+		"expires_at": time.Now().Add(expires),
+	})
+}
+
+// ImportMedia fetches a remote file into the library. Body: {"url": "https://...", "tags": ["optional"]}
+// The response is the same as for an upload, so its media_id can be used in any publish request.
+func ImportMedia(w http.ResponseWriter, r *http.Request) {
+	var body importRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		api.HandleRequestError(w, err)
+		return
+	}
+
+	item, duplicate, err := media.Import(r.Context(), body.URL)
+	if err != nil {
+		writeImportError(w, err)
+		return
+	}
+	if len(body.Tags) > 0 {
+		if item, err = media.AddTags(item.ID, body.Tags); err != nil {
+			writeMediaError(w, err)
+			return
+		}
+	}
+	writeJSON(w, uploadResponse(item, duplicate))
+}
+
+// writeImportError maps an error from media.Import to a status: our fault, the client's, or the remote server's.
+func writeImportError(w http.ResponseWriter, err error) {
+	var tooLarge *media.TooLargeError
+	var unsupported *media.UnsupportedTypeError
+	var remote *media.RemoteError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, media.ErrInvalidImportURL), errors.Is(err, media.ErrBlockedHost):
+		api.HandleRequestError(w, err)
+	case errors.As(err, &tooLarge):
+		api.HandleStatusError(w, "File too large: "+tooLarge.Error(), http.StatusRequestEntityTooLarge)
+	case errors.As(err, &unsupported):
+		api.HandleStatusError(w, unsupported.Error(), http.StatusUnsupportedMediaType)
+	case errors.Is(err, media.ErrEmptyFile):
+		api.HandleStatusError(w, "remote file is empty", http.StatusBadGateway)
+	case errors.As(err, &remote):
+		api.HandleStatusError(w, remote.Error(), http.StatusBadGateway)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		api.HandleStatusError(w, "timed out fetching the remote file", http.StatusGatewayTimeout)
+	case errors.As(err, &netErr):
+		api.HandleStatusError(w, "could not fetch the remote file: "+err.Error(), http.StatusBadGateway)
+	default:
+		log.Error(err)
+		api.HandleInternalError(w)
+	}
+}
+
+// TranscodeMedia makes (or returns the cached) rendition of a video for a platform. Body: {"platform": "instagram"}
+// Publishing does this by itself, this is for checking the result up front.
+func TranscodeMedia(w http.ResponseWriter, r *http.Request) {
+	var body transcodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		api.HandleRequestError(w, err)
+		return
+	}
+
+	item, err := media.Transcode(r.Context(), chi.URLParam(r, "id"), body.Platform)
+	switch {
+	case errors.Is(err, media.ErrUnknownProfile), errors.Is(err, media.ErrNotTranscodable):
+		api.HandleRequestError(w, err)
+	case errors.Is(err, media.ErrNoFFmpeg):
+		api.HandleStatusError(w, err.Error(), http.StatusServiceUnavailable)
+	case err != nil:
+		writeMediaError(w, err)
+	default:
+		writeJSON(w, item)
+	}
+}
+
+// ExtractFrames grabs candidate thumbnails from a video. Body: {"times": [1.5, 12, 30]}, without times a few are picked.
+// Each frame is an image with its own media id, to be used in a post's "thumbnails".
+func ExtractFrames(w http.ResponseWriter, r *http.Request) {
+	var body framesRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		api.HandleRequestError(w, err)
+		return
+	}
+
+	frames, err := media.Frames(r.Context(), chi.URLParam(r, "id"), body.Times)
+	switch {
+	case errors.Is(err, media.ErrNotTranscodable), errors.Is(err, media.ErrInvalidFrameTime), errors.Is(err, media.ErrTooManyFrames):
+		api.HandleRequestError(w, err)
+	case errors.Is(err, media.ErrNoFFmpeg):
+		api.HandleStatusError(w, err.Error(), http.StatusServiceUnavailable)
+	case err != nil:
+		writeMediaError(w, err)
+	default:
+		writeJSON(w, frames)
+	}
+}
+
+// MakeClip cuts a vertical 9:16 clip out of a video, to post as a Reel or Short.
+// Body: {"start": 30, "end": 75, "strategy": "center|letterbox|blur", "focus": {"x": 0.4, "y": 0.5}}
+func MakeClip(w http.ResponseWriter, r *http.Request) {
+	var clip media.Clip
+	if err := json.NewDecoder(r.Body).Decode(&clip); err != nil {
+		api.HandleRequestError(w, err)
+		return
+	}
+
+	item, err := media.MakeClip(r.Context(), chi.URLParam(r, "id"), clip)
+	switch {
+	case errors.Is(err, media.ErrNotTranscodable), errors.Is(err, media.ErrInvalidClip),
+		errors.Is(err, media.ErrUnknownStrategy), errors.Is(err, media.ErrInvalidFocus):
+		api.HandleRequestError(w, err)
+	case errors.Is(err, media.ErrNoFFmpeg):
+		api.HandleStatusError(w, err.Error(), http.StatusServiceUnavailable)
+	case err != nil:
+		writeMediaError(w, err)
+	default:
+		writeJSON(w, item)
+	}
+}
+
+// RenderAudio turns an audio file and a cover image into a video. Body: {"cover": "<media id>", "waveform": true, "platform": "youtube"}
+// Publishing does this by itself when a post has a cover_image, this is for checking the result up front.
+func RenderAudio(w http.ResponseWriter, r *http.Request) {
+	var body renderRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		api.HandleRequestError(w, err)
+		return
+	}
+
+	item, err := media.RenderAudio(r.Context(), chi.URLParam(r, "id"), body.Cover, body.Waveform, body.Platform)
+	switch {
+	case errors.Is(err, media.ErrNotTranscodable), errors.Is(err, media.ErrNoCover), errors.Is(err, media.ErrInvalidCover):
+		api.HandleRequestError(w, err)
+	case errors.Is(err, media.ErrNoFFmpeg):
+		api.HandleStatusError(w, err.Error(), http.StatusServiceUnavailable)
+	case err != nil:
+		writeMediaError(w, err)
+	default:
+		writeJSON(w, item)
+	}
+}
+
+// MakeImageVariants converts an image for each platform. Body: {"platforms": ["instagram", "pinterest"], "focus": {"x": 0.5, "y": 0.3}}
+// Publishing does this by itself, this is for previewing the crops.
+func MakeImageVariants(w http.ResponseWriter, r *http.Request) {
+	var body variantsRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		api.HandleRequestError(w, err)
+		return
+	}
+
+	variants := map[string]media.Item{}
+	for _, platform := range body.Platforms {
+		item, err := media.ImageVariant(r.Context(), chi.URLParam(r, "id"), platform, body.Focus)
+		if err != nil {
+			writeVariantError(w, platform, err)
+			return
+		}
+		variants[platform] = item
+	}
+	writeJSON(w, map[string]interface{}{
+		"variants": variants,
+	})
+}
+
+func writeVariantError(w http.ResponseWriter, platform string, err error) {
+	var unsupported *media.UnsupportedImageError
+	switch {
+	case errors.Is(err, media.ErrUnknownProfile):
+		api.HandleRequestError(w, fmt.Errorf("%s: %w", platform, err))
+	case errors.Is(err, media.ErrNotTranscodable):
+		api.HandleRequestError(w, errors.New("only images have variants"))
+	case errors.Is(err, media.ErrInvalidFocus):
+		api.HandleRequestError(w, err)
+	case errors.As(err, &unsupported):
+		api.HandleStatusError(w, unsupported.Error(), http.StatusUnsupportedMediaType)
+	default:
+		writeMediaError(w, err)
+	}
+}
+
+// SetMediaFocus stores the focal point image crops are centered on. Body: {"x": 0.5, "y": 0.3}
+func SetMediaFocus(w http.ResponseWriter, r *http.Request) {
+	var focus media.Point
+	if err := json.NewDecoder(r.Body).Decode(&focus); err != nil {
+		api.HandleRequestError(w, err)
+		return
+	}
+
+	item, err := media.SetFocus(chi.URLParam(r, "id"), focus)
+	if errors.Is(err, media.ErrInvalidFocus) {
+		api.HandleRequestError(w, err)
+		return
+	}
+	if err != nil {
+		writeMediaError(w, err)
+		return
+	}
+	writeJSON(w, item)
+}
+
+// ProbeMedia inspects a media item's file again (dimensions, duration, codecs) and returns the updated item.
+func ProbeMedia(w http.ResponseWriter, r *http.Request) {
+	item, err := media.Reprobe(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeMediaError(w, err)
+		return
+	}
+	writeJSON(w, item)
+}
+
+// GetMediaMetadata lists the identifying metadata (location, camera, dates...) in a media item's file.
+func GetMediaMetadata(w http.ResponseWriter, r *http.Request) {
+	item, err := media.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		writeMediaError(w, err)
+		return
+	}
+	found, err := media.Metadata(r.Context(), item)
+	switch {
+	case errors.Is(err, media.ErrNoFFprobe):
+		api.HandleStatusError(w, err.Error(), http.StatusServiceUnavailable)
+	case err != nil:
+		writeMediaError(w, err)
+	default:
+		writeJSON(w, map[string]interface{}{"id": item.ID, "metadata": found})
+	}
+}
+
+// StripMedia makes (or returns the cached) copy of a media item without its metadata, "stripped" lists what was removed.
+// Publishing does this by itself unless keep_metadata is set.
+func StripMedia(w http.ResponseWriter, r *http.Request) {
+	item, err := media.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		writeMediaError(w, err)
+		return
+	}
+	clean, err := media.Clean(r.Context(), item)
+	switch {
+	case errors.Is(err, media.ErrNoFFmpeg), errors.Is(err, media.ErrNoFFprobe):
+		api.HandleStatusError(w, err.Error(), http.StatusServiceUnavailable)
+	case err != nil:
+		writeMediaError(w, err)
+	default:
+		writeJSON(w, clean)
+	}
+}
+
+// CheckMedia reports whether a media item meets the rules of each platform in ?platforms=instagram,youtube
+// and how to fix what it does not.
+func CheckMedia(w http.ResponseWriter, r *http.Request) {
+	platforms := []string{}
+	for _, p := range strings.Split(r.URL.Query().Get("platforms"), ",") {
+		if p = strings.TrimSpace(strings.ToLower(p)); p != "" {
+			platforms = append(platforms, p)
+		}
+	}
+	if len(platforms) == 0 {
+		api.HandleRequestError(w, errors.New("platforms is required, e.g. ?platforms=instagram,youtube"))
+		return
+	}
+
+	reports, err := media.CheckAll(chi.URLParam(r, "id"), platforms)
+	if err != nil {
+		writeMediaError(w, err)
+		return
+	}
+	ok := true
+	for _, report := range reports {
+		ok = ok && report.OK
+	}
+	writeJSON(w, map[string]interface{}{
+		"media_id":  chi.URLParam(r, "id"),
+		"ok":        ok,
+		"platforms": reports,
+	})
+}
+
+// ListRenditions returns the renditions made from a media item.
+func ListRenditions(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := media.Get(id); err != nil {
+		writeMediaError(w, err)
+		return
+	}
+	renditions := media.Renditions(id)
+	writeJSON(w, map[string]interface{}{
+		"renditions": renditions,
+		"count":      len(renditions),
+	})
+}
+
+// ServeMediaFile serves the presigned links handed out by the local store. S3 links go straight to the bucket instead.
+func ServeMediaFile(w http.ResponseWriter, r *http.Request) {
+	local, ok := media.Store().(*storage.LocalStore)
+	key := chi.URLParam(r, "*")
+	if !ok || !local.VerifyURL(key, r.URL.Query().Get("expires"), r.URL.Query().Get("signature")) {
+		http.Error(w, "Invalid or expired link", http.StatusForbidden)
+		return
+	}
+
+	f, err := local.Open(r.Context(), key)
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	// the local store hands back an *os.File, which supports range requests through ServeContent.
+	if seeker, ok := f.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, key, time.Time{}, seeker)
+		return
+	}
+	io.Copy(w, f)
+}
@@ -1,15 +1,24 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"net/http"
+	"slices"
+	"strings"
 	"sync"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/TanishqM1/SocialContentDistributer/api"
+	"github.com/TanishqM1/SocialContentDistributer/internal/captions"
+	"github.com/TanishqM1/SocialContentDistributer/internal/jobs"
+	"github.com/TanishqM1/SocialContentDistributer/internal/links"
+	"github.com/TanishqM1/SocialContentDistributer/internal/media"
 	"github.com/TanishqM1/SocialContentDistributer/internal/tools"
+	"github.com/go-chi/chi"
 )
 
 var wg = sync.WaitGroup{}
@@ -30,26 +39,95 @@ func PostContent(w http.ResponseWriter, r *http.Request) {
 	// We append these finished, made structs to a "our_structs" array. Then, we loop through this array & call SendAPI() on each one (which does the underlying logic like building the api too.)
 	// this is it! additional steps to add are concurrency and error logging
 
-	uploads, err := BuildUploadStructs(params)
+	// every entry of platforms is a target, with the overrides for it applied.
+	targets, err := resolveTargets(params)
+	if err != nil {
+		api.HandleRequestError(w, err)
+		return
+	}
+	if err := checkThumbnails(params, targets); err != nil {
+		api.HandleRequestError(w, err)
+		return
+	}
+	for _, t := range targets {
+		if err := checkWatermark(t); err != nil {
+			api.HandleRequestError(w, err)
+			return
+		}
+		if err := checkCover(t); err != nil {
+			api.HandleRequestError(w, err)
+			return
+		}
+	}
+
+	// check the media against every platform's rules before anything is sent.
+	if checks, ok := preflight(targets); !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": false,
+			"message": "Media does not meet the requirements of every platform",
+			"checks":  checks,
+		})
+		return
+	}
+
+	// the post holds a reference on the media it uses, so it is not garbage collected from under it. the jobs
+	// package gives it back once every target has finished.
+	mediaIDs := referencedMedia(targets)
+	if err := media.Retain(mediaIDs...); err != nil {
+		writeMediaError(w, err)
+		return
+	}
+
+	// every submission gets a post id, each target's result is tracked against it.
+	post := jobs.Create(params.Platforms, mediaIDs)
+	sending := []target{}
+	for i := range targets {
+		t := &targets[i]
+		// short links point back at the post, so they are made once it has an id. a short link can be longer
+		// than the link it replaces, so the limits are checked again afterwards.
+		if !t.Params.KeepLinks {
+			if err := links.ShortenLinks(post.ID, t.Name, t.Platform, linkFields(&t.Params), textFieldList(&t.Params)); err != nil {
+				log.Error(err)
+			}
+			if err := refit(t); err != nil {
+				jobs.Fail(post.ID, t.Name, err)
+				continue
+			}
+		}
+		jobs.TextChanged(post.ID, t.Name, t.Changes)
+		sending = append(sending, *t)
+	}
+
+	uploads, err := BuildUploadStructs(sending)
 	if err != nil {
 		log.Error(err)
+		for _, t := range sending {
+			jobs.Fail(post.ID, t.Name, err)
+		}
 		api.HandleInternalError(w)
 		return
 	}
+
 	// no we have an "uploads" folder with struct objects. We need to call SendAPI() on all of these struct objects.
 	for _, v := range uploads {
 		wg.Add(1)
-		go tools.SendAPI(v, &wg)
+		go tools.SendAPI(v, post.ID, &wg)
 	}
 	wg.Wait()
 	fmt.Printf("\n All Completed!")
 	// once all the api uploads are done (running concurrently), we can send the success response back to the frontend.
+	// async platforms (instagram, pinterest) will still be "processing" here, the frontend can poll /post/status/{id}.
+	post, _ = jobs.Get(post.ID)
 
 	// Send success response back to frontend
 	response := map[string]interface{}{
 		"success":   true,
 		"message":   "Content uploaded successfully",
 		"platforms": params.Platforms,
+		"post_id":   post.ID,
+		"results":   post.Results,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -57,50 +135,426 @@ func PostContent(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func BuildUploadStructs(params api.TotalFields) ([]tools.UploadContent, error) {
+// target is one destination of a submission: a platform, optionally a specific account on it,
+// with the submission's fields after that target's overrides are applied.
+type target struct {
+	Name     string // as given in platforms, e.g. "reddit" or "instagram:brand2"
+	Platform string
+	Account  string
+	Params   api.TotalFields
+	Changes  []captions.Change // text shortened to fit the platform's limits
+}
+
+// fields an override cannot change, they describe the submission rather than what is posted.
+var fixedFields = []string{"platforms", "overrides"}
+
+// platforms a target can post to, one per case of BuildUploadStructs.
+var supportedPlatforms = []string{"youtube", "instagram", "pinterest", "reddit", "linkedin"}
+
+// resolveTargets works out every target of a submission and its fields. the overrides are merged here, first,
+// rather than when the uploaders are built: templates, markdown, tags, UTM tagging, the text limits and the media
+// checks all have to see the fields each target really posts. BuildUploadStructs only copies the merged fields of
+// every target into its platform's uploader.
+func resolveTargets(params api.TotalFields) ([]target, error) {
+	targets := []target{}
+	known := map[string]bool{}
+	for _, name := range params.Platforms {
+		platform, account := api.SplitTarget(name)
+		if !slices.Contains(supportedPlatforms, platform) {
+			return nil, fmt.Errorf("%s is not a supported platform, use one of %s", platform, strings.Join(supportedPlatforms, ", "))
+		}
+		if known[name] {
+			return nil, fmt.Errorf("%s is listed twice in platforms", name)
+		}
+		known[name], known[platform] = true, true
+
+		merged, err := applyOverrides(params, platform, name)
+		if err != nil {
+			return nil, err
+		}
+		if err := applyTemplates(&merged, platform); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if err := applyFormat(&merged, platform); err != nil {
+			return nil, err
+		}
+		if err := applyTags(&merged, platform); err != nil {
+			return nil, err
+		}
+		applyUTM(&merged, platform)
+		// the limits are checked last, on the text that is actually sent.
+		if merged.TextOverflow != "" && merged.TextOverflow != captions.OverflowReject && merged.TextOverflow != captions.OverflowTruncate {
+			return nil, fmt.Errorf("text_overflow must be %q or %q", captions.OverflowReject, captions.OverflowTruncate)
+		}
+		changes, err := captions.Fit(platform, textFields(&merged), merged.TextOverflow == captions.OverflowTruncate)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target{Name: name, Platform: platform, Account: account, Params: merged, Changes: changes})
+	}
+	for key := range params.Overrides {
+		if !known[key] {
+			return nil, fmt.Errorf("overrides for %s, which is not in platforms", key)
+		}
+	}
+	return targets, nil
+}
+
+// refit checks a target's text against its platform's limits again, after its links were shortened. the
+// changes already recorded get the text as it is now, and a field cut again keeps the length it had at first.
+func refit(t *target) error {
+	fields := textFields(&t.Params)
+	changes, err := captions.Fit(t.Platform, fields, t.Params.TextOverflow == captions.OverflowTruncate)
+	if err != nil {
+		return err
+	}
+	for i := range t.Changes {
+		t.Changes[i].Text = *fields[t.Changes[i].Field]
+	}
+	for _, c := range changes {
+		i := slices.IndexFunc(t.Changes, func(old captions.Change) bool { return old.Field == c.Field })
+		if i < 0 {
+			t.Changes = append(t.Changes, c)
+			continue
+		}
+		t.Changes[i].Text = c.Text
+	}
+	return nil
+}
+
+// applyOverrides returns params with the overrides for platform, then for the target name, applied.
+// only the fields an override sets are replaced, and maps (thumbnails, watermarks) are merged key by key.
+func applyOverrides(params api.TotalFields, platform string, name string) (api.TotalFields, error) {
+	merged := params
+	merged.Thumbnails = maps.Clone(params.Thumbnails)
+	merged.Watermarks = maps.Clone(params.Watermarks)
+	merged.Templates = maps.Clone(params.Templates)
+	merged.Variables = maps.Clone(params.Variables)
+	merged.Overrides = nil
+
+	keys := []string{platform}
+	if name != platform {
+		keys = append(keys, name)
+	}
+	for _, key := range keys {
+		raw, ok := params.Overrides[key]
+		if !ok {
+			continue
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return api.TotalFields{}, fmt.Errorf("overrides for %s: %w", key, err)
+		}
+		for _, f := range fixedFields {
+			if _, ok := fields[f]; ok {
+				return api.TotalFields{}, fmt.Errorf("overrides for %s cannot change %s", key, f)
+			}
+		}
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&merged); err != nil {
+			return api.TotalFields{}, fmt.Errorf("overrides for %s: %w", key, err)
+		}
+	}
+	return merged, nil
+}
+
+// textFields are the text fields of a post, by json name.
+func textFields(params *api.TotalFields) map[string]*string {
+	return map[string]*string{
+		"title":         &params.Title,
+		"description":   &params.Description,
+		"caption":       &params.Caption,
+		"text":          &params.Text,
+		"text_linkedin": &params.TextLinkedIn,
+	}
+}
+
+// applyTemplates renders the caption templates (internal/captions) of a target into its text fields.
+func applyTemplates(params *api.TotalFields, platform string) error {
+	fields := textFields(params)
+	for field, name := range params.Templates {
+		dst, ok := fields[field]
+		if !ok {
+			return fmt.Errorf("templates: %s is not a text field", field)
+		}
+		text, err := captions.Render(name, platform, params.Variables)
+		if err != nil {
+			return fmt.Errorf("templates: %s (%q): %w", field, name, err)
+		}
+		*dst = text
+	}
+	return nil
+}
+
+// applyFormat converts a target's body text from the format it was written in to what its platform shows.
+func applyFormat(params *api.TotalFields, platform string) error {
+	switch params.Format {
+	case "", captions.FormatPlain:
+		return nil
+	case captions.FormatMarkdown:
+		fields := textFields(params)
+		for _, name := range captions.MarkdownFields {
+			*fields[name] = captions.FromMarkdown(platform, *fields[name])
+		}
+		return nil
+	}
+	return fmt.Errorf("format must be %q or %q", captions.FormatPlain, captions.FormatMarkdown)
+}
+
+// applyTags adds a target's tags (and hashtag sets) to it the way its platform takes them: the keywords replace
+// tags, hashtags go at the end of the text.
+func applyTags(params *api.TotalFields, platform string) error {
+	tags, err := captions.ResolveTags(params.Tags, params.HashtagSets)
+	if err != nil {
+		return fmt.Errorf("hashtag_sets: %w", err)
+	}
+	params.Tags = captions.RenderTags(platform, tags, textFields(params))
+	return nil
+}
+
+// linkFields are the fields of a post that hold a single link.
+func linkFields(params *api.TotalFields) []*string {
+	return []*string{&params.Link, &params.URL}
+}
+
+// textFieldList is textFields as a list, for the functions that treat every text field alike.
+func textFieldList(params *api.TotalFields) []*string {
+	list := []*string{}
+	for _, field := range textFields(params) {
+		list = append(list, field)
+	}
+	return list
+}
+
+// applyUTM tags the links a target sends out with UTM parameters for its platform.
+func applyUTM(params *api.TotalFields, platform string) {
+	links.TagLinks(platform, params.UTMCampaign, linkFields(params), textFieldList(params))
+}
+
+// referencedMedia returns the ids of the library items a submission points at.
+func referencedMedia(targets []target) []string {
+	ids := []string{}
+	seen := map[string]bool{}
+	for _, t := range targets {
+		params := t.Params
+		refs := []string{mediaRef(params, params.MediaFile), mediaRef(params, params.ImageURL), params.MediaPath, params.CoverImage}
+		for _, ref := range params.Thumbnails {
+			refs = append(refs, ref)
+		}
+		for _, ref := range refs {
+			if ref == "" {
+				continue
+			}
+			// anything that is not a media id (linkedin urns, old file paths) is simply not ours to hold.
+			item, err := media.Resolve(ref)
+			if err != nil || seen[item.ID] {
+				continue
+			}
+			seen[item.ID] = true
+			ids = append(ids, item.ID)
+		}
+	}
+	return ids
+}
+
+// targetMedia returns the media reference a target uploads, "" if its platform takes no file.
+func targetMedia(t target) string {
+	switch t.Platform {
+	case "youtube":
+		return mediaRef(t.Params, t.Params.MediaFile)
+	case "instagram", "pinterest":
+		return mediaRef(t.Params, t.Params.ImageURL)
+	}
+	return ""
+}
+
+// preflight runs the compliance checker (internal/media/compliance.go) for every target that uploads media.
+// ok is false if any target has a problem the media pipeline cannot fix on its own.
+// unknown media is left for SendAPI to report, per target.
+func preflight(targets []target) (map[string]media.Report, bool) {
+	checks := map[string]media.Report{}
+	ok := true
+	for _, t := range targets {
+		ref := targetMedia(t)
+		if ref == "" {
+			continue
+		}
+		item, err := media.Resolve(ref)
+		if err != nil {
+			continue
+		}
+		// audio sent with a cover is published as a video.
+		if t.Params.CoverImage != "" {
+			item = media.AsVideo(item)
+		}
+		report := media.Check(item, t.Platform)
+		checks[t.Name] = report
+		ok = ok && report.OK
+	}
+	return checks, ok
+}
+
+// platforms whose uploader can set a custom thumbnail.
+var thumbnailPlatforms = map[string]bool{"youtube": true, "pinterest": true}
+
+// checkThumbnails makes sure every thumbnail in the submission is for a platform that is posted to and takes one,
+// and that the thumbnail each target uses is an image.
+func checkThumbnails(params api.TotalFields, targets []target) error {
+	for platform := range params.Thumbnails {
+		if !thumbnailPlatforms[platform] {
+			return fmt.Errorf("%s does not take a custom thumbnail", platform)
+		}
+		if !slices.ContainsFunc(targets, func(t target) bool { return t.Platform == platform }) {
+			return fmt.Errorf("thumbnail given for %s, which is not in platforms", platform)
+		}
+	}
+	for _, t := range targets {
+		ref, ok := t.Params.Thumbnails[t.Platform]
+		if !ok {
+			continue
+		}
+		if !thumbnailPlatforms[t.Platform] {
+			return fmt.Errorf("%s does not take a custom thumbnail", t.Platform)
+		}
+		item, err := media.Resolve(ref)
+		if err != nil {
+			return fmt.Errorf("thumbnail for %s: %w", t.Name, err)
+		}
+		if item.Kind != "image" {
+			return fmt.Errorf("thumbnail for %s must be an image, got %s", t.Name, item.Kind)
+		}
+	}
+	return nil
+}
+
+// checkCover makes sure the cover audio is rendered over is an image.
+func checkCover(t target) error {
+	if t.Params.CoverImage == "" {
+		return nil
+	}
+	item, err := media.Resolve(t.Params.CoverImage)
+	if err != nil {
+		return fmt.Errorf("cover_image for %s: %w", t.Name, err)
+	}
+	if item.Kind != "image" {
+		return fmt.Errorf("cover_image for %s must be an image, got %s", t.Name, item.Kind)
+	}
+	return nil
+}
+
+// watermarkFor returns the watermark profile to use for platform, "" for none.
+func watermarkFor(params api.TotalFields, platform string) string {
+	name, ok := params.Watermarks[platform]
+	if !ok {
+		name = params.Watermark
+	}
+	if name == "none" {
+		return ""
+	}
+	return name
+}
+
+// checkWatermark makes sure the watermark profile a target asks for exists.
+func checkWatermark(t target) error {
+	if name := watermarkFor(t.Params, t.Platform); name != "" {
+		if _, err := media.GetWatermark(name); err != nil {
+			return fmt.Errorf("%s: %q", err, name)
+		}
+	}
+	return nil
+}
+
+// mediaRef picks the media a platform uploads: media_id if the request has one, otherwise the platform's own field.
+// either way it has to be a media id, SendAPI never opens a path the client sent.
+func mediaRef(params api.TotalFields, field string) string {
+	if params.MediaID != "" {
+		return params.MediaID
+	}
+	return field
+}
+
+// GetPostStatus returns the per-platform results of a post.
+func GetPostStatus(w http.ResponseWriter, r *http.Request) {
+	post, ok := jobs.Get(chi.URLParam(r, "id"))
+	if !ok {
+		api.HandleNotFoundError(w, "post not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(post)
+}
+
+// BuildUploadStructs makes the uploader of every target. the target's fields already have its overrides merged in
+// (see resolveTargets).
+func BuildUploadStructs(targets []target) ([]tools.UploadContent, error) {
 	var uploads []tools.UploadContent
 
-	for _, p := range params.Platforms {
-		switch p {
+	for _, t := range targets {
+		params := t.Params
+		switch t.Platform {
 		case "youtube":
 			fmt.Println("Building Youtube Struct!")
 			uploads = append(uploads, tools.YouTubeUploader{
 				AccessToken:   "123",
 				PlatformName:  "youtube",
+				Target:        t.Name,
+				Account:       t.Account,
 				Title:         params.Title,
 				Description:   params.Description,
 				Tags:          params.Tags,
 				CategoryID:    params.CategoryID,
 				PrivacyStatus: params.PrivacyStatus,
-				MediaFile:     params.MediaFile,
+				MediaFile:     mediaRef(params, params.MediaFile),
+				KeepMetadata:  params.KeepMetadata,
+				Thumbnail:     params.Thumbnails["youtube"],
+				Watermark:     watermarkFor(params, "youtube"),
+				CoverImage:    params.CoverImage,
+				Waveform:      params.Waveform,
 			})
 
 		case "instagram":
 			uploads = append(uploads, tools.InstagramUploader{
 				AccessToken:  "123",
 				PlatformName: "instagram",
-				ImageURL:     params.ImageURL,
+				Target:       t.Name,
+				Account:      t.Account,
+				ImageURL:     mediaRef(params, params.ImageURL),
 				Caption:      params.Caption,
 				LocationID:   params.LocationID,
 				UserTags:     params.UserTags,
+				KeepMetadata: params.KeepMetadata,
+				Watermark:    watermarkFor(params, "instagram"),
+				CoverImage:   params.CoverImage,
+				Waveform:     params.Waveform,
 			})
 
 		case "pinterest":
 			uploads = append(uploads, tools.PinterestUploader{
 				AccessToken:  "123",
 				PlatformName: "pinterest",
+				Target:       t.Name,
+				Account:      t.Account,
 				BoardID:      params.BoardID,
 				Title:        params.Title,
 				Description:  params.Description,
 				Link:         params.Link,
 				SourceType:   params.SourceType,
-				ImageURL:     params.ImageURL,
+				ImageURL:     mediaRef(params, params.ImageURL),
+				KeepMetadata: params.KeepMetadata,
+				Thumbnail:    params.Thumbnails["pinterest"],
+				Watermark:    watermarkFor(params, "pinterest"),
+				CoverImage:   params.CoverImage,
+				Waveform:     params.Waveform,
 			})
 
 		case "reddit":
 			uploads = append(uploads, tools.RedditUploader{
 				AccessToken:  "123",
 				PlatformName: "reddit",
+				Target:       t.Name,
+				Account:      t.Account,
 				Subreddit:    params.Subreddit,
 				PostType:     params.PostType,
 				Title:        params.Title,
@@ -114,6 +568,8 @@ func BuildUploadStructs(params api.TotalFields) ([]tools.UploadContent, error) {
 			uploads = append(uploads, tools.LinkedInUploader{
 				AccessToken:    "123",
 				PlatformName:   "linkedin",
+				Target:         t.Name,
+				Account:        t.Account,
 				Author:         params.Author,
 				LifecycleState: params.LifecycleState,
 				Text:           params.TextLinkedIn,
@@ -122,6 +578,9 @@ func BuildUploadStructs(params api.TotalFields) ([]tools.UploadContent, error) {
 				MediaPath:      params.MediaPath,
 				Visibility:     params.Visibility,
 			})
+		default:
+			// resolveTargets only lets supportedPlatforms through, so this is a platform added there but not here.
+			return nil, fmt.Errorf("no uploader for %s", t.Platform)
 		}
 	}
 
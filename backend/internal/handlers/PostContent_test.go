@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/TanishqM1/SocialContentDistributer/api"
+	"github.com/TanishqM1/SocialContentDistributer/internal/captions"
+	"github.com/TanishqM1/SocialContentDistributer/internal/links"
+)
+
+func overrides(t *testing.T, raw string) map[string]json.RawMessage {
+	t.Helper()
+	var o map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &o); err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func TestApplyOverrides(t *testing.T) {
+	params := api.TotalFields{
+		Platforms:  []string{"instagram", "instagram:brand2", "reddit"},
+		Title:      "Shared title",
+		Caption:    "Shared caption",
+		NSFW:       false,
+		Thumbnails: map[string]string{"youtube": "thumb1", "pinterest": "thumb2"},
+		Variables:  map[string]interface{}{"Number": 1},
+		Overrides: overrides(t, `{
+			"instagram": {"caption": "Insta caption", "thumbnails": {"pinterest": "thumb3"}, "variables": {"Title": "x"}},
+			"instagram:brand2": {"caption": "Brand caption", "keep_metadata": true},
+			"reddit": {"title": "Longer reddit title", "nsfw": true}
+		}`),
+	}
+
+	cases := []struct {
+		platform, name string
+		check          func(t *testing.T, got api.TotalFields)
+	}{
+		{"instagram", "instagram", func(t *testing.T, got api.TotalFields) {
+			if got.Caption != "Insta caption" || got.Title != "Shared title" {
+				t.Errorf("caption %q title %q", got.Caption, got.Title)
+			}
+			// maps are merged key by key.
+			if got.Thumbnails["youtube"] != "thumb1" || got.Thumbnails["pinterest"] != "thumb3" {
+				t.Errorf("thumbnails %v", got.Thumbnails)
+			}
+			if got.Variables["Number"] != 1 || got.Variables["Title"] != "x" {
+				t.Errorf("variables %v", got.Variables)
+			}
+		}},
+		{"instagram", "instagram:brand2", func(t *testing.T, got api.TotalFields) {
+			// the account's override goes on top of the platform's.
+			if got.Caption != "Brand caption" || !got.KeepMetadata || got.Thumbnails["pinterest"] != "thumb3" {
+				t.Errorf("caption %q keep_metadata %v thumbnails %v", got.Caption, got.KeepMetadata, got.Thumbnails)
+			}
+		}},
+		{"reddit", "reddit", func(t *testing.T, got api.TotalFields) {
+			if got.Title != "Longer reddit title" || !got.NSFW || got.Caption != "Shared caption" {
+				t.Errorf("title %q nsfw %v caption %q", got.Title, got.NSFW, got.Caption)
+			}
+			if got.Thumbnails["pinterest"] != "thumb2" {
+				t.Errorf("another platform's override leaked: %v", got.Thumbnails)
+			}
+		}},
+		{"pinterest", "pinterest", func(t *testing.T, got api.TotalFields) {
+			if got.Title != "Shared title" || got.Caption != "Shared caption" {
+				t.Errorf("a target without overrides changed: %q %q", got.Title, got.Caption)
+			}
+		}},
+	}
+	for _, c := range cases {
+		got, err := applyOverrides(params, c.platform, c.name)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got.Overrides != nil {
+			t.Errorf("%s: overrides kept on the merged fields", c.name)
+		}
+		c.check(t, got)
+	}
+
+	// the submission itself is never changed.
+	if params.Thumbnails["pinterest"] != "thumb2" || len(params.Variables) != 1 || params.Caption != "Shared caption" {
+		t.Errorf("params changed: %v %v %q", params.Thumbnails, params.Variables, params.Caption)
+	}
+}
+
+func TestApplyOverridesErrors(t *testing.T) {
+	cases := map[string]string{
+		`{"reddit": {"platforms": ["youtube"]}}`:  "cannot change platforms",
+		`{"reddit": {"overrides": {}}}`:           "cannot change overrides",
+		`{"reddit": {"titel": "typo"}}`:           "unknown field",
+		`{"reddit": {"title": 12}}`:               "cannot unmarshal",
+		`{"reddit": ["title"]}`:                   "overrides for reddit",
+		`{"reddit:alt": {"subreddit": {"a": 1}}}`: "overrides for reddit:alt",
+	}
+	for raw, want := range cases {
+		params := api.TotalFields{Overrides: overrides(t, raw)}
+		_, err := applyOverrides(params, "reddit", "reddit:alt")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: error %v, want %q", raw, err, want)
+		}
+	}
+}
+
+func TestResolveTargetsRejects(t *testing.T) {
+	cases := []struct {
+		params api.TotalFields
+		want   string
+	}{
+		{api.TotalFields{Platforms: []string{"tiktok"}}, "tiktok is not a supported platform"},
+		{api.TotalFields{Platforms: []string{"tiktok:brand"}}, "tiktok is not a supported platform"},
+		{api.TotalFields{Platforms: []string{"reddit", "reddit"}}, "listed twice"},
+		{api.TotalFields{Platforms: []string{"reddit"}, Overrides: overrides(t, `{"youtube": {"title": "x"}}`)}, "not in platforms"},
+	}
+	for _, c := range cases {
+		_, err := resolveTargets(c.params)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%v: error %v, want %q", c.params.Platforms, err, c.want)
+		}
+	}
+
+	targets, err := resolveTargets(api.TotalFields{
+		Platforms: []string{"reddit", "instagram:brand2"},
+		Title:     "t",
+		Overrides: overrides(t, `{"instagram": {"caption": "c"}}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 2 || targets[1].Platform != "instagram" || targets[1].Account != "brand2" || targets[1].Params.Caption != "c" {
+		t.Errorf("targets %+v", targets)
+	}
+}
+
+func TestRefitAfterShortening(t *testing.T) {
+	t.Setenv("DataDir", t.TempDir())
+	t.Setenv("ShortLinkURL", "https://go.example.com")
+
+	// a 95 character title fits pinterest's 100, until its 14 character link becomes a 30 character one.
+	shortened := func(overflow string) *target {
+		title := strings.Repeat("a", 80) + " https://x.co/a"
+		description := "cut before https://x.co/b…"
+		tg := &target{Name: "pinterest", Platform: "pinterest", Params: api.TotalFields{Title: title, Description: description, TextOverflow: overflow}}
+		tg.Changes = []captions.Change{{Field: "description", Limit: 500, Count: captions.CountGraphemes, Length: 600, Text: description}}
+		if err := links.ShortenLinks("post", tg.Name, tg.Platform, linkFields(&tg.Params), textFieldList(&tg.Params)); err != nil {
+			t.Fatal(err)
+		}
+		return tg
+	}
+
+	if err := refit(shortened(captions.OverflowReject)); err == nil {
+		t.Error("a title over the limit after shortening was accepted")
+	}
+
+	tg := shortened(captions.OverflowTruncate)
+	if err := refit(tg); err != nil {
+		t.Fatal(err)
+	}
+	if n := captions.Length(tg.Params.Title, captions.CountGraphemes); n > 100 {
+		t.Errorf("title is %d long: %q", n, tg.Params.Title)
+	}
+	if len(tg.Changes) != 2 {
+		t.Fatalf("changes: %+v", tg.Changes)
+	}
+	if c := tg.Changes[0]; c.Field != "description" || c.Length != 600 || c.Text != tg.Params.Description || !strings.Contains(c.Text, "https://go.example.com/") {
+		t.Errorf("earlier change does not show the shortened text: %+v", c)
+	}
+	if c := tg.Changes[1]; c.Field != "title" || c.Length != 111 || c.Text != tg.Params.Title {
+		t.Errorf("title change: %+v", c)
+	}
+}
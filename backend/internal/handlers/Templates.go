@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/TanishqM1/SocialContentDistributer/api"
+	"github.com/TanishqM1/SocialContentDistributer/internal/captions"
+)
+
+// in this file, I handle the caption templates (internal/captions) a post can fill its text fields from with "templates".
+
+type templateRenderRequest struct {
+	Platform  string                 `json:"platform"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// writeTemplateError sends a 404 for unknown templates, a 400 for broken ones and logs anything else as internal.
+func writeTemplateError(w http.ResponseWriter, err error) {
+	var invalid *captions.InvalidTemplateError
+	switch {
+	case errors.Is(err, captions.ErrTemplateNotFound):
+		api.HandleNotFoundError(w, err.Error())
+	case errors.As(err, &invalid):
+		api.HandleRequestError(w, err)
+	default:
+		log.Error(err)
+		api.HandleInternalError(w)
+	}
+}
+
+// ListTemplates returns every caption template.
+func ListTemplates(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, captions.ListTemplates())
+}
+
+// GetTemplate returns one template.
+func GetTemplate(w http.ResponseWriter, r *http.Request) {
+	t, err := captions.GetTemplate(chi.URLParam(r, "name"))
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	writeJSON(w, t)
+}
+
+// SaveTemplate creates or replaces the template named in the url.
+// Body: {"body": "Episode {{.Number}}: {{.Title}} {{hashtags .Tags}}"}
+func SaveTemplate(w http.ResponseWriter, r *http.Request) {
+	var t captions.Template
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		api.HandleRequestError(w, err)
+		return
+	}
+	t.Name = chi.URLParam(r, "name")
+
+	saved, err := captions.SaveTemplate(t)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	writeJSON(w, saved)
+}
+
+// DeleteTemplate removes a template.
+func DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	if err := captions.DeleteTemplate(chi.URLParam(r, "name")); err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RenderTemplate previews a template for a platform.
+// Body: {"platform": "instagram", "variables": {"Number": 12, "Title": "..."}}
+func RenderTemplate(w http.ResponseWriter, r *http.Request) {
+	var body templateRenderRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		api.HandleRequestError(w, err)
+		return
+	}
+
+	text, err := captions.Render(chi.URLParam(r, "name"), body.Platform, body.Variables)
+	if err != nil {
+		writeTemplateError(w, err)
+		return
+	}
+	writeJSON(w, map[string]string{"platform": body.Platform, "text": text})
+}
@@ -0,0 +1,410 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TanishqM1/SocialContentDistributer/internal/media"
+	"github.com/TanishqM1/SocialContentDistributer/internal/store"
+	"github.com/go-chi/chi"
+)
+
+// resumable uploads, following the tus 1.0.0 protocol (core + creation + termination): https://tus.io/protocols/resumable-upload
+//
+//	POST   /upload/tus       create an upload (Upload-Length, Upload-Metadata: filename <base64>)
+//	HEAD   /upload/tus/{id}  how many bytes the server has (Upload-Offset), so the client knows where to resume
+//	PATCH  /upload/tus/{id}  append a chunk at Upload-Offset
+//	DELETE /upload/tus/{id}  abandon an upload
+//	GET    /upload/tus/{id}  the same json as POST /upload/file, once the upload is finished
+//
+// chunks are appended to uploads/tus/<id>.part. when the last byte arrives the file is copied into the media store
+// through media.Save (which checks it like a normal upload), the file is registered in the media library, the .part
+// file is removed, and the final PATCH answers with the same json body as UploadFile. uploads no chunk arrived for
+// in tusExpiry are removed by ExpireTusUploads, finished or not.
+
+const tusVersion = "1.0.0"
+
+// tusExpiry is how long an upload is kept after its last chunk.
+const tusExpiry = 24 * time.Hour
+
+// tusUpload is the state of one resumable upload, saved next to its .part file.
+type tusUpload struct {
+	ID        string                 `json:"id"`
+	Length    int64                  `json:"length"`
+	Offset    int64                  `json:"offset"`
+	Filename  string                 `json:"filename"`
+	CreatedAt time.Time              `json:"created_at"`
+	Result    map[string]interface{} `json:"result,omitempty"` // set once finished
+}
+
+// tusLockEntry is the lock of one upload and how many requests hold it or wait for it.
+type tusLockEntry struct {
+	mu    sync.Mutex
+	users int
+}
+
+var (
+	tusLocksMu sync.Mutex
+	tusLocks   = map[string]*tusLockEntry{}
+)
+
+// lockTus serialises requests for the same upload, a client retrying a PATCH must not race the one still running.
+// it returns the unlock function. the entry is removed once no request uses it, so finished, deleted and abandoned
+// uploads (and ids that were never ours) don't keep one forever.
+func lockTus(id string) func() {
+	tusLocksMu.Lock()
+	l, ok := tusLocks[id]
+	if !ok {
+		l = &tusLockEntry{}
+		tusLocks[id] = l
+	}
+	l.users++
+	tusLocksMu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		tusLocksMu.Lock()
+		defer tusLocksMu.Unlock()
+		if l.users--; l.users == 0 {
+			delete(tusLocks, id)
+		}
+	}
+}
+
+func tusDir() string {
+	return store.Path("tus")
+}
+
+func tusInfoPath(id string) string {
+	return filepath.Join(tusDir(), id+".json")
+}
+
+func tusPartPath(id string) string {
+	return filepath.Join(tusDir(), id+".part")
+}
+
+func loadTusUpload(id string) (*tusUpload, bool) {
+	// ids are hex, anything else cannot be one of ours (and must not reach the filesystem).
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return nil, false
+	}
+	u := &tusUpload{}
+	if err := store.Load(tusInfoPath(id), u); err != nil || u.ID == "" {
+		return nil, false
+	}
+	return u, true
+}
+
+// parseTusMetadata decodes "key base64value,key2 base64value2".
+func parseTusMetadata(header string) map[string]string {
+	meta := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 {
+			continue
+		}
+		value := ""
+		if len(fields) > 1 {
+			if decoded, err := base64.StdEncoding.DecodeString(fields[1]); err == nil {
+				value = string(decoded)
+			}
+		}
+		meta[fields[0]] = value
+	}
+	return meta
+}
+
+// TusOptions advertises what the tus endpoint supports.
+func TusOptions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", "creation,termination")
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(media.MaxUploadSize(), 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TusCreate starts a new resumable upload.
+func TusCreate(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		http.Error(w, "Upload-Length is required", http.StatusBadRequest)
+		return
+	}
+	if length > media.MaxUploadSize() {
+		http.Error(w, fmt.Sprintf("File too large (limit is %d MB)", media.MaxUploadSize()>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	meta := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	filename := meta["filename"]
+	if filename == "" {
+		filename = meta["name"]
+	}
+
+	b := make([]byte, 16)
+	rand.Read(b)
+	u := &tusUpload{
+		ID:        hex.EncodeToString(b),
+		Length:    length,
+		Filename:  filename,
+		CreatedAt: time.Now(),
+	}
+
+	if err := os.MkdirAll(tusDir(), 0755); err != nil {
+		log.Printf("Error creating tus directory: %v", err)
+		http.Error(w, "Unable to create upload", http.StatusInternalServerError)
+		return
+	}
+	part, err := os.Create(tusPartPath(u.ID))
+	if err != nil {
+		log.Printf("Error creating tus upload: %v", err)
+		http.Error(w, "Unable to create upload", http.StatusInternalServerError)
+		return
+	}
+	part.Close()
+	if err := store.Save(tusInfoPath(u.ID), u); err != nil {
+		log.Printf("Error saving tus upload: %v", err)
+		http.Error(w, "Unable to create upload", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+u.ID)
+	w.Header().Set("Upload-Offset", "0")
+	w.WriteHeader(http.StatusCreated)
+}
+
+// TusHead reports how much of an upload the server has, so the client can resume from there.
+func TusHead(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Cache-Control", "no-store")
+
+	id := chi.URLParam(r, "id")
+	defer lockTus(id)()
+
+	u, ok := loadTusUpload(id)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.Length, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+// TusStatus returns the upload response once the upload has finished.
+func TusStatus(w http.ResponseWriter, r *http.Request) {
+	u, ok := loadTusUpload(chi.URLParam(r, "id"))
+	if !ok {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+	if u.Result == nil {
+		http.Error(w, fmt.Sprintf("Upload incomplete (%d of %d bytes)", u.Offset, u.Length), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u.Result)
+}
+
+// TusPatch appends a chunk to an upload. A chunk cut off halfway is kept, the client resumes from the new offset.
+func TusPatch(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		http.Error(w, "Content-Type must be application/offset+octet-stream", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	defer lockTus(id)()
+
+	u, ok := loadTusUpload(id)
+	if !ok {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+	if u.Result != nil {
+		// already finished, a retry of the last chunk (sent with the offset it had before).
+		w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(u.Result)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset != u.Offset {
+		http.Error(w, fmt.Sprintf("Upload-Offset must be %d", u.Offset), http.StatusConflict)
+		return
+	}
+
+	part, err := os.OpenFile(tusPartPath(u.ID), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Printf("Error opening tus upload: %v", err)
+		http.Error(w, "Unable to write chunk", http.StatusInternalServerError)
+		return
+	}
+	n, copyErr := io.Copy(part, io.LimitReader(r.Body, u.Length-u.Offset))
+	part.Close()
+
+	// keep whatever arrived, even if the connection dropped.
+	u.Offset += n
+	if err := store.Save(tusInfoPath(u.ID), u); err != nil {
+		log.Printf("Error saving tus upload: %v", err)
+		http.Error(w, "Unable to write chunk", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+
+	if copyErr != nil {
+		log.Printf("tus upload %s interrupted at %d bytes: %v", u.ID, u.Offset, copyErr)
+		http.Error(w, "Chunk interrupted, resume from Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	if u.Offset < u.Length {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// last chunk: copy the file into the media store like a normal upload.
+	result, err := finishTusUpload(u)
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func finishTusUpload(u *tusUpload) (map[string]interface{}, error) {
+	filePath, err := media.StagingPath()
+	if err != nil {
+		return nil, err
+	}
+
+	part, err := os.Open(tusPartPath(u.ID))
+	if err != nil {
+		return nil, err
+	}
+	saved, err := media.Save(part, filePath)
+	part.Close()
+	if err != nil {
+		// the upload can never succeed (e.g. over the limit for its type), drop it.
+		os.Remove(tusPartPath(u.ID))
+		os.Remove(tusInfoPath(u.ID))
+		return nil, err
+	}
+
+	// the .part file stays until the result is saved, so a retried PATCH (at Upload-Offset, which is the length
+	// by now) can finish the upload if adding it failed.
+	item, duplicate, err := media.Add(saved, u.Filename)
+	if err != nil {
+		os.Remove(saved.Path)
+		return nil, err
+	}
+	u.Result = uploadResponse(item, duplicate)
+	if err := store.Save(tusInfoPath(u.ID), u); err != nil {
+		return nil, err
+	}
+	os.Remove(tusPartPath(u.ID))
+	return u.Result, nil
+}
+
+// TusDelete abandons an upload and removes its data.
+func TusDelete(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	id := chi.URLParam(r, "id")
+	defer lockTus(id)()
+
+	u, ok := loadTusUpload(id)
+	if !ok {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+	if err := os.Remove(tusPartPath(u.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Error removing tus upload: %v", err)
+	}
+	os.Remove(tusInfoPath(u.ID))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExpireTusUploads removes the uploads no chunk arrived for in tusExpiry, whether they were abandoned halfway or
+// finished long ago. it returns what was removed (as "tus/<file>") and how many bytes that freed.
+func ExpireTusUploads() ([]string, int64, error) {
+	entries, err := os.ReadDir(tusDir())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := map[string]bool{}
+	for _, e := range entries {
+		id := strings.TrimSuffix(strings.TrimSuffix(e.Name(), ".json"), ".part")
+		if _, err := hex.DecodeString(id); err == nil && id != "" {
+			ids[id] = true
+		}
+	}
+
+	removed := []string{}
+	var freed int64
+	for id := range ids {
+		unlock := lockTus(id)
+		files, size, err := expireTusUpload(id)
+		unlock()
+		if err != nil {
+			return removed, freed, err
+		}
+		removed = append(removed, files...)
+		freed += size
+	}
+	return removed, freed, nil
+}
+
+// expireTusUpload removes the files of one upload if neither was written for tusExpiry. call it with the upload locked.
+func expireTusUpload(id string) ([]string, int64, error) {
+	paths := []string{tusInfoPath(id), tusPartPath(id)}
+	infos := []os.FileInfo{}
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if time.Since(info.ModTime()) < tusExpiry {
+			return nil, 0, nil
+		}
+		infos = append(infos, info)
+	}
+
+	removed := []string{}
+	var freed int64
+	for _, info := range infos {
+		if err := os.Remove(filepath.Join(tusDir(), info.Name())); err != nil {
+			return removed, freed, err
+		}
+		removed = append(removed, "tus/"+info.Name())
+		freed += info.Size()
+	}
+	return removed, freed, nil
+}
@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/TanishqM1/SocialContentDistributer/internal/media"
+	"github.com/TanishqM1/SocialContentDistributer/internal/storage"
+	"github.com/go-chi/chi"
+)
+
+// useMediaStore points the data directory and the media store at a temp dir, and puts the store back after.
+func useMediaStore(t *testing.T) (dir string, root string) {
+	t.Helper()
+	dir = t.TempDir()
+	root = filepath.Join(dir, "media")
+	t.Setenv("DataDir", dir)
+	t.Setenv("FFprobePath", filepath.Join(dir, "no-ffprobe"))
+	t.Setenv("FFmpegPath", filepath.Join(dir, "no-ffmpeg"))
+
+	old := media.Store()
+	media.SetStore(storage.NewLocalStore(root, "", ""))
+	t.Cleanup(func() { media.SetStore(old) })
+	return dir, root
+}
+
+// randomPNG is a small image no other test uploads, so the library never sees it as a duplicate.
+func randomPNG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	if _, err := rand.Read(img.Pix); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// brokenBody sends its data, then fails like a dropped connection.
+type brokenBody struct{ r io.Reader }
+
+func (b brokenBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+type tusClient struct {
+	t      *testing.T
+	router *chi.Mux
+}
+
+func newTusClient(t *testing.T) *tusClient {
+	r := chi.NewRouter()
+	Handler(r)
+	return &tusClient{t: t, router: r}
+}
+
+func (c *tusClient) do(method string, path string, body io.Reader, headers map[string]string) *httptest.ResponseRecorder {
+	c.t.Helper()
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("Tus-Resumable", tusVersion)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	c.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func (c *tusClient) create(length int) string {
+	c.t.Helper()
+	rec := c.do("POST", "/upload/tus", nil, map[string]string{
+		"Upload-Length":   strconv.Itoa(length),
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("photo.png")),
+	})
+	if rec.Code != http.StatusCreated || rec.Header().Get("Upload-Offset") != "0" {
+		c.t.Fatalf("create: %d %s", rec.Code, rec.Body)
+	}
+	return rec.Header().Get("Location")
+}
+
+func (c *tusClient) patch(location string, offset int, body io.Reader) *httptest.ResponseRecorder {
+	c.t.Helper()
+	return c.do("PATCH", location, body, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": strconv.Itoa(offset),
+	})
+}
+
+func (c *tusClient) offset(location string) string {
+	c.t.Helper()
+	rec := c.do("HEAD", location, nil, nil)
+	if rec.Code != http.StatusOK {
+		c.t.Fatalf("HEAD %s: %d", location, rec.Code)
+	}
+	return rec.Header().Get("Upload-Offset")
+}
+
+func mediaID(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var result map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("%d %s: %v", rec.Code, rec.Body, err)
+	}
+	id, _ := result["media_id"].(string)
+	if !media.ValidID(id) {
+		t.Fatalf("no media id in %s", rec.Body)
+	}
+	return id
+}
+
+func TestTusUpload(t *testing.T) {
+	useMediaStore(t)
+	c := newTusClient(t)
+	data := randomPNG(t)
+
+	location := c.create(len(data))
+	if got := c.offset(location); got != "0" {
+		t.Errorf("offset of a new upload: %s", got)
+	}
+
+	first := len(data) / 3
+	if rec := c.patch(location, 0, bytes.NewReader(data[:first])); rec.Code != http.StatusNoContent {
+		t.Fatalf("first chunk: %d %s", rec.Code, rec.Body)
+	}
+
+	// a chunk cut off halfway is kept, and the client resumes from where it stopped.
+	second := 2 * len(data) / 3
+	rec := c.patch(location, first, brokenBody{bytes.NewReader(data[first:second])})
+	if rec.Code != http.StatusBadRequest || rec.Header().Get("Upload-Offset") != strconv.Itoa(second) {
+		t.Fatalf("interrupted chunk: %d, offset %s", rec.Code, rec.Header().Get("Upload-Offset"))
+	}
+	if got := c.offset(location); got != strconv.Itoa(second) {
+		t.Errorf("offset after the interrupted chunk: %s, want %d", got, second)
+	}
+
+	// a chunk sent at the wrong offset is refused.
+	if rec := c.patch(location, first, bytes.NewReader(data[first:])); rec.Code != http.StatusConflict {
+		t.Errorf("chunk at a stale offset: %d", rec.Code)
+	}
+	if rec := c.do("GET", location, nil, nil); rec.Code != http.StatusConflict {
+		t.Errorf("status of an unfinished upload: %d", rec.Code)
+	}
+
+	rec = c.patch(location, second, bytes.NewReader(data[second:]))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("last chunk: %d %s", rec.Code, rec.Body)
+	}
+	id := mediaID(t, rec)
+	if item, err := media.Get(id); err != nil || item.Size != int64(len(data)) {
+		t.Errorf("uploaded item: %+v, %v", item, err)
+	}
+
+	// the client didn't hear back and sends the last chunk again.
+	if rec := c.patch(location, second, bytes.NewReader(data[second:])); rec.Code != http.StatusOK || mediaID(t, rec) != id {
+		t.Errorf("retried last chunk: %d %s", rec.Code, rec.Body)
+	}
+	if rec := c.do("GET", location, nil, nil); rec.Code != http.StatusOK || mediaID(t, rec) != id {
+		t.Errorf("status: %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := c.do("DELETE", location, nil, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE: %d", rec.Code)
+	}
+	if rec := c.do("HEAD", location, nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("HEAD after DELETE: %d", rec.Code)
+	}
+}
+
+func TestTusRetryAfterFailedFinish(t *testing.T) {
+	_, root := useMediaStore(t)
+	c := newTusClient(t)
+	data := randomPNG(t)
+
+	// the media store cannot be written while its root is a file.
+	if err := os.WriteFile(root, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	location := c.create(len(data))
+	if rec := c.patch(location, 0, bytes.NewReader(data)); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("finishing into a broken store: %d %s", rec.Code, rec.Body)
+	}
+	if got := c.offset(location); got != strconv.Itoa(len(data)) {
+		t.Errorf("offset after the failed finish: %s", got)
+	}
+
+	if err := os.Remove(root); err != nil {
+		t.Fatal(err)
+	}
+	rec := c.patch(location, len(data), bytes.NewReader(nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("retry: %d %s", rec.Code, rec.Body)
+	}
+	if item, err := media.Get(mediaID(t, rec)); err != nil || item.Checksum == "" {
+		t.Errorf("uploaded item: %+v, %v", item, err)
+	}
+}
+
+func TestExpireTusUploads(t *testing.T) {
+	useMediaStore(t)
+	c := newTusClient(t)
+
+	stale := c.create(100)
+	if rec := c.patch(stale, 0, bytes.NewReader(make([]byte, 10))); rec.Code != http.StatusNoContent {
+		t.Fatalf("chunk: %d", rec.Code)
+	}
+	fresh := c.create(100)
+
+	staleID := filepath.Base(stale)
+	old := time.Now().Add(-tusExpiry - time.Minute)
+	for _, p := range []string{tusInfoPath(staleID), tusPartPath(staleID)} {
+		if err := os.Chtimes(p, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, freed, err := ExpireTusUploads()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 2 || freed < 10 {
+		t.Errorf("removed %v (%d bytes)", removed, freed)
+	}
+	if rec := c.do("HEAD", stale, nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("expired upload: %d", rec.Code)
+	}
+	if _, err := os.Stat(tusPartPath(staleID)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expired .part file: %v", err)
+	}
+	if got := c.offset(fresh); got != "0" {
+		t.Errorf("fresh upload: offset %s", got)
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+
+	"github.com/TanishqM1/SocialContentDistributer/api"
+	"github.com/TanishqM1/SocialContentDistributer/internal/media"
+)
+
+// in this file, I handle the watermark profiles (internal/media/watermark.go) a post can ask for with "watermark" / "watermarks".
+
+type watermarkPreviewRequest struct {
+	Profile string `json:"profile"`
+}
+
+// ListWatermarks returns every watermark profile.
+func ListWatermarks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, media.ListWatermarks())
+}
+
+// GetWatermark returns one profile.
+func GetWatermark(w http.ResponseWriter, r *http.Request) {
+	wm, err := media.GetWatermark(chi.URLParam(r, "name"))
+	if err != nil {
+		api.HandleNotFoundError(w, err.Error())
+		return
+	}
+	writeJSON(w, wm)
+}
+
+// SaveWatermark creates or replaces the profile named in the url.
+// Body: {"logo": "<media id>", "position": "bottom-right", "opacity": 0.8, "margin": 0.03, "scale": 0.15, "video": false}
+func SaveWatermark(w http.ResponseWriter, r *http.Request) {
+	var wm media.Watermark
+	if err := json.NewDecoder(r.Body).Decode(&wm); err != nil {
+		api.HandleRequestError(w, err)
+		return
+	}
+	wm.Name = chi.URLParam(r, "name")
+
+	saved, err := media.SaveWatermark(wm)
+	var invalid *media.InvalidWatermarkError
+	switch {
+	case errors.As(err, &invalid):
+		api.HandleRequestError(w, err)
+	case err != nil:
+		writeMediaError(w, err)
+	default:
+		writeJSON(w, saved)
+	}
+}
+
+// DeleteWatermark removes a profile.
+func DeleteWatermark(w http.ResponseWriter, r *http.Request) {
+	if err := media.DeleteWatermark(chi.URLParam(r, "name")); err != nil {
+		if errors.Is(err, media.ErrWatermarkNotFound) {
+			api.HandleNotFoundError(w, err.Error())
+			return
+		}
+		writeMediaError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PreviewWatermark applies a profile to a media item as is (publishing applies it to each platform's variant instead).
+// Body: {"profile": "brand"}
+func PreviewWatermark(w http.ResponseWriter, r *http.Request) {
+	var body watermarkPreviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		api.HandleRequestError(w, err)
+		return
+	}
+	item, err := media.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		writeMediaError(w, err)
+		return
+	}
+
+	marked, err := media.ApplyWatermark(r.Context(), item, body.Profile)
+	switch {
+	case errors.Is(err, media.ErrWatermarkNotFound):
+		api.HandleRequestError(w, err)
+	case errors.Is(err, media.ErrNoFFmpeg):
+		api.HandleStatusError(w, err.Error(), http.StatusServiceUnavailable)
+	case err != nil:
+		writeMediaError(w, err)
+	default:
+		writeJSON(w, marked)
+	}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi"
 	chimiddle "github.com/go-chi/chi/middleware"
@@ -18,10 +19,12 @@ func Handler(r *chi.Mux) {
 	r.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, HEAD, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata")
+			w.Header().Set("Access-Control-Expose-Headers", "Location, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size, Upload-Length, Upload-Offset")
 
-			if req.Method == "OPTIONS" {
+			// the tus endpoint answers OPTIONS itself (protocol discovery).
+			if req.Method == "OPTIONS" && !strings.HasPrefix(req.URL.Path, "/upload/tus") {
 				w.WriteHeader(http.StatusOK)
 				return
 			}
@@ -36,10 +39,81 @@ func Handler(r *chi.Mux) {
 	r.Route("/post", func(router chi.Router) {
 		// implementation for this endpoint
 		router.Post("/content", PostContent)
+		router.Get("/status/{id}", GetPostStatus)
+		router.Get("/links/{id}", GetPostLinks)
 	})
 
 	// File upload route
 	r.Route("/upload", func(router chi.Router) {
 		router.Post("/file", UploadFile)
+
+		// resumable uploads (tus protocol), see TusUpload.go
+		router.Route("/tus", func(router chi.Router) {
+			router.Options("/", TusOptions)
+			router.Post("/", TusCreate)
+			router.Options("/{id}", TusOptions)
+			router.Head("/{id}", TusHead)
+			router.Get("/{id}", TusStatus)
+			router.Patch("/{id}", TusPatch)
+			router.Delete("/{id}", TusDelete)
+		})
+	})
+
+	// watermark profiles, applied to media when posting
+	r.Route("/watermarks", func(router chi.Router) {
+		router.Get("/", ListWatermarks)
+		router.Get("/{name}", GetWatermark)
+		router.Put("/{name}", SaveWatermark)
+		router.Delete("/{name}", DeleteWatermark)
+	})
+
+	// caption templates, rendered into a post's text fields
+	r.Route("/templates", func(router chi.Router) {
+		router.Get("/", ListTemplates)
+		router.Get("/{name}", GetTemplate)
+		router.Put("/{name}", SaveTemplate)
+		router.Delete("/{name}", DeleteTemplate)
+		router.Post("/{name}/render", RenderTemplate)
+	})
+
+	// saved hashtag sets, added to a post's tags
+	r.Route("/hashtags", func(router chi.Router) {
+		router.Get("/", ListHashtagSets)
+		router.Get("/{name}", GetHashtagSet)
+		router.Put("/{name}", SaveHashtagSet)
+		router.Delete("/{name}", DeleteHashtagSet)
+	})
+
+	// UTM rules for the links in posts
+	r.Get("/utm", GetUTM)
+	r.Put("/utm", SaveUTM)
+
+	// short links in posts redirect from here, see Links.go
+	r.Get("/{code}", FollowLink)
+
+	// media library
+	r.Route("/media", func(router chi.Router) {
+		router.Get("/", ListMedia)
+		router.Post("/gc", CollectMediaGarbage)
+		router.Post("/import", ImportMedia)
+		router.Get("/file/*", ServeMediaFile)
+		router.Get("/{id}", GetMedia)
+		router.Delete("/{id}", DeleteMedia)
+		router.Get("/{id}/url", GetMediaURL)
+		router.Post("/{id}/transcode", TranscodeMedia)
+		router.Get("/{id}/renditions", ListRenditions)
+		router.Post("/{id}/frames", ExtractFrames)
+		router.Post("/{id}/clips", MakeClip)
+		router.Post("/{id}/render", RenderAudio)
+		router.Post("/{id}/watermark", PreviewWatermark)
+		router.Post("/{id}/variants", MakeImageVariants)
+		router.Put("/{id}/focus", SetMediaFocus)
+		router.Post("/{id}/probe", ProbeMedia)
+		router.Get("/{id}/check", CheckMedia)
+		router.Get("/{id}/metadata", GetMediaMetadata)
+		router.Post("/{id}/strip", StripMedia)
+		router.Put("/{id}/tags", SetMediaTags)
+		router.Post("/{id}/tags", SetMediaTags)
+		router.Delete("/{id}/tags/{tag}", DeleteMediaTag)
 	})
 }
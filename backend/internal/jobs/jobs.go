@@ -0,0 +1,224 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/TanishqM1/SocialContentDistributer/api"
+	"github.com/TanishqM1/SocialContentDistributer/internal/captions"
+	"github.com/TanishqM1/SocialContentDistributer/internal/media"
+	"github.com/TanishqM1/SocialContentDistributer/internal/store"
+)
+
+// in this file, I keep track of every post submitted to /post/content and the result for each platform inside it.
+// platforms that go through upload-post.com finish asynchronously, so their result stays "processing" until the poller (poller.go) hears back.
+// everything is saved to posts.json so pending request ids survive a restart.
+// a post holds a reference on its media (media.Retain) until every target has completed or failed, then lets go of
+// it so the media garbage collector can remove files nothing uses any more.
+
+const (
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+)
+
+// Result is the outcome of a post on a single platform. results are keyed by target ("instagram" or "instagram:brand2").
+type Result struct {
+	Platform  string `json:"platform"`
+	Account   string `json:"account,omitempty"` // upload-post profile, empty for the default one
+	Status    string `json:"status"`
+	RequestID string `json:"request_id,omitempty"` // upload-post request id, if the platform is async
+	Error     string `json:"error,omitempty"`
+	// metadata removed from the media before it was sent, e.g. "gps_location" (see media/privacy.go)
+	MetadataRemoved []string `json:"metadata_removed,omitempty"`
+	MetadataWarning string   `json:"metadata_warning,omitempty"` // e.g. the list above may be incomplete
+	// text that was shortened to fit the platform's limits (see captions/limits.go)
+	TextChanges []captions.Change `json:"text_changes,omitempty"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// Post is one submission, fanned out to several platforms.
+type Post struct {
+	ID        string             `json:"id"`
+	CreatedAt time.Time          `json:"created_at"`
+	MediaIDs  []string           `json:"media_ids,omitempty"`      // media library items the post uses (and holds a reference on)
+	Released  bool               `json:"media_released,omitempty"` // the references on MediaIDs were given back
+	Results   map[string]*Result `json:"results"`
+}
+
+var (
+	mu    sync.Mutex
+	posts = map[string]*Post{}
+)
+
+func postsPath() string {
+	return store.Path("posts.json")
+}
+
+// Load reads posts.json into memory. Call it once on startup, before Resume.
+func Load() error {
+	mu.Lock()
+	defer mu.Unlock()
+	return store.Load(postsPath(), &posts)
+}
+
+// must hold mu.
+func save() {
+	if err := store.Save(postsPath(), posts); err != nil {
+		log.Errorf("saving posts: %v", err)
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Create registers a new post with a pending result for every target.
+func Create(targets []string, mediaIDs []string) Post {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	p := &Post{
+		ID:        newID(),
+		CreatedAt: now,
+		MediaIDs:  mediaIDs,
+		Results:   map[string]*Result{},
+	}
+	for _, target := range targets {
+		platform, account := api.SplitTarget(target)
+		p.Results[target] = &Result{Platform: platform, Account: account, Status: StatusPending, UpdatedAt: now}
+	}
+	posts[p.ID] = p
+	save()
+	return p.copy()
+}
+
+// Get returns a snapshot of the post with the given id.
+func Get(id string) (Post, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	p, ok := posts[id]
+	if !ok {
+		return Post{}, false
+	}
+	return p.copy(), true
+}
+
+func (p *Post) copy() Post {
+	c := *p
+	c.MediaIDs = append([]string(nil), p.MediaIDs...)
+	c.Results = make(map[string]*Result, len(p.Results))
+	for k, v := range p.Results {
+		r := *v
+		r.MetadataRemoved = append([]string(nil), v.MetadataRemoved...)
+		r.TextChanges = append([]captions.Change(nil), v.TextChanges...)
+		c.Results[k] = &r
+	}
+	return c
+}
+
+// update applies fn to the result of target inside post id and saves, releasing the post's media if that was its
+// last target to finish.
+func update(id string, target string, fn func(r *Result)) {
+	// media has its own lock, it is not taken while holding ours.
+	if release := updateResult(id, target, fn); len(release) > 0 {
+		releaseMedia(id, release)
+	}
+}
+
+func updateResult(id string, target string, fn func(r *Result)) []string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	p, ok := posts[id]
+	if !ok {
+		return nil
+	}
+	r, ok := p.Results[target]
+	if !ok {
+		platform, account := api.SplitTarget(target)
+		r = &Result{Platform: platform, Account: account}
+		p.Results[target] = r
+	}
+	fn(r)
+	r.UpdatedAt = time.Now()
+	release := finished(p)
+	save()
+	return release
+}
+
+// finished marks the post's media released once every target is done, and returns the ids to release (nil if the
+// post still has targets in flight or released them already). must hold mu.
+func finished(p *Post) []string {
+	if p.Released {
+		return nil
+	}
+	for _, r := range p.Results {
+		if r.Status != StatusCompleted && r.Status != StatusFailed {
+			return nil
+		}
+	}
+	p.Released = true
+	return p.MediaIDs
+}
+
+func releaseMedia(id string, mediaIDs []string) {
+	if err := media.Release(mediaIDs...); err != nil {
+		log.Errorf("releasing the media of post %s: %v", id, err)
+	}
+}
+
+// Complete marks a target as done.
+func Complete(id string, target string) {
+	update(id, target, func(r *Result) {
+		r.Status = StatusCompleted
+		r.Error = ""
+	})
+}
+
+// Fail marks a target as failed with err.
+func Fail(id string, target string, err error) {
+	update(id, target, func(r *Result) {
+		r.Status = StatusFailed
+		r.Error = err.Error()
+	})
+}
+
+// MetadataRemoved records what was stripped from the media sent to a target, and why that may not be all of it.
+func MetadataRemoved(id string, target string, removed []string, warning string) {
+	if len(removed) == 0 && warning == "" {
+		return
+	}
+	update(id, target, func(r *Result) {
+		r.MetadataRemoved = removed
+		r.MetadataWarning = warning
+	})
+}
+
+// TextChanged records the text that was shortened for a target.
+func TextChanged(id string, target string, changes []captions.Change) {
+	if len(changes) == 0 {
+		return
+	}
+	update(id, target, func(r *Result) {
+		r.TextChanges = changes
+	})
+}
+
+// Processing stores the upload-post request id for a target and starts polling it.
+func Processing(id string, target string, requestID string) {
+	update(id, target, func(r *Result) {
+		r.Status = StatusProcessing
+		r.RequestID = requestID
+	})
+	go poll(id, target, requestID)
+}
@@ -0,0 +1,100 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/TanishqM1/SocialContentDistributer/api"
+	"github.com/TanishqM1/SocialContentDistributer/uploads/uploadpost"
+)
+
+// the poller checks the upload-post status endpoint for each async upload until it completes or fails.
+
+var (
+	PollInterval = 10 * time.Second
+	PollTimeout  = 30 * time.Minute
+)
+
+func poll(id string, target string, requestID string) {
+	apiKey, err := uploadpost.APIKey()
+	if err != nil {
+		Fail(id, target, err)
+		return
+	}
+
+	deadline := time.Now().Add(PollTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(PollInterval)
+
+		status, err := uploadpost.GetStatus(apiKey, requestID)
+		if err != nil {
+			// a failed status check is not a failed upload, try again next tick.
+			log.Warnf("checking upload-post request %s: %v", requestID, err)
+			continue
+		}
+		if !status.Done() {
+			continue
+		}
+
+		// upload-post reports results by platform, the account was already picked by the request.
+		platform, _ := api.SplitTarget(target)
+		if err := statusError(status, platform); err != nil {
+			Fail(id, target, err)
+		} else {
+			Complete(id, target)
+		}
+		return
+	}
+
+	Fail(id, target, fmt.Errorf("upload-post request %s did not finish within %v", requestID, PollTimeout))
+}
+
+// statusError turns a finished status into an error (nil if the platform succeeded).
+func statusError(status uploadpost.Status, platform string) error {
+	for _, r := range status.Results {
+		if r.Platform != platform {
+			continue
+		}
+		if r.Success {
+			return nil
+		}
+		if r.Error != "" {
+			return errors.New(r.Error)
+		}
+		return fmt.Errorf("%s upload failed", platform)
+	}
+
+	if status.Status == uploadpost.StatusFailed {
+		if status.Message != "" {
+			return errors.New(status.Message)
+		}
+		return errors.New("upload-post reported the upload as failed")
+	}
+	return nil
+}
+
+// Resume restarts polling for every result that was still processing when the server stopped, and releases the
+// media of posts that finished without doing so.
+func Resume() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	released := false
+	for _, p := range posts {
+		for target, r := range p.Results {
+			if r.Status == StatusProcessing && r.RequestID != "" {
+				go poll(p.ID, target, r.RequestID)
+			}
+		}
+		if ids := finished(p); len(ids) > 0 {
+			released = true
+			go releaseMedia(p.ID, ids)
+		}
+	}
+	if released {
+		save()
+	}
+}
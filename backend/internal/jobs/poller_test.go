@@ -0,0 +1,218 @@
+package jobs
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TanishqM1/SocialContentDistributer/internal/media"
+	"github.com/TanishqM1/SocialContentDistributer/internal/storage"
+	"github.com/TanishqM1/SocialContentDistributer/uploads/uploadpost"
+)
+
+func TestStatusError(t *testing.T) {
+	cases := []struct {
+		name   string
+		status uploadpost.Status
+		want   string // "" for no error
+	}{
+		{"platform succeeded", uploadpost.Status{Status: uploadpost.StatusCompleted, Results: []uploadpost.PlatformResult{
+			{Platform: "instagram", Success: true},
+		}}, ""},
+		{"platform failed with a reason", uploadpost.Status{Status: uploadpost.StatusCompleted, Results: []uploadpost.PlatformResult{
+			{Platform: "pinterest", Success: true},
+			{Platform: "instagram", Error: "media too large"},
+		}}, "media too large"},
+		{"platform failed without a reason", uploadpost.Status{Status: uploadpost.StatusCompleted, Results: []uploadpost.PlatformResult{
+			{Platform: "instagram"},
+		}}, "instagram upload failed"},
+		{"platform result wins over the request status", uploadpost.Status{Status: uploadpost.StatusFailed, Results: []uploadpost.PlatformResult{
+			{Platform: "instagram", Success: true},
+		}}, ""},
+		{"request failed", uploadpost.Status{Status: uploadpost.StatusFailed, Message: "account disconnected"}, "account disconnected"},
+		{"request failed without a message", uploadpost.Status{Status: uploadpost.StatusFailed, Results: []uploadpost.PlatformResult{
+			{Platform: "pinterest", Success: true},
+		}}, "upload-post reported the upload as failed"},
+		{"completed without results", uploadpost.Status{Status: uploadpost.StatusCompleted}, ""},
+	}
+	for _, c := range cases {
+		got := ""
+		if err := statusError(c.status, "instagram"); err != nil {
+			got = err.Error()
+		}
+		if got != c.want {
+			t.Errorf("%s: %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+// usePosts gives a test its own data directory and media store, and a media item a post can hold.
+func usePosts(t *testing.T) media.Item {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("DataDir", dir)
+	t.Setenv("FFprobePath", filepath.Join(dir, "no-ffprobe"))
+	t.Setenv("FFmpegPath", filepath.Join(dir, "no-ffmpeg"))
+
+	old := media.Store()
+	media.SetStore(storage.NewLocalStore(filepath.Join(dir, "media"), "", ""))
+	t.Cleanup(func() { media.SetStore(old) })
+
+	mu.Lock()
+	oldPosts := posts
+	posts = map[string]*Post{}
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		posts = oldPosts
+		mu.Unlock()
+	})
+
+	// a pixel unique to the test, so the library doesn't hand back an item from another one.
+	img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	copy(img.Pix, []byte(t.Name()))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	path, err := media.StagingPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := media.Save(&buf, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, _, err := media.Add(saved, "photo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+func refs(t *testing.T, id string) int {
+	t.Helper()
+	item, err := media.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return item.Refs
+}
+
+// waitFor polls the post until target is no longer processing.
+func waitFor(t *testing.T, id string, target string) Result {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		p, _ := Get(id)
+		if r := p.Results[target]; r.Status != StatusProcessing {
+			return *r
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("%s of post %s is still processing", target, id)
+	return Result{}
+}
+
+func TestPollFinishesAndReleasesMedia(t *testing.T) {
+	item := usePosts(t)
+
+	// the poller reads the api key from config/.env, relative to the working directory.
+	t.Chdir(t.TempDir())
+	if err := os.Mkdir("config", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("config/.env", []byte("UploadsAPI=test-key\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("UploadsAPI", "test-key")
+
+	// each request is in progress for its first two checks, then reports its result.
+	var checks atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Apikey test-key" {
+			http.Error(w, "bad key", http.StatusUnauthorized)
+			return
+		}
+		requestID := r.URL.Query().Get("request_id")
+		if checks.Add(1)%3 != 0 {
+			io.WriteString(w, `{"status":"in_progress"}`)
+			return
+		}
+		switch requestID {
+		case "ok":
+			io.WriteString(w, `{"status":"completed","results":[{"platform":"instagram","success":true}]}`)
+		case "rejected":
+			io.WriteString(w, `{"status":"completed","results":[{"platform":"pinterest","success":false,"error":"board not found"}]}`)
+		default:
+			http.Error(w, "unknown request", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	oldURL, oldInterval := uploadpost.BaseURL, PollInterval
+	uploadpost.BaseURL, PollInterval = srv.URL, time.Millisecond
+	t.Cleanup(func() { uploadpost.BaseURL, PollInterval = oldURL, oldInterval })
+
+	if err := media.Retain(item.ID); err != nil {
+		t.Fatal(err)
+	}
+	p := Create([]string{"instagram", "pinterest:brand2"}, []string{item.ID})
+
+	Processing(p.ID, "instagram", "ok")
+	if r := waitFor(t, p.ID, "instagram"); r.Status != StatusCompleted || r.Error != "" {
+		t.Errorf("instagram: %+v", r)
+	}
+	// the post still has a target in flight, so it keeps its media.
+	if got := refs(t, item.ID); got != 1 {
+		t.Errorf("refs while pinterest is processing: %d", got)
+	}
+
+	checks.Store(0)
+	Processing(p.ID, "pinterest:brand2", "rejected")
+	if r := waitFor(t, p.ID, "pinterest:brand2"); r.Status != StatusFailed || r.Error != "board not found" {
+		t.Errorf("pinterest: %+v", r)
+	}
+	if got := refs(t, item.ID); got != 0 {
+		t.Errorf("refs after the post finished: %d", got)
+	}
+	if got, _ := Get(p.ID); !got.Released {
+		t.Error("post is not marked as having released its media")
+	}
+}
+
+// a post releases its media once, when the last of its targets finishes, however it finishes.
+func TestFinishedReleasesMediaOnce(t *testing.T) {
+	item := usePosts(t)
+	if err := media.Retain(item.ID, item.ID); err != nil {
+		t.Fatal(err)
+	}
+	p := Create([]string{"instagram", "youtube"}, []string{item.ID})
+	other := Create([]string{"tiktok"}, []string{item.ID})
+
+	Fail(p.ID, "instagram", os.ErrPermission)
+	if got := refs(t, item.ID); got != 2 {
+		t.Errorf("refs with youtube pending: %d", got)
+	}
+	Complete(p.ID, "youtube")
+	if got := refs(t, item.ID); got != 1 {
+		t.Errorf("refs after the post finished: %d", got)
+	}
+	// finishing a target again doesn't give back a reference the other post holds.
+	Complete(p.ID, "instagram")
+	if got := refs(t, item.ID); got != 1 {
+		t.Errorf("refs after a target finished twice: %d", got)
+	}
+	Complete(other.ID, "tiktok")
+	if got := refs(t, item.ID); got != 0 {
+		t.Errorf("refs after both posts finished: %d", got)
+	}
+}
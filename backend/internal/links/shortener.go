@@ -0,0 +1,247 @@
+package links
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/TanishqM1/SocialContentDistributer/internal/store"
+)
+
+// when ShortLinkURL is set (the public address the server answers on, e.g. https://go.example.com), every link a
+// post sends out is rewritten to ShortLinkURL/{code}. a code is made per link per target, so a click tells which
+// post and which network it came from; the redirect is served by this server, which counts the clicks and keeps the
+// time and referrer of the last maxRecentClicks. links are saved to links.json in the data directory, clicks at most
+// once every clickSaveDelay so a burst of visits is not a burst of file writes. a post can keep its links as they
+// are with "keep_links".
+
+// ErrLinkNotFound is returned for a code that does not exist.
+var ErrLinkNotFound = errors.New("short link not found")
+
+const (
+	codeLength   = 7
+	codeAlphabet = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789" // no 0/O, 1/l/I
+
+	maxRecentClicks = 100
+	maxReferrer     = 512 // bytes
+	clickSaveDelay  = 10 * time.Second
+)
+
+// Click is one visit of a short link.
+type Click struct {
+	At       time.Time `json:"at"`
+	Platform string    `json:"platform"`
+	Referrer string    `json:"referrer,omitempty"`
+}
+
+// Link is a short link.
+type Link struct {
+	Code       string    `json:"code"`
+	URL        string    `json:"url"` // where it redirects, with the UTM parameters if tagging is on
+	PostID     string    `json:"post_id"`
+	Target     string    `json:"target"` // entry of platforms it was posted to, e.g. "instagram:brand2"
+	Platform   string    `json:"platform"`
+	CreatedAt  time.Time `json:"created_at"`
+	ClickCount int       `json:"click_count"`
+	Clicks     []Click   `json:"clicks"` // the last maxRecentClicks, oldest first
+}
+
+var (
+	linksMu     sync.Mutex
+	links       = map[string]*Link{}
+	clicksDirty bool // clicks not saved yet, a save is scheduled
+)
+
+func linksPath() string {
+	return store.Path("links.json")
+}
+
+// LoadLinks reads links.json. Call it once on startup.
+func LoadLinks() error {
+	linksMu.Lock()
+	defer linksMu.Unlock()
+	if err := store.Load(linksPath(), &links); err != nil {
+		return err
+	}
+	// links saved before clicks were counted kept every click.
+	for _, l := range links {
+		if l.ClickCount < len(l.Clicks) {
+			l.ClickCount = len(l.Clicks)
+		}
+		if len(l.Clicks) > maxRecentClicks {
+			l.Clicks = append([]Click{}, l.Clicks[len(l.Clicks)-maxRecentClicks:]...)
+		}
+	}
+	return nil
+}
+
+// ShortBase returns the address short links start with, "" if shortening is off.
+func ShortBase() string {
+	return strings.TrimSuffix(os.Getenv("ShortLinkURL"), "/")
+}
+
+func (l *Link) copy() Link {
+	c := *l
+	c.Clicks = append([]Click{}, l.Clicks...)
+	return c
+}
+
+// newCode returns a random code no link has yet. call it with linksMu held.
+func newCode() (string, error) {
+	for {
+		b := make([]byte, codeLength)
+		for i := range b {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(codeAlphabet))))
+			if err != nil {
+				return "", err
+			}
+			b[i] = codeAlphabet[n.Int64()]
+		}
+		if _, taken := links[string(b)]; !taken {
+			return string(b), nil
+		}
+	}
+}
+
+// shorten makes a short link to url for a post's target and returns its address.
+func shorten(url string, postID string, target string, platform string) (string, error) {
+	linksMu.Lock()
+	defer linksMu.Unlock()
+
+	code, err := newCode()
+	if err != nil {
+		return "", err
+	}
+	links[code] = &Link{Code: code, URL: url, PostID: postID, Target: target, Platform: platform, CreatedAt: time.Now(), Clicks: []Click{}}
+	if err := store.Save(linksPath(), links); err != nil {
+		// a link that isn't on disk would stop redirecting after a restart, so it isn't handed out.
+		delete(links, code)
+		return "", err
+	}
+	return ShortBase() + "/" + code, nil
+}
+
+// ShortenLinks rewrites the links in a post's fields to short links, like TagLinks. it does nothing when
+// shortening is off. the same link twice in one target gets one code.
+func ShortenLinks(postID string, target string, platform string, linkFields []*string, textFields []*string) error {
+	base := ShortBase()
+	if base == "" {
+		return nil
+	}
+	made := map[string]string{}
+	short := func(link string) (string, error) {
+		if strings.HasPrefix(link, base+"/") {
+			return link, nil
+		}
+		if s, ok := made[link]; ok {
+			return s, nil
+		}
+		s, err := shorten(link, postID, target, platform)
+		if err != nil {
+			return "", err
+		}
+		made[link] = s
+		return s, nil
+	}
+
+	var err error
+	for _, field := range linkFields {
+		if link := strings.TrimSpace(*field); link != "" && URLPattern.MatchString(link) {
+			var s string
+			if s, err = short(link); err != nil {
+				return err
+			}
+			*field = s
+		}
+	}
+	for _, field := range textFields {
+		*field = URLPattern.ReplaceAllStringFunc(*field, func(m string) string {
+			link, rest := TrimURL(m)
+			s, shortErr := short(link)
+			if shortErr != nil {
+				err = shortErr
+				return m
+			}
+			return s + rest
+		})
+	}
+	return err
+}
+
+// Follow records a click on the link with the given code and returns where it goes. the click is saved with the
+// next batch, see saveClicks.
+func Follow(code string, referrer string) (string, error) {
+	linksMu.Lock()
+	defer linksMu.Unlock()
+
+	l, ok := links[code]
+	if !ok {
+		return "", ErrLinkNotFound
+	}
+	l.ClickCount++
+	l.Clicks = append(l.Clicks, Click{At: time.Now(), Platform: l.Platform, Referrer: truncateReferrer(referrer)})
+	if len(l.Clicks) > maxRecentClicks {
+		l.Clicks = append(l.Clicks[:0], l.Clicks[len(l.Clicks)-maxRecentClicks:]...)
+	}
+	if !clicksDirty {
+		clicksDirty = true
+		time.AfterFunc(clickSaveDelay, func() {
+			if err := saveClicks(); err != nil {
+				log.Error(err)
+			}
+		})
+	}
+	return l.URL, nil
+}
+
+// saveClicks writes links.json if clicks came in since it was last written.
+func saveClicks() error {
+	linksMu.Lock()
+	defer linksMu.Unlock()
+
+	if !clicksDirty {
+		return nil
+	}
+	clicksDirty = false
+	return store.Save(linksPath(), links)
+}
+
+// truncateReferrer cuts a referrer to maxReferrer bytes, on a character boundary.
+func truncateReferrer(referrer string) string {
+	if len(referrer) <= maxReferrer {
+		return referrer
+	}
+	cut := maxReferrer
+	for cut > 0 && !utf8.RuneStart(referrer[cut]) {
+		cut--
+	}
+	return referrer[:cut]
+}
+
+// ForPost returns the short links made for a post, oldest first.
+func ForPost(postID string) []Link {
+	linksMu.Lock()
+	defer linksMu.Unlock()
+
+	list := []Link{}
+	for _, l := range links {
+		if l.PostID == postID {
+			list = append(list, l.copy())
+		}
+	}
+	sort.Slice(list, func(a, b int) bool {
+		if !list[a].CreatedAt.Equal(list[b].CreatedAt) {
+			return list[a].CreatedAt.Before(list[b].CreatedAt)
+		}
+		return list[a].Code < list[b].Code
+	})
+	return list
+}
@@ -0,0 +1,118 @@
+package links
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/TanishqM1/SocialContentDistributer/internal/store"
+)
+
+func TestShortenLinks(t *testing.T) {
+	t.Setenv("DataDir", t.TempDir())
+	t.Setenv("ShortLinkURL", "https://go.example.com/")
+
+	link := "https://shop.com/p"
+	text := "see https://shop.com/p. again https://shop.com/p and https://go.example.com/abc"
+	if err := ShortenLinks("post1", "instagram", "instagram", []*string{&link}, []*string{&text}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(link, "https://go.example.com/") || len(link) != len("https://go.example.com/")+codeLength {
+		t.Fatalf("link field: %q", link)
+	}
+	// one code per link per target, and links that are short already are left alone.
+	if want := "see " + link + ". again " + link + " and https://go.example.com/abc"; text != want {
+		t.Errorf("text field:\n got %q\nwant %q", text, want)
+	}
+	made := ForPost("post1")
+	if len(made) != 1 || made[0].URL != "https://shop.com/p" || made[0].Target != "instagram" {
+		t.Errorf("links for the post: %+v", made)
+	}
+}
+
+func TestShortenLinksSaveFails(t *testing.T) {
+	// the data directory is a file, so links.json cannot be written.
+	dir := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(dir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DataDir", dir)
+	t.Setenv("ShortLinkURL", "https://go.example.com")
+
+	link := "https://shop.com/p"
+	text := "see https://shop.com/p and https://shop.com/p"
+	if err := ShortenLinks("post2", "reddit", "reddit", []*string{&link}, []*string{&text}); err == nil {
+		t.Fatal("no error while links.json cannot be saved")
+	}
+	if link != "https://shop.com/p" || text != "see https://shop.com/p and https://shop.com/p" {
+		t.Errorf("links were replaced: %q, %q", link, text)
+	}
+	if made := ForPost("post2"); len(made) != 0 {
+		t.Errorf("unsaved links are kept: %+v", made)
+	}
+}
+
+func TestFollowKeepsRecentClicks(t *testing.T) {
+	t.Setenv("DataDir", t.TempDir())
+	t.Setenv("ShortLinkURL", "https://go.example.com")
+
+	link := "https://shop.com/follow"
+	if err := ShortenLinks("post3", "reddit", "reddit", []*string{&link}, nil); err != nil {
+		t.Fatal(err)
+	}
+	code := strings.TrimPrefix(link, "https://go.example.com/")
+
+	long := "https://example.com/?q=" + strings.Repeat("é", maxReferrer)
+	for i := 0; i < maxRecentClicks+20; i++ {
+		url, err := Follow(code, long)
+		if err != nil || url != "https://shop.com/follow" {
+			t.Fatalf("Follow: %q, %v", url, err)
+		}
+	}
+	if _, err := Follow("nope123", ""); err != ErrLinkNotFound {
+		t.Errorf("unknown code: %v", err)
+	}
+
+	l := ForPost("post3")[0]
+	if l.ClickCount != maxRecentClicks+20 || len(l.Clicks) != maxRecentClicks {
+		t.Errorf("%d clicks counted, %d kept", l.ClickCount, len(l.Clicks))
+	}
+	if r := l.Clicks[0].Referrer; len(r) > maxReferrer || !utf8.ValidString(r) || !strings.HasPrefix(long, r) {
+		t.Errorf("referrer kept as %q", r)
+	}
+
+	// the clicks are written with the next batch, not by Follow.
+	var saved map[string]*Link
+	if err := store.Load(linksPath(), &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved[code].ClickCount != 0 {
+		t.Errorf("Follow saved links.json")
+	}
+	if err := saveClicks(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Load(linksPath(), &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved[code].ClickCount != maxRecentClicks+20 || len(saved[code].Clicks) != maxRecentClicks {
+		t.Errorf("saved %d clicks counted, %d kept", saved[code].ClickCount, len(saved[code].Clicks))
+	}
+}
+
+func TestLoadLinksTrimsOldClicks(t *testing.T) {
+	t.Setenv("DataDir", t.TempDir())
+	old := map[string]*Link{"abcdefg": {Code: "abcdefg", URL: "https://shop.com", PostID: "post4", Clicks: make([]Click, maxRecentClicks+5)}}
+	if err := store.Save(linksPath(), old); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadLinks(); err != nil {
+		t.Fatal(err)
+	}
+	l := ForPost("post4")[0]
+	if l.ClickCount != maxRecentClicks+5 || len(l.Clicks) != maxRecentClicks {
+		t.Errorf("%d clicks counted, %d kept", l.ClickCount, len(l.Clicks))
+	}
+}
@@ -0,0 +1,195 @@
+package links
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/TanishqM1/SocialContentDistributer/internal/store"
+)
+
+// every link a post sends out (the Pinterest pin link, the Reddit link post url and any url in the text) gets UTM
+// parameters, so analytics can tell which network the traffic came from: utm_source is the platform, utm_medium
+// comes from the rules and utm_campaign from the post's "utm_campaign". links to excluded domains (and their
+// subdomains) are left alone, and so is any link that already has a utm_source. the rules are saved to utm.json in
+// the data directory and tagging is off until they are saved with "enabled": true.
+
+// UTMRule is how links posted to one platform are tagged.
+type UTMRule struct {
+	Source   string   `json:"source,omitempty"`  // default the platform name
+	Medium   string   `json:"medium,omitempty"`  // default the config's medium
+	Content  string   `json:"content,omitempty"` // utm_content, optional
+	Exclude  []string `json:"exclude,omitempty"` // more domains to leave alone on this platform
+	Disabled bool     `json:"disabled,omitempty"`
+}
+
+// UTMConfig holds the UTM rules.
+type UTMConfig struct {
+	Enabled   bool               `json:"enabled"`
+	Medium    string             `json:"medium"`    // default "social"
+	Exclude   []string           `json:"exclude"`   // domains never tagged, e.g. "youtube.com"
+	Platforms map[string]UTMRule `json:"platforms"` // per platform rules, a platform without one gets the defaults
+}
+
+// InvalidUTMError says what is wrong with the UTM rules.
+type InvalidUTMError struct {
+	Reason string
+}
+
+func (e *InvalidUTMError) Error() string {
+	return "invalid utm rules: " + e.Reason
+}
+
+var (
+	utmMu sync.Mutex
+	utm   = UTMConfig{Medium: "social", Exclude: []string{}, Platforms: map[string]UTMRule{}}
+)
+
+// URLPattern finds links in text.
+var URLPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+func utmPath() string {
+	return store.Path("utm.json")
+}
+
+// LoadUTM reads utm.json. Call it once on startup.
+func LoadUTM() error {
+	utmMu.Lock()
+	defer utmMu.Unlock()
+	return store.Load(utmPath(), &utm)
+}
+
+// GetUTM returns the UTM rules.
+func GetUTM() UTMConfig {
+	utmMu.Lock()
+	defer utmMu.Unlock()
+	return utm
+}
+
+// cleanDomains lowercases domains and checks they are bare host names.
+func cleanDomains(domains []string) ([]string, error) {
+	list := []string{}
+	for _, d := range domains {
+		d = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), "www.")
+		if d == "" || strings.ContainsAny(d, "/:?# ") {
+			return nil, &InvalidUTMError{Reason: "exclude must hold domain names like \"example.com\""}
+		}
+		list = append(list, d)
+	}
+	return list, nil
+}
+
+// SaveUTM replaces the UTM rules.
+func SaveUTM(config UTMConfig) (UTMConfig, error) {
+	if config.Medium == "" {
+		config.Medium = "social"
+	}
+	exclude, err := cleanDomains(config.Exclude)
+	if err != nil {
+		return UTMConfig{}, err
+	}
+	config.Exclude = exclude
+	if config.Platforms == nil {
+		config.Platforms = map[string]UTMRule{}
+	}
+	for platform, rule := range config.Platforms {
+		if rule.Exclude, err = cleanDomains(rule.Exclude); err != nil {
+			return UTMConfig{}, err
+		}
+		config.Platforms[platform] = rule
+	}
+
+	utmMu.Lock()
+	defer utmMu.Unlock()
+
+	utm = config
+	return utm, store.Save(utmPath(), utm)
+}
+
+// excluded reports whether host is one of domains or a subdomain of one.
+func excluded(host string, domains []string) bool {
+	host = strings.TrimPrefix(strings.ToLower(host), "www.")
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrimURL splits the punctuation that ends a sentence off a link found in text ("see https://x.com/a." or
+// "(https://x.com)"). a closing bracket is kept when the link opened one, like wikipedia's "Go_(language)".
+func TrimURL(link string) (string, string) {
+	end := len(link)
+	for end > 0 {
+		c := link[end-1]
+		if strings.IndexByte(".,;:!?'*_~", c) >= 0 {
+			end--
+			continue
+		}
+		if c == ')' && strings.Count(link[:end], "(") < strings.Count(link[:end], ")") {
+			end--
+			continue
+		}
+		break
+	}
+	return link[:end], link[end:]
+}
+
+// tagger returns a function that adds the UTM parameters for platform to one link, or nil if tagging is off.
+func tagger(platform string, campaign string) func(string) string {
+	config := GetUTM()
+	rule := config.Platforms[platform]
+	if !config.Enabled || rule.Disabled {
+		return nil
+	}
+	source, medium := rule.Source, rule.Medium
+	if source == "" {
+		source = platform
+	}
+	if medium == "" {
+		medium = config.Medium
+	}
+	exclude := append(append([]string{}, config.Exclude...), rule.Exclude...)
+
+	return func(link string) string {
+		u, err := url.Parse(link)
+		if err != nil || u.Host == "" || excluded(u.Hostname(), exclude) || u.Query().Has("utm_source") {
+			return link
+		}
+		// the parameters are added to the raw query, so the rest of it keeps its order and encoding.
+		params := []string{"utm_source=" + url.QueryEscape(source), "utm_medium=" + url.QueryEscape(medium)}
+		if campaign != "" {
+			params = append(params, "utm_campaign="+url.QueryEscape(campaign))
+		}
+		if rule.Content != "" {
+			params = append(params, "utm_content="+url.QueryEscape(rule.Content))
+		}
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += strings.Join(params, "&")
+		return u.String()
+	}
+}
+
+// TagLinks adds UTM parameters for platform to the links in every field: link fields hold a single link,
+// text fields may hold any number of them.
+func TagLinks(platform string, campaign string, linkFields []*string, textFields []*string) {
+	tag := tagger(platform, campaign)
+	if tag == nil {
+		return
+	}
+	for _, field := range linkFields {
+		if strings.TrimSpace(*field) != "" {
+			*field = tag(strings.TrimSpace(*field))
+		}
+	}
+	for _, field := range textFields {
+		*field = URLPattern.ReplaceAllStringFunc(*field, func(m string) string {
+			link, rest := TrimURL(m)
+			return tag(link) + rest
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package links
+
+import (
+	"testing"
+)
+
+func TestTrimURL(t *testing.T) {
+	cases := []struct{ in, link, rest string }{
+		{"https://x.com/a", "https://x.com/a", ""},
+		{"https://x.com/a.", "https://x.com/a", "."},
+		{"https://x.com/?q=1!?", "https://x.com/?q=1", "!?"},
+		{"https://x.com/a'", "https://x.com/a", "'"},
+		// "(see https://x.com/a)," the bracket belongs to the sentence.
+		{"https://x.com/a),", "https://x.com/a", "),"},
+		// the link opened a bracket, so it keeps the one closing it.
+		{"https://en.wikipedia.org/wiki/Go_(language)", "https://en.wikipedia.org/wiki/Go_(language)", ""},
+		{"https://en.wikipedia.org/wiki/Go_(language)).", "https://en.wikipedia.org/wiki/Go_(language)", ")."},
+		// Markdown emphasis around a link.
+		{"https://x.com/a*", "https://x.com/a", "*"},
+		{"https://x.com/a_", "https://x.com/a", "_"},
+		{"https://x.com/a~~", "https://x.com/a", "~~"},
+	}
+	for _, c := range cases {
+		link, rest := TrimURL(c.in)
+		if link != c.link || rest != c.rest {
+			t.Errorf("TrimURL(%q) = %q, %q, want %q, %q", c.in, link, rest, c.link, c.rest)
+		}
+	}
+}
+
+func TestTagger(t *testing.T) {
+	t.Setenv("DataDir", t.TempDir())
+	defer SaveUTM(UTMConfig{})
+
+	if _, err := SaveUTM(UTMConfig{Enabled: false}); err != nil {
+		t.Fatal(err)
+	}
+	if tagger("instagram", "launch") != nil {
+		t.Error("tagging while disabled")
+	}
+
+	_, err := SaveUTM(UTMConfig{
+		Enabled: true,
+		Exclude: []string{"YouTube.com", "www.example.org"},
+		Platforms: map[string]UTMRule{
+			"reddit":    {Medium: "community", Source: "rdt", Content: "post body", Exclude: []string{"shop.com"}},
+			"pinterest": {Disabled: true},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tagger("pinterest", "launch") != nil {
+		t.Error("tagging a disabled platform")
+	}
+
+	cases := []struct {
+		platform, campaign, in, want string
+	}{
+		{"instagram", "launch", "https://shop.com/p", "https://shop.com/p?utm_source=instagram&utm_medium=social&utm_campaign=launch"},
+		{"instagram", "", "https://shop.com/p", "https://shop.com/p?utm_source=instagram&utm_medium=social"},
+		{"instagram", "spring sale", "https://shop.com/p", "https://shop.com/p?utm_source=instagram&utm_medium=social&utm_campaign=spring+sale"},
+		// the query keeps its order and encoding, the fragment stays at the end.
+		{"instagram", "", "https://shop.com/p?b=2&a=%2F", "https://shop.com/p?b=2&a=%2F&utm_source=instagram&utm_medium=social"},
+		{"instagram", "", "https://shop.com/p#top", "https://shop.com/p?utm_source=instagram&utm_medium=social#top"},
+		// excluded domains and their subdomains, but not look-alikes.
+		{"instagram", "", "https://youtube.com/watch?v=1", "https://youtube.com/watch?v=1"},
+		{"instagram", "", "https://m.youtube.com/watch?v=1", "https://m.youtube.com/watch?v=1"},
+		{"instagram", "", "https://www.YouTube.com/x", "https://www.YouTube.com/x"},
+		{"instagram", "", "https://example.org/x", "https://example.org/x"},
+		{"instagram", "", "https://notyoutube.com/x", "https://notyoutube.com/x?utm_source=instagram&utm_medium=social"},
+		// links that are tagged already.
+		{"instagram", "launch", "https://shop.com/p?utm_source=newsletter", "https://shop.com/p?utm_source=newsletter"},
+		// a platform's own rule.
+		{"reddit", "launch", "https://blog.com/p", "https://blog.com/p?utm_source=rdt&utm_medium=community&utm_campaign=launch&utm_content=post+body"},
+		{"reddit", "launch", "https://shop.com/p", "https://shop.com/p"},
+	}
+	for _, c := range cases {
+		tag := tagger(c.platform, c.campaign)
+		if tag == nil {
+			t.Fatalf("%s: tagging is off", c.platform)
+		}
+		if got := tag(c.in); got != c.want {
+			t.Errorf("%s %q: tag(%q) = %q, want %q", c.platform, c.campaign, c.in, got, c.want)
+		}
+	}
+
+	link, text := " https://shop.com/p ", "see https://shop.com/p. and (https://blog.com/a), or https://youtube.com/x"
+	TagLinks("instagram", "", []*string{&link}, []*string{&text})
+	if link != "https://shop.com/p?utm_source=instagram&utm_medium=social" {
+		t.Errorf("link field: %q", link)
+	}
+	want := "see https://shop.com/p?utm_source=instagram&utm_medium=social. and (https://blog.com/a?utm_source=instagram&utm_medium=social), or https://youtube.com/x"
+	if text != want {
+		t.Errorf("text field:\n got %q\nwant %q", text, want)
+	}
+}
+
+func TestSaveUTMRejectsBadDomains(t *testing.T) {
+	t.Setenv("DataDir", t.TempDir())
+	for _, d := range []string{"https://x.com", "x.com/path", "", "a b.com"} {
+		if _, err := SaveUTM(UTMConfig{Exclude: []string{d}}); err == nil {
+			t.Errorf("exclude %q was accepted", d)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package media
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image/png"
+	"os"
+	"path"
+	"strings"
+)
+
+// platforms like YouTube only take video, so a podcast episode (an mp3) is turned into one: the cover image
+// is shown for the whole episode, fitted on black, optionally with a waveform of the audio along the bottom.
+// the video is made at the size of the platform's transcode profile (1920x1080 without one) and is a rendition
+// of the audio, made once per cover, size and waveform setting.
+//
+// a post asks for this by sending an audio media id with a "cover_image".
+
+// ErrNoCover is returned when audio is published to a platform that only takes video and no cover was given.
+var ErrNoCover = errors.New("a cover image is needed to publish audio as video")
+
+// ErrInvalidCover is returned when the cover is not an image the pipeline can read.
+var ErrInvalidCover = errors.New("the cover must be a PNG, JPEG, WebP, BMP or TIFF image (or HEIC when ffmpeg is installed)")
+
+// audioVideoArgs are the ffmpeg options that put the cover (input 0, looped) over the audio (input 1) in a w x h video.
+func audioVideoArgs(w int, h int, waveform bool) []string {
+	background := fmt.Sprintf("[0:v]scale=%d:%d:force_original_aspect_ratio=decrease:force_divisible_by=2,pad=%d:%d:(ow-iw)/2:(oh-ih)/2:black,setsar=1", w, h, w, h)
+	filter := background + ",format=yuv420p[v]"
+	tune := "stillimage"
+	if waveform {
+		filter = fmt.Sprintf("%s[bg];[1:a]showwaves=s=%dx%d:mode=cline:colors=white:rate=25,format=rgba[wave];[bg][wave]overlay=0:H-h-%d:shortest=1,format=yuv420p[v]",
+			background, w, h/6, h/20)
+		tune = "film"
+	}
+	return []string{
+		"-filter_complex", filter,
+		"-map", "[v]", "-map", "1:a:0",
+		"-c:v", "libx264", "-preset", "medium", "-tune", tune, "-crf", "23",
+		"-c:a", "aac", "-b:a", "192k", "-ar", "48000",
+		"-shortest", "-movflags", "+faststart", "-f", "mp4",
+	}
+}
+
+// RenderAudio returns the audio with the given id as a video for platform, showing the cover image (a media id),
+// making it if it does not exist yet.
+func RenderAudio(ctx context.Context, id string, coverID string, waveform bool, platform string) (Item, error) {
+	src, err := Get(id)
+	if err != nil {
+		return Item{}, err
+	}
+	if src.Kind != "audio" {
+		return Item{}, ErrNotTranscodable
+	}
+	if coverID == "" {
+		return Item{}, ErrNoCover
+	}
+	cover, err := Get(coverID)
+	if err != nil {
+		return Item{}, err
+	}
+	if cover.Kind != "image" || !convertible(cover.MimeType) {
+		return Item{}, ErrInvalidCover
+	}
+
+	w, h := 1920, 1080
+	if profile, ok := Profiles[platform]; ok {
+		w, h = profile.Width, profile.Height
+	}
+	args := audioVideoArgs(w, h, waveform)
+	sum := sha256.Sum256([]byte(cover.Checksum + "\x00" + strings.Join(args, "\x00")))
+	key := "video@" + hex.EncodeToString(sum[:4])
+	name := strings.TrimSuffix(src.OriginalName, path.Ext(src.OriginalName)) + ".mp4"
+
+	return derive(ctx, src, key, name, func(ctx context.Context, input string, output string) error {
+		// the cover goes through Go first so it is upright and in a format ffmpeg surely reads.
+		coverPath, err := uprightPNG(ctx, cover)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(coverPath)
+		return runFFmpegWith(ctx, []string{"-loop", "1", "-framerate", "25", "-i", coverPath}, input, append(args, output))
+	})
+}
+
+// uprightPNG writes an image item, turned upright, to a PNG in the staging directory and returns its path.
+func uprightPNG(ctx context.Context, item Item) (string, error) {
+	local, cleanup, err := LocalFile(ctx, item)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+	img, err := decodeUpright(ctx, local)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := StagingPath()
+	if err != nil {
+		return "", err
+	}
+	out += ".png"
+	f, err := os.Create(out)
+	if err != nil {
+		return "", err
+	}
+	err = png.Encode(f, img)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(out)
+		return "", err
+	}
+	return out, nil
+}
+
+// AsVideo describes what an audio item becomes once rendered with a cover, for checking it against platform rules.
+func AsVideo(item Item) Item {
+	if item.Kind != "audio" {
+		return item
+	}
+	item.Kind = "video"
+	item.MimeType = "video/mp4"
+	return item
+}
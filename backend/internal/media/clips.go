@@ -0,0 +1,116 @@
+package media
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// short vertical excerpts (Reels, Shorts) are cut from a long video with ffmpeg: the part between start and end is
+// re-encoded as a 1080x1920 (9:16) mp4. wide footage is fitted into the frame with one of three strategies:
+//
+//	center     fill the frame and crop the sides, around the focal point (the item's focus, or the center)
+//	letterbox  fit the whole picture in and fill the rest with black
+//	blur       fit the whole picture in over a blurred, zoomed copy of itself
+//
+// a clip is a rendition of the video it was cut from, so it has its own media id to post, is only made once
+// and goes away with the original.
+
+const (
+	clipWidth  = 1080
+	clipHeight = 1920
+	// maxClipLength is YouTube Shorts' limit, the longest of the short-form platforms.
+	maxClipLength = 180
+)
+
+// ClipStrategies are the ways a clip can be fitted into 9:16.
+var ClipStrategies = []string{"center", "letterbox", "blur"}
+
+// ErrInvalidClip is returned for a clip that does not fit inside the video, or is too long.
+var ErrInvalidClip = fmt.Errorf("start and end must be within the video, end after start, and the clip at most %ds long", maxClipLength)
+
+// ErrUnknownStrategy is returned for a strategy that is not in ClipStrategies.
+var ErrUnknownStrategy = errors.New("strategy must be one of " + strings.Join(ClipStrategies, ", "))
+
+// Clip describes a vertical excerpt.
+type Clip struct {
+	Start    float64 `json:"start"` // seconds
+	End      float64 `json:"end"`
+	Strategy string  `json:"strategy"`        // default "center"
+	Focus    *Point  `json:"focus,omitempty"` // center only, overrides the item's focal point
+}
+
+// filter returns the ffmpeg filtergraph that turns the input video into a 9:16 frame labelled [v].
+func (c Clip) filter(focus Point) string {
+	fill := fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase", clipWidth, clipHeight)
+	fit := fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease:force_divisible_by=2", clipWidth, clipHeight)
+	switch c.Strategy {
+	case "letterbox":
+		return fmt.Sprintf("[0:v]%s,pad=%d:%d:(ow-iw)/2:(oh-ih)/2:black,setsar=1[v]", fit, clipWidth, clipHeight)
+	case "blur":
+		return fmt.Sprintf("[0:v]split[bg][fg];[bg]%s,crop=%d:%d,boxblur=20:2[blurred];[fg]%s[fitted];[blurred][fitted]overlay=(W-w)/2:(H-h)/2,setsar=1[v]",
+			fill, clipWidth, clipHeight, fit)
+	default:
+		return fmt.Sprintf("[0:v]%s,crop=%d:%d:(iw-%d)*%.3f:(ih-%d)*%.3f,setsar=1[v]",
+			fill, clipWidth, clipHeight, clipWidth, focus.X, clipHeight, focus.Y)
+	}
+}
+
+// seconds formats a time for ffmpeg and for names.
+func seconds(t float64) string {
+	return strconv.FormatFloat(math.Round(t*1000)/1000, 'f', -1, 64)
+}
+
+// MakeClip cuts a vertical clip out of the video with the given id, or returns it if it was made before.
+func MakeClip(ctx context.Context, id string, clip Clip) (Item, error) {
+	src, err := Get(id)
+	if err != nil {
+		return Item{}, err
+	}
+	if src.Kind != "video" {
+		return Item{}, ErrNotTranscodable
+	}
+	if clip.Strategy == "" {
+		clip.Strategy = "center"
+	}
+	if !contains(ClipStrategies, clip.Strategy) {
+		return Item{}, ErrUnknownStrategy
+	}
+	if clip.Start < 0 || clip.End <= clip.Start || clip.End-clip.Start > maxClipLength || (src.Duration > 0 && clip.End > src.Duration+0.5) {
+		return Item{}, ErrInvalidClip
+	}
+
+	focus := center
+	if src.Focus != nil {
+		focus = *src.Focus
+	}
+	if clip.Focus != nil {
+		focus = *clip.Focus
+	}
+	if !focus.valid() {
+		return Item{}, ErrInvalidFocus
+	}
+
+	args := []string{
+		"-t", seconds(clip.End - clip.Start),
+		"-filter_complex", clip.filter(focus),
+		"-map", "[v]", "-map", "0:a:0?",
+		"-c:v", "libx264", "-preset", "medium", "-profile:v", "high", "-pix_fmt", "yuv420p", "-crf", "21",
+		"-c:a", "aac", "-b:a", "128k", "-ar", "48000", "-ac", "2",
+		"-movflags", "+faststart", "-f", "mp4",
+	}
+	sum := sha256.Sum256([]byte(seconds(clip.Start) + "\x00" + strings.Join(args, "\x00")))
+	key := "clip@" + hex.EncodeToString(sum[:4])
+	name := fmt.Sprintf("%s-clip-%ss-%ss.mp4", strings.TrimSuffix(src.OriginalName, path.Ext(src.OriginalName)), seconds(clip.Start), seconds(clip.End))
+
+	return derive(ctx, src, key, name, func(ctx context.Context, input string, output string) error {
+		// -ss before the input seeks fast, the re-encode makes the cut exact anyway.
+		return runFFmpegWith(ctx, []string{"-ss", seconds(clip.Start)}, input, append(args, output))
+	})
+}
@@ -0,0 +1,262 @@
+package media
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// the compliance checker compares a media item with what each platform accepts, so a bad file is caught
+// before anything is sent instead of after a failed upload. every violation says how to fix it, and whether
+// the publish pipeline fixes it by itself (videos are transcoded, images converted, see transcode.go and images.go).
+// PostContent refuses a post while any violation is left that the pipeline cannot fix.
+//
+// checks that need information we do not have (the duration of a video when ffprobe is missing) are skipped.
+
+// Rule is what a platform accepts for one kind of media. Zero values are not checked.
+type Rule struct {
+	Formats      []string `json:"formats"` // mime types
+	MaxSize      int64    `json:"max_size,omitempty"`
+	MinWidth     int      `json:"min_width,omitempty"`
+	MaxWidth     int      `json:"max_width,omitempty"`
+	MinAspect    float64  `json:"min_aspect,omitempty"` // width / height
+	MaxAspect    float64  `json:"max_aspect,omitempty"`
+	MinDuration  float64  `json:"min_duration,omitempty"` // seconds
+	MaxDuration  float64  `json:"max_duration,omitempty"`
+	MaxFrameRate float64  `json:"max_frame_rate,omitempty"`
+}
+
+var videoFormats = []string{"video/mp4", "video/quicktime"}
+
+// PlatformRules holds, per platform, the rule for each kind of media it accepts. A kind that is missing is not accepted.
+var PlatformRules = map[string]map[string]Rule{
+	"instagram": {
+		"image": {Formats: []string{"image/jpeg"}, MaxSize: 8 << 20, MinWidth: 320, MaxWidth: 1440, MinAspect: 4.0 / 5, MaxAspect: 1.91},
+		"video": {Formats: videoFormats, MaxSize: 1 << 30, MaxWidth: 1920, MinAspect: 0.5, MaxAspect: 1.91, MinDuration: 3, MaxDuration: 90, MaxFrameRate: 60},
+	},
+	"youtube": {
+		"video": {Formats: []string{"video/mp4", "video/quicktime", "video/webm", "video/x-msvideo", "video/x-matroska", "video/mpeg"}, MaxSize: 256 << 30, MaxDuration: 12 * 60 * 60, MaxFrameRate: 60},
+	},
+	"pinterest": {
+		"image": {Formats: []string{"image/jpeg", "image/png"}, MaxSize: 20 << 20, MinAspect: 1 / 3.5, MaxAspect: 1.91},
+		"video": {Formats: videoFormats, MaxSize: 2 << 30, MinAspect: 0.5, MaxAspect: 1.91, MinDuration: 4, MaxDuration: 15 * 60},
+	},
+	"linkedin": {
+		"image": {Formats: []string{"image/jpeg", "image/png", "image/gif"}, MaxSize: 5 << 20, MinAspect: 1 / 2.4, MaxAspect: 2.4},
+		"video": {Formats: []string{"video/mp4"}, MaxSize: 5 << 30, MinAspect: 1 / 2.4, MaxAspect: 2.4, MinDuration: 3, MaxDuration: 30 * 60, MaxFrameRate: 60},
+	},
+	"reddit": {
+		"image": {Formats: []string{"image/jpeg", "image/png", "image/gif"}, MaxSize: 20 << 20},
+		"video": {Formats: videoFormats, MaxSize: 1 << 30, MaxDuration: 15 * 60},
+	},
+}
+
+// aspectOK reports whether the rule takes the aspect ratio (width / height), give or take rounding.
+func (r Rule) aspectOK(aspect float64) bool {
+	return (r.MinAspect == 0 || aspect >= r.MinAspect-0.01) && (r.MaxAspect == 0 || aspect <= r.MaxAspect+0.01)
+}
+
+// Violation is one way a media item breaks a platform's rules.
+type Violation struct {
+	Rule    string `json:"rule"` // "kind", "format", "size", "resolution", "aspect_ratio", "duration" or "frame_rate"
+	Message string `json:"message"`
+	Fix     string `json:"fix"`
+	AutoFix bool   `json:"auto_fix"` // the publish pipeline takes care of it
+}
+
+// Report is the outcome of checking one item against one platform.
+type Report struct {
+	Platform   string      `json:"platform"`
+	OK         bool        `json:"ok"` // nothing is left that the pipeline cannot fix
+	Violations []Violation `json:"violations"`
+}
+
+// Check reports every way item breaks the rules of platform.
+func Check(item Item, platform string) Report {
+	report := Report{Platform: platform, OK: true, Violations: []Violation{}}
+	add := func(v Violation) {
+		report.Violations = append(report.Violations, v)
+		if !v.AutoFix {
+			report.OK = false
+		}
+	}
+
+	rules, ok := PlatformRules[platform]
+	if !ok {
+		add(Violation{Rule: "kind", Message: platform + " does not take media uploads", Fix: "remove the media or the platform"})
+		return report
+	}
+	rule, ok := rules[item.Kind]
+	if !ok {
+		fix := "upload " + strings.Join(acceptedKinds(rules), " or ") + " instead"
+		if _, ok := rules["video"]; ok && item.Kind == "audio" {
+			fix += ", or send a cover_image with the post to publish the audio as a video"
+		}
+		add(Violation{
+			Rule:    "kind",
+			Message: fmt.Sprintf("%s does not accept %s files", platform, item.Kind),
+			Fix:     fix,
+		})
+		return report
+	}
+
+	// whether the rendition or variant made for this platform would fix format, size and shape problems.
+	converts := false
+	switch item.Kind {
+	case "video":
+		_, hasProfile := Profiles[platform]
+		_, err := exec.LookPath(ffmpegPath())
+		converts = hasProfile && err == nil
+	case "image":
+		_, hasProfile := ImageProfiles[platform]
+		converts = hasProfile && convertible(item.MimeType)
+	}
+
+	if len(rule.Formats) > 0 && !contains(rule.Formats, item.MimeType) {
+		add(Violation{
+			Rule:    "format",
+			Message: fmt.Sprintf("%s is not accepted, %s takes %s", item.MimeType, platform, strings.Join(rule.Formats, ", ")),
+			Fix:     "convert the file to " + rule.Formats[0],
+			AutoFix: converts,
+		})
+	}
+	if rule.MaxSize > 0 && item.Size > rule.MaxSize {
+		add(Violation{
+			Rule:    "size",
+			Message: fmt.Sprintf("file is %s, the limit is %s", formatBytes(item.Size), formatBytes(rule.MaxSize)),
+			Fix:     "compress the file or lower its resolution",
+			AutoFix: converts,
+		})
+	}
+
+	if item.Width > 0 && item.Height > 0 {
+		if rule.MinWidth > 0 && item.Width < rule.MinWidth {
+			add(Violation{
+				Rule:    "resolution",
+				Message: fmt.Sprintf("width is %dpx, at least %dpx is needed", item.Width, rule.MinWidth),
+				Fix:     "use a larger original, upscaling is not done automatically",
+			})
+		}
+		if rule.MaxWidth > 0 && item.Width > rule.MaxWidth {
+			add(Violation{
+				Rule:    "resolution",
+				Message: fmt.Sprintf("width is %dpx, at most %dpx is allowed", item.Width, rule.MaxWidth),
+				Fix:     fmt.Sprintf("scale the file down to %dpx wide", rule.MaxWidth),
+				AutoFix: converts,
+			})
+		}
+
+		aspect := float64(item.Width) / float64(item.Height)
+		if !rule.aspectOK(aspect) {
+			// only profiles that crop change the shape, the others scale the whole frame.
+			crops := false
+			if converts {
+				switch item.Kind {
+				case "video":
+					p := Profiles[platform]
+					crops = p.Crop && rule.aspectOK(float64(p.Width)/float64(p.Height))
+				case "image":
+					crops = rule.aspectOK(ImageProfiles[platform].targetAspect(aspect))
+				}
+			}
+			add(Violation{
+				Rule:    "aspect_ratio",
+				Message: fmt.Sprintf("aspect ratio is %s, %s takes %s to %s", formatAspect(aspect), platform, formatAspect(rule.MinAspect), formatAspect(rule.MaxAspect)),
+				Fix:     "crop the file to a supported aspect ratio (set a focal point to choose what is kept)",
+				AutoFix: crops,
+			})
+		}
+	}
+
+	if item.Duration > 0 {
+		if rule.MinDuration > 0 && item.Duration < rule.MinDuration {
+			add(Violation{
+				Rule:    "duration",
+				Message: fmt.Sprintf("video is %.1fs long, at least %.0fs is needed", item.Duration, rule.MinDuration),
+				Fix:     "use a longer clip",
+			})
+		}
+		if rule.MaxDuration > 0 && item.Duration > rule.MaxDuration {
+			// cutting a video short is never done silently.
+			add(Violation{
+				Rule:    "duration",
+				Message: fmt.Sprintf("video is %s long, %s allows %s", formatDuration(item.Duration), platform, formatDuration(rule.MaxDuration)),
+				Fix:     fmt.Sprintf("trim the video to %s or less", formatDuration(rule.MaxDuration)),
+			})
+		}
+	}
+
+	if rule.MaxFrameRate > 0 && item.FrameRate > rule.MaxFrameRate+0.5 {
+		add(Violation{
+			Rule:    "frame_rate",
+			Message: fmt.Sprintf("frame rate is %.2f fps, at most %.0f fps is allowed", item.FrameRate, rule.MaxFrameRate),
+			Fix:     fmt.Sprintf("re-encode the video at %.0f fps or less", rule.MaxFrameRate),
+			AutoFix: converts,
+		})
+	}
+	return report
+}
+
+// CheckAll checks the item with the given id against every platform.
+func CheckAll(id string, platforms []string) (map[string]Report, error) {
+	item, err := Get(id)
+	if err != nil {
+		return nil, err
+	}
+	reports := map[string]Report{}
+	for _, platform := range platforms {
+		reports[platform] = Check(item, platform)
+	}
+	return reports, nil
+}
+
+func acceptedKinds(rules map[string]Rule) []string {
+	kinds := []string{}
+	for _, kind := range []string{"image", "video", "audio"} {
+		if _, ok := rules[kind]; ok {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	default:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+}
+
+func formatAspect(a float64) string {
+	if a == 0 {
+		return "any"
+	}
+	if a < 1 {
+		return fmt.Sprintf("1:%.2g", 1/a)
+	}
+	return fmt.Sprintf("%.3g:1", a)
+}
+
+func formatDuration(seconds float64) string {
+	if seconds < 60 {
+		return fmt.Sprintf("%.0fs", seconds)
+	}
+	s := int(seconds + 0.5)
+	if s%60 == 0 {
+		return fmt.Sprintf("%dm", s/60)
+	}
+	return fmt.Sprintf("%dm%02ds", s/60, s%60)
+}
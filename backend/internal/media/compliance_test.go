@@ -0,0 +1,63 @@
+package media
+
+import (
+	"testing"
+)
+
+func TestProfilesAgreeWithRules(t *testing.T) {
+	for platform, profile := range Profiles {
+		rule, ok := PlatformRules[platform]["video"]
+		if !ok {
+			t.Errorf("%s has a video profile but no video rule", platform)
+			continue
+		}
+		if profile.MaxDuration != 0 && profile.MaxDuration != rule.MaxDuration {
+			t.Errorf("%s: profile cuts at %vs, the rule allows %vs", platform, profile.MaxDuration, rule.MaxDuration)
+		}
+		if profile.Crop && !rule.aspectOK(float64(profile.Width)/float64(profile.Height)) {
+			t.Errorf("%s: profile crops to an aspect ratio the rule refuses", platform)
+		}
+	}
+}
+
+func TestCheckAspectAutoFix(t *testing.T) {
+	t.Setenv("FFmpegPath", "/bin/true") // transcoding is available
+
+	aspectFix := func(item Item, platform string) (found bool, autoFix bool) {
+		for _, v := range Check(item, platform).Violations {
+			if v.Rule == "aspect_ratio" {
+				return true, v.AutoFix
+			}
+		}
+		return false, false
+	}
+
+	cases := []struct {
+		name     string
+		item     Item
+		platform string
+		autoFix  bool
+	}{
+		// instagram's video profile crops to 9:16.
+		{"wide video on instagram", Item{Kind: "video", MimeType: "video/mp4", Width: 3000, Height: 1000}, "instagram", true},
+		// pinterest and linkedin scale the whole frame, a 3:1 video stays 3:1.
+		{"wide video on pinterest", Item{Kind: "video", MimeType: "video/mp4", Width: 3000, Height: 1000}, "pinterest", false},
+		{"wide video on linkedin", Item{Kind: "video", MimeType: "video/mp4", Width: 3000, Height: 1000}, "linkedin", false},
+		// images are cropped into the platform's window.
+		{"tall image on instagram", Item{Kind: "image", MimeType: "image/jpeg", Width: 1000, Height: 3000}, "instagram", true},
+		{"wide image on pinterest", Item{Kind: "image", MimeType: "image/jpeg", Width: 3000, Height: 1000}, "pinterest", true},
+		{"wide image on linkedin", Item{Kind: "image", MimeType: "image/jpeg", Width: 3000, Height: 1000}, "linkedin", true},
+		// a GIF is never converted.
+		{"wide gif on linkedin", Item{Kind: "image", MimeType: "image/gif", Width: 3000, Height: 1000}, "linkedin", false},
+	}
+	for _, c := range cases {
+		found, autoFix := aspectFix(c.item, c.platform)
+		if !found {
+			t.Errorf("%s: no aspect_ratio violation", c.name)
+			continue
+		}
+		if autoFix != c.autoFix {
+			t.Errorf("%s: auto_fix = %v, want %v", c.name, autoFix, c.autoFix)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+)
+
+// phones store photos the way the sensor saw them and put the way to turn them upright in the EXIF orientation tag.
+// readOrientation finds that tag (JPEG, TIFF and WebP), orient applies it before an image is cropped or resized.
+
+// maxExifScan is how far into a file we look for EXIF data.
+const maxExifScan = 256 << 10
+
+// readOrientation returns the EXIF orientation (1 to 8) of the image in r, 1 if it has none.
+func readOrientation(r io.ReadSeeker) int {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 1
+	}
+	head, err := io.ReadAll(io.LimitReader(r, maxExifScan))
+	if err != nil {
+		return 1
+	}
+
+	var tiff []byte
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8}):
+		tiff = jpegExif(head)
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		tiff = head
+	case len(head) >= 12 && string(head[0:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		tiff = webpExif(head)
+	}
+	if o := tiffOrientation(tiff); o >= 1 && o <= 8 {
+		return o
+	}
+	return 1
+}
+
+// jpegExif returns the TIFF structure inside a JPEG's APP1 Exif segment.
+func jpegExif(b []byte) []byte {
+	for i := 2; i+4 <= len(b); {
+		if b[i] != 0xFF {
+			return nil
+		}
+		marker := b[i+1]
+		if marker == 0xD8 || (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01 {
+			i += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			return nil // image data starts, no EXIF before it
+		}
+		length := int(binary.BigEndian.Uint16(b[i+2 : i+4]))
+		end := i + 2 + length
+		if length < 2 || end > len(b) {
+			return nil
+		}
+		segment := b[i+4 : end]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+		i = end
+	}
+	return nil
+}
+
+// webpExif returns the TIFF structure inside a WebP's EXIF chunk.
+func webpExif(b []byte) []byte {
+	for i := 12; i+8 <= len(b); {
+		size := int(binary.LittleEndian.Uint32(b[i+4 : i+8]))
+		end := i + 8 + size
+		if end > len(b) || size < 0 {
+			return nil
+		}
+		if string(b[i:i+4]) == "EXIF" {
+			return bytes.TrimPrefix(b[i+8:end], []byte("Exif\x00\x00"))
+		}
+		i = end + size%2 // chunks are padded to an even size
+	}
+	return nil
+}
+
+// tiffOrientation reads tag 0x0112 from the first IFD of a TIFF structure, 0 if it is not there.
+func tiffOrientation(b []byte) int {
+	if len(b) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(b[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(b[4:8]))
+	if ifd < 8 || ifd+2 > len(b) {
+		return 0
+	}
+	count := int(order.Uint16(b[ifd : ifd+2]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(b) {
+			return 0
+		}
+		if order.Uint16(b[entry:entry+2]) == 0x0112 {
+			return int(order.Uint16(b[entry+8 : entry+10]))
+		}
+	}
+	return 0
+}
+
+// orient turns img upright according to an EXIF orientation.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	// for every pixel of the upright image, where it comes from in the stored one.
+	source := func(x, y int) (int, int) {
+		switch orientation {
+		case 2:
+			return w - 1 - x, y
+		case 3:
+			return w - 1 - x, h - 1 - y
+		case 4:
+			return x, h - 1 - y
+		case 5:
+			return y, x
+		case 6:
+			return y, h - 1 - x
+		case 7:
+			return w - 1 - y, h - 1 - x
+		default: // 8
+			return w - 1 - y, x
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			sx, sy := source(x, y)
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,315 @@
+package media
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"golang.org/x/image/draw"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// images get the same treatment as video (transcode.go), in pure Go: the original is decoded, turned upright, cropped to the
+// aspect ratio the platform wants around the item's focal point, scaled down to the platform's maximum size
+// and re-encoded, usually as JPEG. every variant is a rendition of the original, made once and reused.
+//
+// PNG, JPEG, GIF, WebP, BMP and TIFF are read in Go. there is no HEIC (iPhone photos) decoder in pure Go, so those are
+// turned into a PNG with ffmpeg first (it needs a build with HEIF support, 7.0 or newer) and go on from there like any
+// other image; without ffmpeg they have to be exported as JPEG before uploading. GIFs are left alone, converting them
+// would drop the animation.
+
+// maxImagePixels is the largest image decoded, a few bytes of PNG can claim to be 50000x50000.
+const maxImagePixels = 50_000_000
+
+// ErrImageTooLarge is returned for images over maxImagePixels.
+var ErrImageTooLarge = fmt.Errorf("images can be at most %d megapixels", maxImagePixels/1_000_000)
+
+// ErrInvalidFocus is returned for a focal point outside the image.
+var ErrInvalidFocus = errors.New("focus x and y must be between 0 and 1")
+
+// UnsupportedImageError is returned for images the pipeline cannot decode.
+type UnsupportedImageError struct {
+	MimeType string
+}
+
+func (e *UnsupportedImageError) Error() string {
+	if heic(e.MimeType) {
+		return "HEIC images are converted with ffmpeg, which is not installed; install it, or export the image as JPEG or PNG and upload it again"
+	}
+	return fmt.Sprintf("cannot convert %s images", e.MimeType)
+}
+
+// Point is a position in an image, as fractions of its width and height. {0.5, 0.5} is the center.
+type Point struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+func (p Point) valid() bool {
+	return p.X >= 0 && p.X <= 1 && p.Y >= 0 && p.Y <= 1
+}
+
+var center = Point{X: 0.5, Y: 0.5}
+
+// ImageProfile describes the images a platform accepts.
+type ImageProfile struct {
+	MaxWidth  int     `json:"max_width"`
+	MaxHeight int     `json:"max_height"`
+	Aspect    float64 `json:"aspect,omitempty"`     // width / height the image is cropped to, 0 to keep it
+	MinAspect float64 `json:"min_aspect,omitempty"` // without Aspect, narrower images are cropped to this
+	MaxAspect float64 `json:"max_aspect,omitempty"` // and wider ones to this
+	Format    string  `json:"format"`               // "jpeg" or "png"
+	Quality   int     `json:"quality,omitempty"`    // jpeg quality
+}
+
+// ImageProfiles holds the image profile of every platform that takes images.
+// youtube only takes images as video thumbnails.
+var ImageProfiles = map[string]ImageProfile{
+	"instagram": {MaxWidth: 1080, MaxHeight: 1350, MinAspect: 4.0 / 5, MaxAspect: 1.91, Format: "jpeg", Quality: 90},
+	"pinterest": {MaxWidth: 1000, MaxHeight: 1500, Aspect: 2.0 / 3, Format: "jpeg", Quality: 90},
+	"youtube":   {MaxWidth: 1280, MaxHeight: 720, Aspect: 16.0 / 9, Format: "jpeg", Quality: 90},
+	"linkedin":  {MaxWidth: 1920, MaxHeight: 1920, MinAspect: 1 / 2.4, MaxAspect: 2.4, Format: "jpeg", Quality: 90},
+	"reddit":    {MaxWidth: 3840, MaxHeight: 3840, Format: "jpeg", Quality: 90},
+}
+
+// targetAspect is the aspect ratio an image with the given one is cropped to.
+func (p ImageProfile) targetAspect(current float64) float64 {
+	switch {
+	case p.Aspect > 0:
+		return p.Aspect
+	case p.MinAspect > 0 && current < p.MinAspect:
+		return p.MinAspect
+	case p.MaxAspect > 0 && current > p.MaxAspect:
+		return p.MaxAspect
+	}
+	return current
+}
+
+// cropRect returns the largest rectangle of bounds with the profile's aspect ratio, as close to centered on focus as it can be.
+func (p ImageProfile) cropRect(bounds image.Rectangle, focus Point) image.Rectangle {
+	w, h := bounds.Dx(), bounds.Dy()
+	current := float64(w) / float64(h)
+	target := p.targetAspect(current)
+	if target == current {
+		return bounds
+	}
+
+	cw, ch := w, h
+	if current > target {
+		cw = int(math.Round(float64(h) * target))
+	} else {
+		ch = int(math.Round(float64(w) / target))
+	}
+	x := clamp(int(math.Round(focus.X*float64(w)-float64(cw)/2)), 0, w-cw)
+	y := clamp(int(math.Round(focus.Y*float64(h)-float64(ch)/2)), 0, h-ch)
+	return image.Rect(bounds.Min.X+x, bounds.Min.Y+y, bounds.Min.X+x+cw, bounds.Min.Y+y+ch)
+}
+
+// outputSize scales w x h down (never up) to fit the profile's maximum.
+func (p ImageProfile) outputSize(w int, h int) (int, int) {
+	scale := math.Min(1, math.Min(float64(p.MaxWidth)/float64(w), float64(p.MaxHeight)/float64(h)))
+	return max(1, int(math.Round(float64(w)*scale))), max(1, int(math.Round(float64(h)*scale)))
+}
+
+func (p ImageProfile) extension() string {
+	if p.Format == "png" {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+func clamp(v int, lo int, hi int) int {
+	return max(lo, min(v, hi))
+}
+
+// render turns upright, crops, scales and encodes the image at input into output.
+func (p ImageProfile) render(ctx context.Context, input string, output string, focus Point) error {
+	src, err := decodeUpright(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	crop := p.cropRect(src.Bounds(), focus)
+	w, h := p.outputSize(crop.Dx(), crop.Dy())
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	if p.Format != "png" {
+		// jpeg has no transparency, put transparent areas on white instead of black.
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	}
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Over, nil)
+
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if p.Format == "png" {
+		err = png.Encode(out, dst)
+	} else {
+		err = jpeg.Encode(out, dst, &jpeg.Options{Quality: p.Quality})
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// convertible reports whether the pipeline should make variants of an image of this type.
+func convertible(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/webp", "image/bmp", "image/tiff":
+		return true
+	}
+	if heic(mimeType) {
+		_, err := exec.LookPath(ffmpegPath())
+		return err == nil
+	}
+	return false
+}
+
+func heic(mimeType string) bool {
+	return mimeType == "image/heic" || mimeType == "image/heif"
+}
+
+// decodeUpright decodes the image at path and applies its EXIF orientation. formats Go cannot read (HEIC) are
+// decoded through ffmpeg.
+func decodeUpright(ctx context.Context, path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := checkPixels(f); errors.Is(err, image.ErrFormat) {
+		return decodeWithFFmpeg(ctx, path)
+	} else if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	return orient(img, readOrientation(f)), nil
+}
+
+// checkPixels reads the size from the image's header and refuses anything over maxImagePixels, before decoding
+// allocates it. r is rewound for the decoder.
+func checkPixels(r io.ReadSeeker) error {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > maxImagePixels {
+		return ErrImageTooLarge
+	}
+	_, err = r.Seek(0, io.SeekStart)
+	return err
+}
+
+// decodeWithFFmpeg has ffmpeg write the image at path as a PNG and decodes that. ffmpeg assembles the tiles of a
+// HEIC image and applies its rotation itself, so the result is already upright.
+func decodeWithFFmpeg(ctx context.Context, path string) (image.Image, error) {
+	out, err := StagingPath()
+	if err != nil {
+		return nil, err
+	}
+	out += ".png"
+	defer os.Remove(out)
+
+	if err := runFFmpeg(ctx, path, []string{"-frames:v", "1", "-c:v", "png", "-f", "image2", out}); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(out)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := checkPixels(f); err != nil {
+		return nil, err
+	}
+	return png.Decode(f)
+}
+
+// ImageVariant returns the variant of the image with the given id for platform, making it if it does not exist yet.
+// focus overrides the item's focal point for this variant, nil uses the item's own (or the center).
+func ImageVariant(ctx context.Context, id string, platform string, focus *Point) (Item, error) {
+	src, err := Get(id)
+	if err != nil {
+		return Item{}, err
+	}
+	if src.Kind != "image" {
+		return Item{}, ErrNotTranscodable
+	}
+	profile, ok := ImageProfiles[platform]
+	if !ok {
+		return Item{}, ErrUnknownProfile
+	}
+	if !convertible(src.MimeType) {
+		return Item{}, &UnsupportedImageError{MimeType: src.MimeType}
+	}
+
+	point := center
+	if src.Focus != nil {
+		point = *src.Focus
+	}
+	if focus != nil {
+		point = *focus
+	}
+	if !point.valid() {
+		return Item{}, ErrInvalidFocus
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%+v %+v", profile, point)))
+	key := platform + "@" + hex.EncodeToString(sum[:4])
+	name := strings.TrimSuffix(src.OriginalName, path.Ext(src.OriginalName)) + "-" + platform + profile.extension()
+	return derive(ctx, src, key, name, func(ctx context.Context, input string, output string) error {
+		return profile.render(ctx, input, output, point)
+	})
+}
+
+// SetFocus stores the focal point crops of an image are centered on.
+func SetFocus(id string, focus Point) (Item, error) {
+	if !focus.valid() {
+		return Item{}, ErrInvalidFocus
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	item, ok := items[id]
+	if !ok || item.Deleted {
+		return Item{}, ErrNotFound
+	}
+	item.Focus = &focus
+	return item.copy(), save()
+}
+
+// ForPlatform returns the item to publish to platform: a transcoded rendition for video, a converted variant
+// for images, and the item itself for anything else (or a GIF, or a platform without a profile).
+func ForPlatform(ctx context.Context, item Item, platform string) (Item, error) {
+	switch {
+	case item.Kind == "video":
+		if _, ok := Profiles[platform]; ok {
+			return Transcode(ctx, item.ID, platform)
+		}
+	case item.Kind == "image" && item.MimeType != "image/gif":
+		if _, ok := ImageProfiles[platform]; ok {
+			return ImageVariant(ctx, item.ID, platform, nil)
+		}
+	}
+	return item, nil
+}
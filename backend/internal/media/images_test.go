@@ -0,0 +1,157 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fakeTool writes a shell script standing in for ffmpeg or ffprobe and returns its path. it needs /bin/sh.
+func fakeTool(t *testing.T, dir string, name string, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake tools are shell scripts")
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// box builds an ISO media box.
+func box(kind string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	b := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(b, kind...), body...)
+}
+
+func ispe(w, h uint32) []byte {
+	b := make([]byte, 12)
+	binary.BigEndian.PutUint32(b[4:], w)
+	binary.BigEndian.PutUint32(b[8:], h)
+	return box("ispe", b)
+}
+
+func heicFile(rotate byte) []byte {
+	ftyp := box("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+	// a 512x512 tile, the 4032x3024 grid and a 320x240 thumbnail.
+	ipco := box("ipco", ispe(512, 512), ispe(4032, 3024), ispe(320, 240), box("irot", []byte{rotate}))
+	meta := box("meta", []byte{0, 0, 0, 0}, box("hdlr", make([]byte, 24)), box("iprp", ipco))
+	return append(ftyp, meta...)
+}
+
+func TestInspectHEICSize(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		rotate        byte
+		width, height int
+	}{
+		{0, 4032, 3024},
+		{1, 3024, 4032},
+		{2, 4032, 3024},
+	}
+	for _, c := range cases {
+		path := filepath.Join(dir, "photo.heic")
+		if err := os.WriteFile(path, heicFile(c.rotate), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := DetectType(heicFile(c.rotate)); got != "image/heic" {
+			t.Fatalf("DetectType = %q, want image/heic", got)
+		}
+		item := &Item{Kind: "image", MimeType: "image/heic"}
+		inspect(item, path)
+		if item.Width != c.width || item.Height != c.height {
+			t.Errorf("irot %d: size %dx%d, want %dx%d", c.rotate, item.Width, item.Height, c.width, c.height)
+		}
+	}
+}
+
+// ffmpeg is faked by a script that writes a known PNG to its output path (its last argument).
+func TestDecodeUprightFallsBackToFFmpeg(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DataDir", dir)
+
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	var decoded bytes.Buffer
+	if err := png.Encode(&decoded, img); err != nil {
+		t.Fatal(err)
+	}
+	pngPath := filepath.Join(dir, "decoded.png")
+	if err := os.WriteFile(pngPath, decoded.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("FFmpegPath", fakeTool(t, dir, "ffmpeg", "for last; do :; done\ncp '"+pngPath+"' \"$last\"\n"))
+
+	heicPath := filepath.Join(dir, "photo.heic")
+	if err := os.WriteFile(heicPath, heicFile(0), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if !convertible("image/heic") {
+		t.Fatal("HEIC is not convertible with ffmpeg installed")
+	}
+	got, err := decodeUpright(context.Background(), heicPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := got.Bounds(); b.Dx() != 4 || b.Dy() != 2 {
+		t.Errorf("decoded %v, want 4x2", b)
+	}
+	if r, _, _, _ := got.At(0, 0).RGBA(); r != 0xffff {
+		t.Errorf("pixel (0,0) red = %x, want ffff", r)
+	}
+
+	t.Setenv("FFmpegPath", filepath.Join(dir, "missing"))
+	if convertible("image/heic") {
+		t.Error("HEIC is convertible without ffmpeg")
+	}
+}
+
+// hugePNG is a real, tiny PNG whose header claims width x height.
+func hugePNG(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	// signature (8), IHDR length and type (8), then width and height, and the chunk's crc after its 13 bytes.
+	binary.BigEndian.PutUint32(b[16:], width)
+	binary.BigEndian.PutUint32(b[20:], height)
+	binary.BigEndian.PutUint32(b[29:], crc32.ChecksumIEEE(b[12:29]))
+	return b
+}
+
+func TestDecodeUprightRefusesHugeImages(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DataDir", dir)
+	t.Setenv("FFmpegPath", filepath.Join(dir, "missing"))
+
+	for _, c := range []struct {
+		width, height uint32
+		want          error
+	}{
+		{50000, 50000, ErrImageTooLarge},
+		{10000, 5001, ErrImageTooLarge},
+		{1, 1, nil},
+	} {
+		path := filepath.Join(dir, "huge.png")
+		if err := os.WriteFile(path, hugePNG(t, c.width, c.height), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := decodeUpright(context.Background(), path); !errors.Is(err, c.want) {
+			t.Errorf("%dx%d: %v, want %v", c.width, c.height, err, c.want)
+		}
+	}
+}
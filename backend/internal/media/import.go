@@ -0,0 +1,202 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// importing pulls a file that already lives somewhere on the web (a CDN, a bucket) into the library,
+// so it can be published like any upload. the remote file goes through the same checks as an upload:
+// it is sniffed, held to the limit for its kind and stored by content.
+//
+// settings, read from the environment (config/.env):
+//
+//	MediaImportTimeout       seconds the whole download may take (default 300)
+//	MediaImportAllowPrivate  "true" to allow fetching from localhost and private networks (off by default)
+
+// ErrInvalidImportURL is returned for anything but an absolute http(s) URL.
+var ErrInvalidImportURL = errors.New("url must be an absolute http or https URL")
+
+// ErrBlockedHost is returned when the URL points at this machine or a private network.
+var ErrBlockedHost = errors.New("url points at a private or local address")
+
+// UnsupportedTypeError is returned when the remote file is not an image, video or audio file.
+type UnsupportedTypeError struct {
+	MimeType string
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return fmt.Sprintf("unsupported media type %q, only images, video and audio can be imported", e.MimeType)
+}
+
+// RemoteError is returned when the remote server answers with something other than 2xx.
+type RemoteError struct {
+	StatusCode int
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("remote server responded with %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+const maxImportRedirects = 5
+
+func importTimeout() time.Duration {
+	if v := os.Getenv("MediaImportTimeout"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return time.Duration(n) * time.Second
+		}
+	}
+	return 300 * time.Second
+}
+
+func allowPrivateImports() bool {
+	return os.Getenv("MediaImportAllowPrivate") == "true"
+}
+
+// importable reports whether kind is something we publish.
+func importable(kind string) bool {
+	return kind == "image" || kind == "video" || kind == "audio"
+}
+
+// blockedNets are ranges net.IP has no method for: "this network" (0.0.0.0/8, which reaches the local host on linux)
+// and carrier-grade NAT (100.64.0.0/10, shared address space that is internal to providers and some clouds).
+var blockedNets = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),
+	mustParseCIDR("100.64.0.0/10"),
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// blockedIP reports whether ip is loopback, private, link local (cloud metadata lives there) or otherwise not public.
+func blockedIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+	for _, n := range blockedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// importClient checks the address of every connection it makes, after DNS resolution,
+// so neither a redirect nor a hostname resolving to 127.0.0.1 can reach internal services.
+func importClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		Control: func(network, address string, c syscall.RawConn) error {
+			if allowPrivateImports() {
+				return nil
+			}
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blockedIP(ip) {
+				return ErrBlockedHost
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   importTimeout(),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxImportRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return ErrInvalidImportURL
+			}
+			return nil
+		},
+	}
+}
+
+// Import downloads rawURL into the library and returns its item. As with Add, duplicate is set
+// when the content was already in the library.
+func Import(ctx context.Context, rawURL string) (item Item, duplicate bool, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Item{}, false, ErrInvalidImportURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return Item{}, false, ErrInvalidImportURL
+	}
+	req.Header.Set("Accept", "image/*, video/*, audio/*")
+
+	resp, err := importClient().Do(req)
+	if err != nil {
+		if errors.Is(err, ErrBlockedHost) {
+			return Item{}, false, ErrBlockedHost
+		}
+		return Item{}, false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return Item{}, false, &RemoteError{StatusCode: resp.StatusCode}
+	}
+
+	// trust the declared type and length only to fail early, the content is sniffed again by Save.
+	declared, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	declaredKind := Kind(declared)
+	if declared != "" && declared != "application/octet-stream" && !importable(declaredKind) {
+		return Item{}, false, &UnsupportedTypeError{MimeType: declared}
+	}
+	if importable(declaredKind) && resp.ContentLength > LimitFor(declaredKind) {
+		return Item{}, false, &TooLargeError{Kind: declaredKind, Limit: LimitFor(declaredKind)}
+	}
+	if resp.ContentLength > MaxUploadSize() {
+		return Item{}, false, &TooLargeError{Kind: "other", Limit: MaxUploadSize()}
+	}
+
+	stagingPath, err := StagingPath()
+	if err != nil {
+		return Item{}, false, err
+	}
+	saved, err := Save(resp.Body, stagingPath)
+	if err != nil {
+		return Item{}, false, err
+	}
+	if !importable(Kind(saved.MimeType)) {
+		os.Remove(saved.Path)
+		return Item{}, false, &UnsupportedTypeError{MimeType: saved.MimeType}
+	}
+
+	return Add(saved, importName(resp.Request.URL))
+}
+
+// importName is the name an imported file is listed under: the last segment of the URL it finally came from.
+func importName(u *url.URL) string {
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		name = u.Hostname()
+	}
+	return SanitizeFilename(strings.TrimSpace(name))
+}
@@ -0,0 +1,77 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBlockedIP(t *testing.T) {
+	cases := map[string]bool{
+		"127.0.0.1":       true,
+		"::1":             true,
+		"10.1.2.3":        true,
+		"172.16.0.1":      true,
+		"192.168.1.1":     true,
+		"169.254.169.254": true,
+		"fe80::1":         true,
+		"fd00::1":         true,
+		"0.0.0.0":         true,
+		"0.1.2.3":         true,
+		"100.64.0.1":      true,
+		"100.127.255.254": true,
+		"::ffff:10.0.0.1": true,
+		"224.0.0.1":       true,
+		"8.8.8.8":         false,
+		"100.63.255.255":  false,
+		"100.128.0.1":     false,
+		"1.1.1.1":         false,
+		"2606:4700::1111": false,
+	}
+	for in, want := range cases {
+		if got := blockedIP(net.ParseIP(in)); got != want {
+			t.Errorf("blockedIP(%s) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+// the check runs when the connection is made, after DNS, so a name or a redirect can't get around it.
+func TestImportBlocksLocalAddressesAtDial(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("not really a png"))
+	}))
+	defer server.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+
+	urls := []string{
+		server.URL + "/a.png",
+		"http://localhost:" + port + "/a.png", // resolves to loopback
+	}
+	for _, u := range urls {
+		if _, _, err := Import(context.Background(), u); !errors.Is(err, ErrBlockedHost) {
+			t.Errorf("Import(%s) error = %v, want ErrBlockedHost", u, err)
+		}
+	}
+	if n := hits.Load(); n != 0 {
+		t.Errorf("blocked imports reached the server %d times", n)
+	}
+
+	// with private imports allowed the same address is dialed, so it is the dial check that blocked it above.
+	t.Setenv("MediaImportAllowPrivate", "true")
+	resp, err := importClient().Get(server.URL + "/a.png")
+	if err != nil {
+		t.Fatalf("allowed private import: %v", err)
+	}
+	resp.Body.Close()
+	if n := hits.Load(); n != 1 {
+		t.Errorf("allowed import reached the server %d times, want 1", n)
+	}
+}
@@ -0,0 +1,181 @@
+package media
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// inspect fills in the dimensions, duration and codecs of an item.
+// images are read with image.DecodeConfig (header only) plus their EXIF orientation, video and audio with ffprobe (probe.go),
+// falling back to the moov box of mp4/quicktime files when ffprobe is not installed.
+// path is a local copy of the item's file.
+func inspect(item *Item, path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	switch item.Kind {
+	case "image":
+		if cfg, _, err := image.DecodeConfig(f); err == nil {
+			item.Width, item.Height = cfg.Width, cfg.Height
+		} else if heic(item.MimeType) {
+			info, _ := readMP4(f)
+			item.Width, item.Height = info.width, info.height
+			if info.sideways {
+				item.Width, item.Height = item.Height, item.Width
+			}
+		}
+		// width and height are reported the way the image is displayed.
+		item.Orientation = readOrientation(f)
+		if item.Orientation >= 5 {
+			item.Width, item.Height = item.Height, item.Width
+		}
+	case "video", "audio":
+		info, err := probe(context.Background(), path)
+		if err == nil {
+			item.Duration = info.Duration
+			item.Width, item.Height = info.Width, info.Height
+			item.VideoCodec, item.AudioCodec = info.VideoCodec, info.AudioCodec
+			item.FrameRate = info.FrameRate
+			item.Bitrate = info.Bitrate
+			return
+		}
+		if !errors.Is(err, ErrNoFFprobe) {
+			log.Warnf("probing %s: %v", item.ID, err)
+		}
+		if info, ok := readMP4(f); ok {
+			item.Duration = info.duration
+			item.Width, item.Height = info.width, info.height
+		}
+	}
+}
+
+type mp4Info struct {
+	duration      float64
+	width, height int
+	sideways      bool // HEIC only, "irot" turns the image a quarter turn
+}
+
+// readMP4 walks the box tree of an ISO media file (mp4, mov, m4a) for the movie duration and video size. for HEIC,
+// which is the same container, the size is the largest image spatial extent ("ispe") it lists: the full image, not
+// its tiles or thumbnail.
+func readMP4(r io.ReaderAt) (mp4Info, bool) {
+	var info mp4Info
+	found := false
+
+	var walk func(start, end int64)
+	walk = func(start, end int64) {
+		for off := start; end < 0 || off+8 <= end; {
+			header := make([]byte, 16)
+			if n, _ := r.ReadAt(header[:8], off); n < 8 {
+				return
+			}
+			size := int64(binary.BigEndian.Uint32(header[0:4]))
+			kind := string(header[4:8])
+			headerLen := int64(8)
+			switch size {
+			case 1:
+				if n, _ := r.ReadAt(header[8:16], off+8); n < 8 {
+					return
+				}
+				size = int64(binary.BigEndian.Uint64(header[8:16]))
+				headerLen = 16
+			case 0:
+				if end < 0 {
+					return
+				}
+				size = end - off
+			}
+			if size < headerLen {
+				return
+			}
+			payload := off + headerLen
+
+			switch kind {
+			case "moov", "trak", "iprp", "ipco":
+				walk(payload, off+size)
+			case "meta":
+				// a full box, its children start after version and flags.
+				walk(payload+4, off+size)
+			case "ispe":
+				if w, h, ok := readIspe(r, payload); ok && w*h > info.width*info.height {
+					info.width, info.height = w, h
+				}
+			case "irot":
+				b := make([]byte, 1)
+				if n, _ := r.ReadAt(b, payload); n == 1 {
+					info.sideways = b[0]&1 == 1
+				}
+			case "mvhd":
+				if d, ok := readMvhd(r, payload); ok {
+					info.duration = d
+					found = true
+				}
+			case "tkhd":
+				if w, h, ok := readTkhd(r, payload); ok && w > 0 && h > 0 && info.width == 0 {
+					info.width, info.height = w, h
+				}
+			}
+			off += size
+		}
+	}
+	walk(0, -1)
+	return info, found
+}
+
+func readIspe(r io.ReaderAt, payload int64) (int, int, bool) {
+	b := make([]byte, 12)
+	if n, _ := r.ReadAt(b, payload); n < 12 {
+		return 0, 0, false
+	}
+	return int(binary.BigEndian.Uint32(b[4:8])), int(binary.BigEndian.Uint32(b[8:12])), true
+}
+
+func readMvhd(r io.ReaderAt, payload int64) (float64, bool) {
+	b := make([]byte, 32)
+	if n, _ := r.ReadAt(b, payload); n < 32 {
+		return 0, false
+	}
+	var timescale, duration uint64
+	if b[0] == 1 {
+		timescale = uint64(binary.BigEndian.Uint32(b[20:24]))
+		duration = binary.BigEndian.Uint64(b[24:32])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(b[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(b[16:20]))
+	}
+	if timescale == 0 {
+		return 0, false
+	}
+	return float64(duration) / float64(timescale), true
+}
+
+func readTkhd(r io.ReaderAt, payload int64) (int, int, bool) {
+	b := make([]byte, 96)
+	if n, _ := r.ReadAt(b, payload); n < 84 {
+		return 0, 0, false
+	}
+	at := 76
+	if b[0] == 1 {
+		at = 88
+	}
+	if at+8 > len(b) {
+		return 0, 0, false
+	}
+	// width and height are 16.16 fixed point.
+	w := int(binary.BigEndian.Uint32(b[at:at+4]) >> 16)
+	h := int(binary.BigEndian.Uint32(b[at+4:at+8]) >> 16)
+	return w, h, true
+}
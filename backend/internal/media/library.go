@@ -0,0 +1,751 @@
+package media
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/TanishqM1/SocialContentDistributer/internal/storage"
+	"github.com/TanishqM1/SocialContentDistributer/internal/store"
+)
+
+// the media library is an index of everything in the media store (media.json in the data directory).
+// uploads are registered here as they land, so listing, describing and deleting media never has to scan the store.
+//
+// files are stored by content under the key <first 2 chars of sha256>/<sha256><ext>. uploading the same bytes twice
+// gives back the media item that already exists instead of a second copy.
+// posts hold a reference on the media they use (Retain/Release), and media a post still holds cannot be deleted.
+
+// LegacyDir is where uploads were written before the media store existed. Loose files found there are adopted on startup.
+const LegacyDir = "uploads/media"
+
+// mediaStore holds the files, local disk unless SetStore is called.
+var mediaStore storage.MediaStore = storage.NewLocalStore(LegacyDir, "", "")
+
+// SetStore picks the backend media is kept in. Call it before LoadLibrary.
+func SetStore(s storage.MediaStore) {
+	mediaStore = s
+}
+
+// Store returns the backend media is kept in.
+func Store() storage.MediaStore {
+	return mediaStore
+}
+
+// ErrNotFound is returned when no media item has the requested id.
+var ErrNotFound = errors.New("media not found")
+
+// ErrInUse is returned when deleting media a post that has not finished still uses.
+var ErrInUse = errors.New("media is used by a post that has not finished")
+
+// Item describes one file in the library.
+type Item struct {
+	ID           string    `json:"id"`
+	Filename     string    `json:"filename"`      // key in the media store, e.g. "ab/abcd...ef.jpg"
+	OriginalName string    `json:"original_name"` // name the client uploaded it as
+	Size         int64     `json:"size"`
+	MimeType     string    `json:"mime_type"`
+	Kind         string    `json:"kind"` // "image", "video", "audio" or "other"
+	Width        int       `json:"width,omitempty"`
+	Height       int       `json:"height,omitempty"`
+	Duration     float64   `json:"duration,omitempty"`    // seconds, for video and audio
+	Orientation  int       `json:"orientation,omitempty"` // EXIF orientation of images (1 is upright), width and height are as displayed
+	VideoCodec   string    `json:"video_codec,omitempty"` // from ffprobe, e.g. "h264"
+	AudioCodec   string    `json:"audio_codec,omitempty"`
+	FrameRate    float64   `json:"frame_rate,omitempty"`
+	Bitrate      int64     `json:"bitrate,omitempty"` // bits per second
+	Checksum     string    `json:"checksum"`          // sha256 of the content, also where the file lives
+	Tags         []string  `json:"tags"`
+	Focus        *Point    `json:"focus,omitempty"` // where image crops are centered (images.go), the center if unset
+	Refs         int       `json:"refs"`            // posts currently referencing this item
+	Deleted      bool      `json:"deleted,omitempty"`
+	UploadedAt   time.Time `json:"uploaded_at"`
+
+	// set on renditions made from another item (see transcode.go). they are not listed in the library,
+	// and go away with the item they were made from.
+	Source    string `json:"source,omitempty"`    // id of the original item
+	Rendition string `json:"rendition,omitempty"` // what was made, e.g. "instagram@3f2a9c1b"
+
+	// set on copies made without metadata (see privacy.go): what was removed, e.g. "gps_location".
+	Stripped []string `json:"stripped,omitempty"`
+	// set only on the item OpenFor returns, never saved: why Stripped may not be everything the file lost or
+	// still carries, e.g. the original's metadata could not be read.
+	MetadataWarning string `json:"-"`
+}
+
+var (
+	mu         sync.Mutex
+	items      = map[string]*Item{}
+	byChecksum = map[string]string{} // checksum -> id
+)
+
+func indexPath() string {
+	return store.Path("media.json")
+}
+
+// must hold mu.
+func save() error {
+	return store.Save(indexPath(), items)
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func stagingDir() string {
+	return store.Path("staging")
+}
+
+// StagingPath returns a fresh local path to stream an upload into, while its hash (and so its key) is not known yet.
+// Pass the result of Save to Add to move it into the store.
+func StagingPath() (string, error) {
+	if err := os.MkdirAll(stagingDir(), 0755); err != nil {
+		return "", err
+	}
+	return filepath.Join(stagingDir(), newID()), nil
+}
+
+// blobName is the key content with the given checksum is stored under.
+func blobName(checksum string, ext string) string {
+	return path.Join(checksum[:2], checksum+ext)
+}
+
+var blobPattern = regexp.MustCompile(`^([0-9a-f]{2})/([0-9a-f]{64})(\.[a-z0-9]+)?$`)
+
+// isBlob reports whether key is one blobName makes. the store can be shared (a bucket, or a MediaDir with its
+// own folders), so these are the only keys the library may remove without knowing them.
+func isBlob(key string) bool {
+	m := blobPattern.FindStringSubmatch(key)
+	return m != nil && strings.HasPrefix(m[2], m[1])
+}
+
+// extensionFor keeps the extension of the original name (uploaders need it), falling back to one for the MIME type.
+func extensionFor(originalName string, mimeType string) string {
+	ext := safeExtension(originalName)
+	if ext != "" {
+		return ext
+	}
+	if exts, _ := mime.ExtensionsByType(mimeType); len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// LoadLibrary reads the index and makes sure every item is in the media store under its content addressed key,
+// moving files over from LegacyDir (uploads from before the store existed, or before switching backends).
+// Loose files in LegacyDir that the index does not know about are adopted, duplicates are merged.
+func LoadLibrary() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err := store.Load(indexPath(), &items); err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	changed := false
+	ids := make([]string, 0, len(items))
+	for id := range items {
+		ids = append(ids, id)
+	}
+	// oldest first, so the oldest id survives a merge.
+	sort.Slice(ids, func(a, b int) bool {
+		return items[ids[a]].UploadedAt.Before(items[ids[b]].UploadedAt)
+	})
+	byChecksum = map[string]string{}
+	for _, id := range ids {
+		item := items[id]
+		if existing, ok := byChecksum[item.Checksum]; ok {
+			merge(items[existing], item)
+			delete(items, id)
+			changed = true
+			continue
+		}
+		moved, err := adopt(ctx, item)
+		if err != nil {
+			log.Warnf("media %s: %v", id, err)
+		}
+		changed = changed || moved
+		byChecksum[item.Checksum] = id
+	}
+
+	// loose files sitting directly in LegacyDir were uploaded before the index existed.
+	entries, err := os.ReadDir(LegacyDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(LegacyDir, e.Name())
+		item, err := describe(path)
+		if err != nil {
+			log.Warnf("skipping %s: %v", e.Name(), err)
+			continue
+		}
+		if existing, ok := byChecksum[item.Checksum]; ok {
+			merge(items[existing], item)
+			os.Remove(path)
+			changed = true
+			continue
+		}
+		item.Filename = blobName(item.Checksum, extensionFor(e.Name(), item.MimeType))
+		if err := storage.PutFile(ctx, mediaStore, item.Filename, path, item.MimeType); err != nil {
+			log.Warnf("skipping %s: %v", e.Name(), err)
+			continue
+		}
+		items[item.ID] = item
+		byChecksum[item.Checksum] = item.ID
+		changed = true
+	}
+
+	if changed {
+		return save()
+	}
+	return nil
+}
+
+// adopt makes sure an item's file is in the store under its content addressed key, moving it there from
+// LegacyDir or from an older key if needed. It reports whether the item changed.
+func adopt(ctx context.Context, item *Item) (bool, error) {
+	name := item.Filename
+	if !strings.HasPrefix(path.Base(name), item.Checksum) {
+		name = blobName(item.Checksum, extensionFor(item.OriginalName, item.MimeType))
+	}
+
+	if _, err := mediaStore.Stat(ctx, name); err != nil {
+		// not in the store yet, look where it used to be.
+		legacy := filepath.Join(LegacyDir, filepath.FromSlash(item.Filename))
+		if _, statErr := os.Stat(legacy); statErr == nil {
+			if err := storage.PutFile(ctx, mediaStore, name, legacy, item.MimeType); err != nil {
+				return false, err
+			}
+		} else if name != item.Filename {
+			if err := copyObject(ctx, item.Filename, name, item.Size, item.MimeType); err != nil {
+				return false, err
+			}
+		} else {
+			return false, fmt.Errorf("%s is missing from the media store", name)
+		}
+	}
+
+	if name == item.Filename {
+		return false, nil
+	}
+	mediaStore.Delete(ctx, item.Filename)
+	item.Filename = name
+	return true, nil
+}
+
+// copyObject copies one key to another inside the store, then deletes the original.
+func copyObject(ctx context.Context, from string, to string, size int64, contentType string) error {
+	r, err := mediaStore.Open(ctx, from)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := mediaStore.Put(ctx, to, r, size, contentType); err != nil {
+		return err
+	}
+	return mediaStore.Delete(ctx, from)
+}
+
+// merge folds a duplicate into the item that is kept.
+func merge(into *Item, dup *Item) {
+	into.Refs += dup.Refs
+	into.Deleted = into.Deleted && dup.Deleted
+	for _, t := range dup.Tags {
+		if !hasTag(into.Tags, t) {
+			into.Tags = append(into.Tags, t)
+		}
+	}
+}
+
+// describe builds an item for a local file.
+func describe(path string) (*Item, error) {
+	saved, err := savedFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	item := newItem(saved, filepath.Base(path))
+	item.UploadedAt = info.ModTime()
+	return item, nil
+}
+
+// savedFromFile describes a file that is already on local disk (a legacy upload, ffmpeg output) the way Save would.
+func savedFromFile(path string) (Saved, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Saved{}, err
+	}
+	defer f.Close()
+
+	head := make([]byte, SniffLen)
+	n, _ := f.Read(head)
+	info, err := f.Stat()
+	if err != nil {
+		return Saved{}, err
+	}
+	saved := Saved{Path: path, Size: info.Size(), MimeType: DetectType(head[:n])}
+	if saved.Checksum, err = checksumFile(path); err != nil {
+		return Saved{}, err
+	}
+	return saved, nil
+}
+
+func newItem(saved Saved, originalName string) *Item {
+	item := &Item{
+		ID:           newID(),
+		Filename:     blobName(saved.Checksum, extensionFor(originalName, saved.MimeType)),
+		OriginalName: SanitizeFilename(originalName),
+		Size:         saved.Size,
+		MimeType:     saved.MimeType,
+		Kind:         Kind(saved.MimeType),
+		Checksum:     saved.Checksum,
+		Tags:         []string{},
+		UploadedAt:   time.Now(),
+	}
+	inspect(item, saved.Path)
+	return item
+}
+
+// Add registers a freshly saved upload in the library, moving it from staging into the store under its content addressed key.
+// If the same content is already stored, the staged copy is dropped and the existing item is returned with duplicate set.
+func Add(saved Saved, originalName string) (item Item, duplicate bool, err error) {
+	mu.Lock()
+	item, duplicate, err = addDuplicate(saved)
+	mu.Unlock()
+	if duplicate || err != nil {
+		return item, duplicate, err
+	}
+
+	// inspecting can run ffprobe for up to its timeout and storing can be an upload to a bucket, so both happen
+	// without the library lock held. the same content may have been added meanwhile, so that is checked again
+	// once the lock is back. (GC leaves stored files alone for an hour, so it won't take this one in between.)
+	created := newItem(saved, originalName)
+	if err := storage.PutFile(context.Background(), mediaStore, created.Filename, saved.Path, saved.MimeType); err != nil {
+		os.Remove(saved.Path)
+		return Item{}, false, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if item, duplicate, err = addDuplicate(saved); duplicate || err != nil {
+		if duplicate && item.Filename != created.Filename {
+			mediaStore.Delete(context.Background(), created.Filename)
+		}
+		return item, duplicate, err
+	}
+
+	items[created.ID] = created
+	byChecksum[created.Checksum] = created.ID
+	if err := save(); err != nil {
+		delete(items, created.ID)
+		delete(byChecksum, created.Checksum)
+		return Item{}, false, err
+	}
+	return created.copy(), false, nil
+}
+
+// addDuplicate returns the item that already holds saved's content, if any, and drops the staged copy. Must hold mu.
+func addDuplicate(saved Saved) (Item, bool, error) {
+	id, ok := byChecksum[saved.Checksum]
+	if !ok {
+		return Item{}, false, nil
+	}
+	os.Remove(saved.Path)
+	existing := items[id]
+	if existing.Deleted {
+		// uploaded again after being deleted, bring it back.
+		existing.Deleted = false
+		if err := save(); err != nil {
+			return Item{}, false, err
+		}
+	}
+	return existing.copy(), true, nil
+}
+
+// FindByChecksum returns the live item holding content with the given sha256, if any.
+func FindByChecksum(checksum string) (Item, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	id, ok := byChecksum[strings.ToLower(checksum)]
+	if !ok || items[id].Deleted {
+		return Item{}, false
+	}
+	return items[id].copy(), true
+}
+
+// Resolve finds the item a publish request refers to. Only media ids are accepted, never filenames or paths.
+func Resolve(ref string) (Item, error) {
+	if !ValidID(ref) {
+		return Item{}, ErrInvalidID
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if item, ok := items[ref]; ok && !item.Deleted {
+		return item.copy(), nil
+	}
+	return Item{}, ErrNotFound
+}
+
+// Open returns the contents of the item a publish request refers to (see Resolve). The caller closes it.
+func Open(ctx context.Context, ref string) (io.ReadCloser, Item, error) {
+	item, err := Resolve(ref)
+	if err != nil {
+		return nil, Item{}, err
+	}
+	r, err := mediaStore.Open(ctx, item.Filename)
+	if err != nil {
+		return nil, Item{}, err
+	}
+	return r, item, nil
+}
+
+// LocalFile returns a local path holding the item's contents, for tools that need a real file (ffmpeg).
+// With the local store that is the stored file itself, otherwise it is downloaded to the staging directory.
+// Call cleanup when done with it.
+func LocalFile(ctx context.Context, item Item) (string, func(), error) {
+	if pather, ok := mediaStore.(storage.LocalPather); ok {
+		p, err := pather.LocalPath(item.Filename)
+		return p, func() {}, err
+	}
+
+	r, err := mediaStore.Open(ctx, item.Filename)
+	if err != nil {
+		return "", nil, err
+	}
+	defer r.Close()
+
+	tmp, err := StagingPath()
+	if err != nil {
+		return "", nil, err
+	}
+	tmp += path.Ext(item.Filename)
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", nil, err
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", nil, err
+	}
+	return tmp, func() { os.Remove(tmp) }, nil
+}
+
+// PresignURL returns a link anyone can download the item from until it expires.
+func PresignURL(ctx context.Context, id string, expires time.Duration) (string, error) {
+	item, err := Get(id)
+	if err != nil {
+		return "", err
+	}
+	return mediaStore.PresignGet(ctx, item.Filename, expires)
+}
+
+func (i *Item) copy() Item {
+	c := *i
+	c.Tags = append([]string{}, i.Tags...)
+	if i.Stripped != nil {
+		c.Stripped = append([]string{}, i.Stripped...)
+	}
+	if i.Focus != nil {
+		focus := *i.Focus
+		c.Focus = &focus
+	}
+	return c
+}
+
+// Filter narrows down List. Empty fields match everything.
+type Filter struct {
+	Kind string
+	Tag  string
+}
+
+// List returns the library, newest first.
+func List(filter Filter) []Item {
+	mu.Lock()
+	defer mu.Unlock()
+
+	list := []Item{}
+	for _, item := range items {
+		if item.Deleted || item.Source != "" {
+			continue
+		}
+		if filter.Kind != "" && item.Kind != filter.Kind {
+			continue
+		}
+		if filter.Tag != "" && !hasTag(item.Tags, filter.Tag) {
+			continue
+		}
+		list = append(list, item.copy())
+	}
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].UploadedAt.After(list[b].UploadedAt)
+	})
+	return list
+}
+
+// Get returns the item with the given id.
+func Get(id string) (Item, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	item, ok := items[id]
+	if !ok || item.Deleted {
+		return Item{}, ErrNotFound
+	}
+	return item.copy(), nil
+}
+
+// Delete removes an item and its file from the library, along with its renditions. Media a post still holds
+// (see Retain), directly or through one of its renditions, is not deleted: ErrInUse is returned until the post
+// finishes.
+func Delete(id string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	item, ok := items[id]
+	if !ok || item.Deleted {
+		return ErrNotFound
+	}
+	// renditions are only useful while their original is around, and the same goes for renditions of those.
+	family := []*Item{item}
+	for i := 0; i < len(family); i++ {
+		for _, derived := range items {
+			if derived.Source == family[i].ID && !derived.Deleted {
+				family = append(family, derived)
+			}
+		}
+	}
+	for _, member := range family {
+		if member.Refs > 0 {
+			return ErrInUse
+		}
+	}
+
+	if err := remove(item); err != nil {
+		return err
+	}
+	for _, derived := range family[1:] {
+		if err := remove(derived); err != nil {
+			// hidden, GC tries again.
+			derived.Deleted = true
+			log.Warnf("removing rendition %s: %v", derived.ID, err)
+		}
+	}
+	return save()
+}
+
+// remove deletes an item's file and drops it from the index. Must hold mu.
+func remove(item *Item) error {
+	if err := mediaStore.Delete(context.Background(), item.Filename); err != nil {
+		return err
+	}
+	delete(items, item.ID)
+	if byChecksum[item.Checksum] == item.ID {
+		delete(byChecksum, item.Checksum)
+	}
+	return nil
+}
+
+// Retain records that something (a post) uses the given media.
+func Retain(ids ...string) error {
+	return adjustRefs(ids, 1)
+}
+
+// Release drops a reference taken with Retain.
+func Release(ids ...string) error {
+	return adjustRefs(ids, -1)
+}
+
+func adjustRefs(ids []string, delta int) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	// every id is checked first, so an unknown one leaves all the counts as they were.
+	for _, id := range ids {
+		if _, ok := items[id]; !ok {
+			return ErrNotFound
+		}
+	}
+	before := make(map[string]int, len(ids))
+	for _, id := range ids {
+		item := items[id]
+		if _, ok := before[id]; !ok {
+			before[id] = item.Refs
+		}
+		item.Refs += delta
+		if item.Refs < 0 {
+			item.Refs = 0
+		}
+	}
+	if err := save(); err != nil {
+		for id, refs := range before {
+			items[id].Refs = refs
+		}
+		return err
+	}
+	return nil
+}
+
+// GCReport says what a garbage collection pass removed.
+type GCReport struct {
+	Items      []string `json:"items"`   // ids of deleted items whose files were removed
+	Orphans    []string `json:"orphans"` // stored files no item points at, and abandoned staging files
+	FreedBytes int64    `json:"freed_bytes"`
+}
+
+// GC removes the files of deleted items nothing references any more, stored files the index does not know about,
+// and staged uploads that were abandoned (older than a day).
+func GC() (GCReport, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	ctx := context.Background()
+
+	report := GCReport{Items: []string{}, Orphans: []string{}}
+	for _, item := range items {
+		if !item.Deleted || item.Refs > 0 {
+			continue
+		}
+		if err := remove(item); err != nil {
+			return report, err
+		}
+		report.Items = append(report.Items, item.ID)
+		report.FreedBytes += item.Size
+	}
+
+	known := map[string]bool{}
+	for _, item := range items {
+		known[item.Filename] = true
+	}
+	objects, err := mediaStore.List(ctx, "")
+	if err != nil {
+		return report, err
+	}
+	for _, obj := range objects {
+		// only content addressed keys are ours to remove, and only once a put in progress has surely finished.
+		if known[obj.Key] || !isBlob(obj.Key) || time.Since(obj.ModTime) < time.Hour {
+			continue
+		}
+		if err := mediaStore.Delete(ctx, obj.Key); err != nil {
+			return report, err
+		}
+		report.Orphans = append(report.Orphans, obj.Key)
+		report.FreedBytes += obj.Size
+	}
+
+	staged, err := os.ReadDir(stagingDir())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return report, err
+	}
+	for _, e := range staged {
+		info, err := e.Info()
+		if err != nil || time.Since(info.ModTime()) < 24*time.Hour {
+			continue
+		}
+		if err := os.Remove(filepath.Join(stagingDir(), e.Name())); err != nil {
+			return report, err
+		}
+		report.Orphans = append(report.Orphans, "staging/"+e.Name())
+		report.FreedBytes += info.Size()
+	}
+	return report, save()
+}
+
+// normalizeTag lowercases a tag and trims spaces and a leading '#'.
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+func hasTag(tags []string, tag string) bool {
+	tag = normalizeTag(tag)
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// SetTags replaces the tags of an item.
+func SetTags(id string, tags []string) (Item, error) {
+	return updateTags(id, func(current []string) []string {
+		return tags
+	})
+}
+
+// AddTags adds tags to an item, skipping ones it already has.
+func AddTags(id string, tags []string) (Item, error) {
+	return updateTags(id, func(current []string) []string {
+		return append(current, tags...)
+	})
+}
+
+// RemoveTag takes a tag off an item.
+func RemoveTag(id string, tag string) (Item, error) {
+	tag = normalizeTag(tag)
+	return updateTags(id, func(current []string) []string {
+		kept := []string{}
+		for _, t := range current {
+			if t != tag {
+				kept = append(kept, t)
+			}
+		}
+		return kept
+	})
+}
+
+func updateTags(id string, fn func(current []string) []string) (Item, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	item, ok := items[id]
+	if !ok || item.Deleted {
+		return Item{}, ErrNotFound
+	}
+
+	tags := []string{}
+	for _, t := range fn(append([]string{}, item.Tags...)) {
+		t = normalizeTag(t)
+		if t != "" && !hasTag(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+	previous := item.Tags
+	item.Tags = tags
+	if err := save(); err != nil {
+		item.Tags = previous
+		return Item{}, err
+	}
+	return item.copy(), nil
+}
@@ -0,0 +1,212 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TanishqM1/SocialContentDistributer/internal/storage"
+)
+
+// useLibrary gives a test an empty library on a local store in a temp dir, and puts the old one back after.
+func useLibrary(t *testing.T) (dir string, root string) {
+	t.Helper()
+	dir = t.TempDir()
+	root = filepath.Join(dir, "media")
+	t.Setenv("DataDir", dir)
+
+	oldStore := mediaStore
+	mu.Lock()
+	oldItems, oldChecksums := items, byChecksum
+	items, byChecksum = map[string]*Item{}, map[string]string{}
+	mu.Unlock()
+	SetStore(storage.NewLocalStore(root, "", ""))
+	t.Cleanup(func() {
+		SetStore(oldStore)
+		mu.Lock()
+		items, byChecksum = oldItems, oldChecksums
+		mu.Unlock()
+	})
+	return dir, root
+}
+
+func TestGCKeepsForeignKeys(t *testing.T) {
+	_, root := useLibrary(t)
+
+	hash := strings.Repeat("ab", 32)
+	other := strings.Repeat("cd", 32)
+	orphan := "ab/" + hash + ".jpg"
+	foreign := []string{
+		"cd/" + hash + ".jpg",      // folder is not the start of the hash
+		"ab/" + hash[:63] + ".jpg", // too short to be a sha256
+		"ab/" + strings.ToUpper(hash),
+		"ab/" + hash + ".JPG",
+		"photos/2024/beach.jpg",
+		"readme.txt",
+		"backups/ab/" + hash,
+		"ab/" + hash + ".jpg.bak",
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	for _, key := range append([]string{orphan, "cd/" + other}, foreign...) {
+		file := filepath.Join(root, filepath.FromSlash(key))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(file, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a blob written a moment ago may belong to an upload that is not indexed yet.
+	if err := os.Chtimes(filepath.Join(root, "cd", other), time.Now(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := GC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(report.Orphans, []string{orphan}) {
+		t.Errorf("orphans removed: %v, want only %s", report.Orphans, orphan)
+	}
+	for _, key := range append(foreign, "cd/"+other) {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(key))); err != nil {
+			t.Errorf("%s: %v", key, err)
+		}
+	}
+}
+
+// ffprobe can take a while on a big video, the library must stay usable meanwhile. the fake ffprobe reports
+// through one fifo that it started and waits on another until the test lets it finish.
+func TestAddProbesWithoutTheLibraryLock(t *testing.T) {
+	dir, _ := useLibrary(t)
+	started, release := filepath.Join(dir, "started"), filepath.Join(dir, "release")
+	for _, fifo := range []string{started, release} {
+		if out, err := exec.Command("mkfifo", fifo).CombinedOutput(); err != nil {
+			t.Skipf("mkfifo: %v %s", err, out)
+		}
+	}
+	// only the first run waits, in case the file is probed more than once.
+	marker := filepath.Join(dir, "probed")
+	t.Setenv("FFprobePath", fakeTool(t, dir, "ffprobe",
+		"[ -e '"+marker+"' ] || { touch '"+marker+"'; echo started > '"+started+"'; read go < '"+release+"'; }\necho '{}'\n"))
+
+	video := append(box("ftyp", []byte("isom\x00\x00\x02\x00isomiso2mp41")), box("mdat", []byte("frames"))...)
+	path, err := StagingPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := Save(bytes.NewReader(video), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := Add(saved, "clip.mp4")
+		done <- err
+	}()
+	probing := make(chan error, 1)
+	go func() {
+		_, err := os.ReadFile(started)
+		probing <- err
+	}()
+	// the timeout only keeps a broken build from hanging, nothing is measured against it.
+	select {
+	case err := <-probing:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case err := <-done:
+		t.Fatalf("Add finished without probing: %v", err)
+	case <-time.After(time.Minute):
+		t.Fatal("ffprobe never ran")
+	}
+
+	// ffprobe is parked on the fifo now, nothing else runs: the library lock must be free.
+	if mu.TryLock() {
+		mu.Unlock()
+	} else {
+		t.Error("the library is locked while ffprobe runs")
+	}
+
+	// opened for reading too, so this never blocks, even if ffprobe was given up on; it stays open until Add
+	// returns, so the script still finds the line if it opens the fifo later.
+	f, err := os.OpenFile(release, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString("go\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := FindByChecksum(saved.Checksum); !ok {
+		t.Error("the upload was not added")
+	}
+}
+
+func TestDeleteKeepsMediaPostsHold(t *testing.T) {
+	_, root := useLibrary(t)
+
+	put := func(id string, source string) *Item {
+		checksum := strings.Repeat(id, 4)
+		item := &Item{ID: id, Filename: blobName(checksum, ".mp4"), Checksum: checksum, Kind: "video", Source: source}
+		file := filepath.Join(root, filepath.FromSlash(item.Filename))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(id), 0644); err != nil {
+			t.Fatal(err)
+		}
+		items[id], byChecksum[checksum] = item, id
+		return item
+	}
+	a, b, c := strings.Repeat("a", 16), strings.Repeat("b", 16), strings.Repeat("c", 16)
+	put(a, "")
+	put(b, a) // a rendition of a
+	put(c, b) // and one of that
+
+	for _, held := range []string{a, c} {
+		if err := Retain(held); err != nil {
+			t.Fatal(err)
+		}
+		if err := Delete(a); err != ErrInUse {
+			t.Errorf("deleting a while %s is held: %v", held, err)
+		}
+		for _, id := range []string{a, b, c} {
+			if _, err := Resolve(id); err != nil {
+				t.Errorf("%s after the delete was refused: %v", id, err)
+			}
+		}
+		if err := Release(held); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := Delete(a); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{a, b, c} {
+		if _, err := Resolve(id); err != ErrNotFound {
+			t.Errorf("%s after the delete: %v", id, err)
+		}
+	}
+	left, err := mediaStore.List(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 0 {
+		t.Errorf("files left: %v", left)
+	}
+}
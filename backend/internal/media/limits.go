@@ -0,0 +1,48 @@
+package media
+
+import (
+	"os"
+	"strconv"
+)
+
+// per-kind upload size limits, in MB, read from the environment (config/.env):
+//
+//	MaxImageUploadMB, MaxVideoUploadMB, MaxAudioUploadMB, MaxOtherUploadMB
+var defaultLimitsMB = map[string]int64{
+	"image": 20,
+	"video": 2048,
+	"audio": 500,
+	"other": 10,
+}
+
+var limitEnv = map[string]string{
+	"image": "MaxImageUploadMB",
+	"video": "MaxVideoUploadMB",
+	"audio": "MaxAudioUploadMB",
+	"other": "MaxOtherUploadMB",
+}
+
+// LimitFor returns the maximum size in bytes for a file of the given kind.
+func LimitFor(kind string) int64 {
+	if _, ok := defaultLimitsMB[kind]; !ok {
+		kind = "other"
+	}
+	mb := defaultLimitsMB[kind]
+	if v := os.Getenv(limitEnv[kind]); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			mb = n
+		}
+	}
+	return mb << 20
+}
+
+// MaxUploadSize is the largest limit over every kind. Anything bigger can be rejected before reading a byte.
+func MaxUploadSize() int64 {
+	var max int64
+	for kind := range defaultLimitsMB {
+		if l := LimitFor(kind); l > max {
+			max = l
+		}
+	}
+	return max
+}
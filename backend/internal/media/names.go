@@ -0,0 +1,64 @@
+package media
+
+import (
+	"encoding/hex"
+	"errors"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// clients only ever get to pick a media item by its id. filenames they send are kept for display,
+// after being cut down to a plain base name, and never used to build a path.
+
+// ErrInvalidID is returned when a media reference is not an id handed out by the server.
+var ErrInvalidID = errors.New("media must be referenced by the media_id returned from the upload")
+
+// maxNameLength keeps original names within what every filesystem accepts.
+const maxNameLength = 255
+
+var extensionPattern = regexp.MustCompile(`^\.[a-z0-9]{1,10}$`)
+
+// ValidID reports whether id looks like an id newID produced.
+func ValidID(id string) bool {
+	if len(id) != 16 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil && strings.ToLower(id) == id
+}
+
+// SanitizeFilename turns a client supplied filename into a safe base name: directories (both / and \) are dropped,
+// control characters removed, leading dots trimmed and the length capped. It returns "upload" if nothing is left.
+func SanitizeFilename(name string) string {
+	name = strings.ToValidUTF8(name, "")
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '/' || r == ':' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+
+	for len(name) > maxNameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" {
+		return "upload"
+	}
+	return name
+}
+
+// safeExtension returns the lowercased extension of name if it is short and alphanumeric, otherwise "".
+func safeExtension(name string) string {
+	ext := strings.ToLower(path.Ext(SanitizeFilename(name)))
+	if !extensionPattern.MatchString(ext) {
+		return ""
+	}
+	return ext
+}
@@ -0,0 +1,66 @@
+package media
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	cases := map[string]string{
+		"photo.jpg":                   "photo.jpg",
+		"../../etc/passwd":            "passwd",
+		"..\\..\\windows\\win.ini":    "win.ini",
+		"/abs/path/video.mp4":         "video.mp4",
+		"..":                          "upload",
+		"":                            "upload",
+		".bashrc":                     "bashrc",
+		"C:evil.png":                  "Cevil.png",
+		"name\x00.jpg":                "name.jpg",
+		"line\nbreak.png":             "linebreak.png",
+		"uploads/media/../../main.go": "main.go",
+	}
+	for in, want := range cases {
+		if got := SanitizeFilename(in); got != want {
+			t.Errorf("SanitizeFilename(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	long := SanitizeFilename(strings.Repeat("é", 300) + ".jpg")
+	if len(long) > maxNameLength {
+		t.Errorf("SanitizeFilename kept %d bytes", len(long))
+	}
+}
+
+func TestExtensionFor(t *testing.T) {
+	cases := []struct{ name, mime, want string }{
+		{"clip.MP4", "video/mp4", ".mp4"},
+		{"photo", "image/png", ".png"},
+		{"evil.png/../../x", "image/png", ".png"},
+		{"weird.p/g", "image/png", ".png"},
+		{"spaces.j p g", "image/png", ".png"},
+	}
+	for _, c := range cases {
+		if got := extensionFor(c.name, c.mime); got != c.want {
+			t.Errorf("extensionFor(%q, %q) = %q, want %q", c.name, c.mime, got, c.want)
+		}
+	}
+}
+
+func TestResolveOnlyAcceptsIDs(t *testing.T) {
+	for _, ref := range []string{
+		"../../etc/passwd",
+		"uploads/media/photo.jpg",
+		"ab/abcdef.jpg",
+		"/etc/passwd",
+		"ABCDEF0123456789",
+		"0123456789abcdef0",
+	} {
+		if _, err := Resolve(ref); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("Resolve(%q) = %v, want ErrInvalidID", ref, err)
+		}
+	}
+	if _, err := Resolve(newID()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Resolve(unknown id) = %v, want ErrNotFound", err)
+	}
+}
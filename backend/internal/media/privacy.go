@@ -0,0 +1,442 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// photos straight off a phone carry their GPS position, the camera's make, model and serial number and more.
+// before anything is published, a clean copy is made without that metadata (a rendition keyed "clean@...",
+// remembering in Stripped what was removed) unless the request opts out with keep_metadata.
+//
+//	JPEG  EXIF, XMP and IPTC segments and comments are dropped (the orientation is kept, in a fresh minimal EXIF)
+//	PNG   eXIf, tEXt, zTXt, iTXt (where XMP lives) and tIME chunks are dropped
+//	WebP  EXIF and XMP chunks are dropped
+//	video global and per-stream metadata (location, make, model, dates) is dropped by ffmpeg, the streams are copied as is
+//
+// pixel data is never touched, so nothing is re-encoded. variants made by images.go are written by Go's encoders,
+// which write no metadata at all, so they come out clean already.
+
+// cleanKey is the rendition key of the clean copy. bump it when stripping changes.
+const cleanKey = "clean@1"
+
+// exif tags worth naming in the report. anything else is covered by "exif".
+var exifTagNames = map[uint16]string{
+	0x010F: "camera_make",
+	0x0110: "camera_model",
+	0x0131: "software",
+	0x0132: "date_time",
+	0x013B: "artist",
+	0x8298: "copyright",
+	0x8825: "gps_location",
+	0x9003: "date_time",
+	0xA430: "owner_name",
+	0xA431: "camera_serial",
+	0xA435: "lens_serial",
+}
+
+// exifDetails lists the named tags found in IFD0 and the Exif sub-IFD of a TIFF structure.
+func exifDetails(b []byte) []string {
+	if len(b) < 8 {
+		return nil
+	}
+	var order binary.ByteOrder
+	switch string(b[0:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil
+	}
+
+	found := []string{}
+	var walk func(offset int, depth int)
+	walk = func(offset int, depth int) {
+		if depth > 1 || offset < 8 || offset+2 > len(b) {
+			return
+		}
+		count := int(order.Uint16(b[offset : offset+2]))
+		for i := 0; i < count; i++ {
+			entry := offset + 2 + i*12
+			if entry+12 > len(b) {
+				return
+			}
+			tag := order.Uint16(b[entry : entry+2])
+			if name, ok := exifTagNames[tag]; ok {
+				found = append(found, name)
+			}
+			if tag == 0x8769 { // Exif sub-IFD
+				walk(int(order.Uint32(b[entry+8:entry+12])), depth+1)
+			}
+		}
+	}
+	walk(int(order.Uint32(b[4:8])), 0)
+	return found
+}
+
+// orientationExif is a minimal APP1 segment holding only an orientation tag.
+func orientationExif(orientation int) []byte {
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1, 0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, byte(orientation), 0, 0, 0, 0, 0, 0, 0, 0}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	length := len(payload) + 2
+	return append([]byte{0xFF, 0xE1, byte(length >> 8), byte(length)}, payload...)
+}
+
+// stripJPEG drops metadata segments from a JPEG, everything from the start of the image data on is copied as is.
+func stripJPEG(in []byte) ([]byte, []string) {
+	if !bytes.HasPrefix(in, []byte{0xFF, 0xD8}) {
+		return in, nil
+	}
+	out := []byte{0xFF, 0xD8}
+	removed := []string{}
+	orientation := 1
+
+	i := 2
+	for i+4 <= len(in) {
+		if in[i] != 0xFF {
+			return in, nil // not a marker, leave the file alone
+		}
+		marker := in[i+1]
+		if marker == 0xFF { // fill byte
+			i++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(in[i+2 : i+4]))
+		end := i + 2 + length
+		if length < 2 || end > len(in) {
+			return in, nil
+		}
+		segment := in[i+4 : end]
+
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")):
+			removed = append(removed, "exif")
+			removed = append(removed, exifDetails(segment[6:])...)
+			if o := tiffOrientation(segment[6:]); o >= 2 && o <= 8 {
+				orientation = o
+			}
+		case marker == 0xE1 && bytes.HasPrefix(segment, []byte("http://ns.adobe.com/")):
+			removed = append(removed, "xmp")
+		case marker == 0xED && bytes.HasPrefix(segment, []byte("Photoshop 3.0\x00")):
+			removed = append(removed, "iptc")
+		case marker == 0xFE:
+			removed = append(removed, "comment")
+		default:
+			out = append(out, in[i:end]...)
+		}
+		i = end
+	}
+	if len(removed) == 0 {
+		return in, nil
+	}
+
+	if orientation != 1 {
+		// keep the photo upright: put the orientation back right after SOI (and APP0 if it is first).
+		at := 2
+		if len(out) >= 6 && out[2] == 0xFF && out[3] == 0xE0 {
+			at += 2 + int(binary.BigEndian.Uint16(out[4:6]))
+		}
+		out = append(out[:at], append(orientationExif(orientation), out[at:]...)...)
+	}
+	return append(out, in[i:]...), removed
+}
+
+// stripPNG drops text and metadata chunks from a PNG.
+func stripPNG(in []byte) ([]byte, []string) {
+	signature := []byte("\x89PNG\r\n\x1a\n")
+	if !bytes.HasPrefix(in, signature) {
+		return in, nil
+	}
+	out := append([]byte{}, signature...)
+	removed := []string{}
+
+	for i := len(signature); i+12 <= len(in); {
+		length := int(binary.BigEndian.Uint32(in[i : i+4]))
+		end := i + 12 + length
+		if length < 0 || end > len(in) {
+			return in, nil
+		}
+		kind := string(in[i+4 : i+8])
+		data := in[i+8 : i+8+length]
+
+		switch kind {
+		case "eXIf":
+			removed = append(removed, "exif")
+			removed = append(removed, exifDetails(data)...)
+		case "iTXt":
+			if bytes.HasPrefix(data, []byte("XML:com.adobe.xmp\x00")) {
+				removed = append(removed, "xmp")
+			} else {
+				removed = append(removed, "text")
+			}
+		case "tEXt", "zTXt":
+			removed = append(removed, "text")
+		case "tIME":
+			removed = append(removed, "date_time")
+		default:
+			out = append(out, in[i:end]...)
+		}
+		i = end
+	}
+	if len(removed) == 0 {
+		return in, nil
+	}
+	return out, removed
+}
+
+// stripWebP drops the EXIF and XMP chunks of a WebP and clears their flags in the VP8X header.
+func stripWebP(in []byte) ([]byte, []string) {
+	if len(in) < 12 || string(in[0:4]) != "RIFF" || string(in[8:12]) != "WEBP" {
+		return in, nil
+	}
+	out := append([]byte{}, in[:12]...)
+	removed := []string{}
+
+	for i := 12; i+8 <= len(in); {
+		size := int(binary.LittleEndian.Uint32(in[i+4 : i+8]))
+		end := i + 8 + size + size%2
+		if size < 0 || end > len(in) {
+			return in, nil
+		}
+		switch string(in[i : i+4]) {
+		case "EXIF":
+			removed = append(removed, "exif")
+			removed = append(removed, exifDetails(bytes.TrimPrefix(in[i+8:i+8+size], []byte("Exif\x00\x00")))...)
+		case "XMP ":
+			removed = append(removed, "xmp")
+		default:
+			out = append(out, in[i:end]...)
+		}
+		i = end
+	}
+	if len(removed) == 0 {
+		return in, nil
+	}
+
+	// VP8X flags: 0x08 means there is EXIF, 0x04 XMP.
+	if len(out) >= 21 && string(out[12:16]) == "VP8X" {
+		out[20] &^= 0x08 | 0x04
+	}
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out, removed
+}
+
+// videoTags are the container tags ffmpeg itself writes, not worth reporting. rotation survives stripping
+// (ffmpeg keeps it as stream side data), so it is not reported either.
+var videoTags = map[string]bool{
+	"major_brand": true, "minor_version": true, "compatible_brands": true, "encoder": true,
+	"handler_name": true, "vendor_id": true, "language": true, "rotate": true,
+}
+
+// videoMetadata names the metadata tags of a video (or audio file) worth reporting.
+func videoMetadata(ctx context.Context, path string) ([]string, error) {
+	info, err := probe(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	found := []string{}
+	for _, tag := range info.Tags {
+		switch {
+		case videoTags[tag]:
+		case strings.Contains(tag, "location") || strings.Contains(tag, "gps") || tag == "xyz":
+			found = append(found, "gps_location")
+		case strings.HasSuffix(tag, "make"):
+			found = append(found, "camera_make")
+		case strings.HasSuffix(tag, "model"):
+			found = append(found, "camera_model")
+		case strings.HasSuffix(tag, "software"):
+			found = append(found, "software")
+		case strings.Contains(tag, "creation") || strings.Contains(tag, "date"):
+			found = append(found, "date_time")
+		default:
+			found = append(found, "metadata:"+tag)
+		}
+	}
+	return found, nil
+}
+
+// tidy sorts a report and removes duplicates.
+func tidy(removed []string) []string {
+	sort.Strings(removed)
+	out := []string{}
+	for _, r := range removed {
+		if len(out) == 0 || out[len(out)-1] != r {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// imageStripper returns the function that strips metadata from images of this type, nil if there is none.
+func imageStripper(mimeType string) func([]byte) ([]byte, []string) {
+	switch mimeType {
+	case "image/jpeg":
+		return stripJPEG
+	case "image/png":
+		return stripPNG
+	case "image/webp":
+		return stripWebP
+	}
+	return nil
+}
+
+// readImage reads a whole image from the media store.
+func readImage(ctx context.Context, item Item) ([]byte, error) {
+	r, err := mediaStore.Open(ctx, item.Filename)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(io.LimitReader(r, LimitFor("image")+1))
+}
+
+// Metadata lists the identifying metadata in an item's file, what Clean would remove.
+func Metadata(ctx context.Context, item Item) ([]string, error) {
+	switch {
+	case item.Kind == "image":
+		strip := imageStripper(item.MimeType)
+		if strip == nil {
+			return []string{}, nil
+		}
+		data, err := readImage(ctx, item)
+		if err != nil {
+			return nil, err
+		}
+		_, found := strip(data)
+		return tidy(found), nil
+	case item.Kind == "video" || item.Kind == "audio":
+		input, cleanup, err := LocalFile(ctx, item)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		found, err := videoMetadata(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		return tidy(found), nil
+	}
+	return []string{}, nil
+}
+
+// Clean returns a copy of item without identifying metadata, or item itself when it has none (or its kind
+// cannot be cleaned). The copy's Stripped field lists what was removed.
+func Clean(ctx context.Context, item Item) (Item, error) {
+	if rendition, ok := findRendition(item.ID, cleanKey); ok {
+		return rendition, nil
+	}
+
+	name := strings.TrimSuffix(item.OriginalName, path.Ext(item.OriginalName)) + "-clean" + path.Ext(item.Filename)
+	switch {
+	case item.Kind == "image":
+		return cleanImage(ctx, item, name)
+	case item.Kind == "video" || item.Kind == "audio":
+		return cleanVideo(ctx, item, name)
+	}
+	return item, nil
+}
+
+func cleanImage(ctx context.Context, item Item, name string) (Item, error) {
+	strip := imageStripper(item.MimeType)
+	if strip == nil {
+		return item, nil
+	}
+	data, err := readImage(ctx, item)
+	if err != nil {
+		return Item{}, err
+	}
+	clean, removed := strip(data)
+	if len(removed) == 0 {
+		return item, nil
+	}
+
+	created, err := derive(ctx, item, cleanKey, name, func(ctx context.Context, input string, output string) error {
+		return os.WriteFile(output, clean, 0644)
+	})
+	if err != nil {
+		return Item{}, err
+	}
+	return setStripped(created, tidy(removed))
+}
+
+func cleanVideo(ctx context.Context, item Item, name string) (Item, error) {
+	removed, err := Metadata(ctx, item)
+	if err != nil {
+		return Item{}, err
+	}
+	if len(removed) == 0 {
+		return item, nil
+	}
+
+	args := []string{"-map", "0:v?", "-map", "0:a?", "-map_metadata", "-1", "-map_metadata:s", "-1", "-map_chapters", "-1", "-c", "copy"}
+	if item.Kind == "video" {
+		args = append(args, "-movflags", "+faststart")
+	}
+	created, err := derive(ctx, item, cleanKey, name, func(ctx context.Context, input string, output string) error {
+		return runFFmpeg(ctx, input, append(args, output))
+	})
+	if err != nil {
+		return Item{}, err
+	}
+	return setStripped(created, removed)
+}
+
+// setStripped records what was removed on a clean copy. A copy that is not a rendition (the same bytes
+// had been uploaded on their own) is left alone.
+func setStripped(item Item, removed []string) (Item, error) {
+	if item.Source == "" {
+		return item, nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	stored, ok := items[item.ID]
+	if !ok {
+		return Item{}, ErrNotFound
+	}
+	stored.Stripped = removed
+	return stored.copy(), save()
+}
+
+// cleanForPublish is the privacy stage of OpenFor: converted is what ForPlatform made of original.
+// The Stripped field of the returned item lists everything the published file lost compared to the original,
+// image variants are re-encoded without any metadata so what the original had counts as removed too.
+// Without ffmpeg or ffprobe a video keeps its metadata. Either that, or the original's metadata not being readable,
+// is set as the item's MetadataWarning so the post's result can say so.
+func cleanForPublish(ctx context.Context, original Item, converted Item) (Item, error) {
+	clean, err := Clean(ctx, converted)
+	if errors.Is(err, ErrNoFFmpeg) || errors.Is(err, ErrNoFFprobe) {
+		log.Warnf("metadata of %s not removed: %v", converted.ID, err)
+		converted.MetadataWarning = "metadata not removed: " + err.Error()
+		return converted, nil
+	}
+	if err != nil {
+		return Item{}, err
+	}
+
+	removed := clean.Stripped
+	if converted.ID != original.ID {
+		found, err := Metadata(ctx, original)
+		if err != nil {
+			log.Warnf("reading metadata of %s: %v", original.ID, err)
+			clean.MetadataWarning = "metadata_removed may be incomplete, the original's metadata could not be read: " + err.Error()
+		}
+		removed = tidy(append(append([]string{}, removed...), found...))
+	}
+	clean.Stripped = removed
+	return clean, nil
+}
@@ -0,0 +1,245 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const (
+	fixtureMake   = "FixtureCam"
+	fixtureSerial = "SN-4815162342"
+	fixtureXMP    = `<x:xmpmeta xmlns:x="adobe:ns:meta/"><exif:GPSLatitude>52,22.5N</exif:GPSLatitude></x:xmpmeta>`
+	fixtureIPTC   = "Sub-location: 221B Baker Street"
+	fixtureNote   = "shot at home"
+)
+
+// ifdEntry is one 12 byte TIFF directory entry, value is the inline value or offset.
+func ifdEntry(tag uint16, kind uint16, count uint32, value uint32) []byte {
+	e := binary.BigEndian.AppendUint16(nil, tag)
+	e = binary.BigEndian.AppendUint16(e, kind)
+	e = binary.BigEndian.AppendUint32(e, count)
+	if kind == 3 && count == 1 { // a SHORT sits in the first two bytes
+		return binary.BigEndian.AppendUint32(e, value<<16)
+	}
+	return binary.BigEndian.AppendUint32(e, value)
+}
+
+// tiffFixture is a big endian TIFF structure like a phone writes: camera make, orientation and a GPS position
+// in IFD0, and a serial number in the Exif sub-IFD.
+func tiffFixture(orientation int) []byte {
+	const ifd0, exifIFD, gpsIFD, strings = 8, 8 + 2 + 4*12 + 4, 8 + 2 + 4*12 + 4 + 2 + 12 + 4, 8 + 2 + 4*12 + 4 + 2 + 12 + 4 + 2 + 12 + 4
+	b := []byte{'M', 'M', 0, 42, 0, 0, 0, ifd0}
+	b = binary.BigEndian.AppendUint16(b, 4)
+	b = append(b, ifdEntry(0x010F, 2, uint32(len(fixtureMake)+1), strings)...)
+	b = append(b, ifdEntry(0x0112, 3, 1, uint32(orientation))...)
+	b = append(b, ifdEntry(0x8769, 4, 1, exifIFD)...)
+	b = append(b, ifdEntry(0x8825, 4, 1, gpsIFD)...)
+	b = append(b, 0, 0, 0, 0)
+	b = binary.BigEndian.AppendUint16(b, 1)
+	b = append(b, ifdEntry(0xA431, 2, uint32(len(fixtureSerial)+1), strings+uint32(len(fixtureMake)+1))...)
+	b = append(b, 0, 0, 0, 0)
+	b = binary.BigEndian.AppendUint16(b, 1)
+	b = append(b, ifdEntry(0x0001, 2, 2, 'N'<<24)...) // GPSLatitudeRef
+	b = append(b, 0, 0, 0, 0)
+	b = append(b, fixtureMake+"\x00"+fixtureSerial+"\x00"...)
+	return b
+}
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	length := len(payload) + 2
+	return append([]byte{0xFF, marker, byte(length >> 8), byte(length)}, payload...)
+}
+
+// jpegFixture is a real 8x4 JPEG carrying EXIF (with GPS), XMP, IPTC and a comment.
+func jpegFixture(t *testing.T, orientation int) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, image.NewGray(image.Rect(0, 0, 8, 4)), nil); err != nil {
+		t.Fatal(err)
+	}
+	out := []byte{0xFF, 0xD8}
+	out = append(out, jpegSegment(0xE0, []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00"))...)
+	out = append(out, jpegSegment(0xE1, append([]byte("Exif\x00\x00"), tiffFixture(orientation)...))...)
+	out = append(out, jpegSegment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00"+fixtureXMP))...)
+	out = append(out, jpegSegment(0xED, []byte("Photoshop 3.0\x008BIM\x04\x04\x00\x00"+fixtureIPTC))...)
+	out = append(out, jpegSegment(0xFE, []byte(fixtureNote))...)
+	return append(out, encoded.Bytes()[2:]...)
+}
+
+func pngChunk(kind string, data []byte) []byte {
+	c := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	c = append(append(c, kind...), data...)
+	return binary.BigEndian.AppendUint32(c, crc32.ChecksumIEEE(c[4:]))
+}
+
+// pngFixture is a real 8x4 PNG carrying eXIf (with GPS), XMP, a text chunk and a modification time.
+func pngFixture(t *testing.T) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewGray(image.Rect(0, 0, 8, 4))); err != nil {
+		t.Fatal(err)
+	}
+	b := encoded.Bytes()
+	ihdrEnd := 8 + 12 + 13
+	out := append([]byte{}, b[:ihdrEnd]...)
+	out = append(out, pngChunk("eXIf", tiffFixture(1))...)
+	out = append(out, pngChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"+fixtureXMP))...)
+	out = append(out, pngChunk("tEXt", []byte("Comment\x00"+fixtureNote))...)
+	out = append(out, pngChunk("tIME", []byte{0x07, 0xE8, 5, 24, 12, 0, 0})...)
+	return append(out, b[ihdrEnd:]...)
+}
+
+func riffChunk(kind string, data []byte) []byte {
+	c := append([]byte(kind), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	c = append(c, data...)
+	if len(data)%2 == 1 {
+		c = append(c, 0)
+	}
+	return c
+}
+
+// webpFixture is an extended WebP whose VP8X header announces EXIF and XMP chunks.
+func webpFixture() []byte {
+	vp8x := []byte{0x08 | 0x04, 0, 0, 0, 7, 0, 0, 3, 0, 0} // flags, reserved, 8x4 canvas
+	body := []byte("WEBP")
+	body = append(body, riffChunk("VP8X", vp8x)...)
+	body = append(body, riffChunk("VP8L", []byte("pixels!"))...)
+	body = append(body, riffChunk("EXIF", append([]byte("Exif\x00\x00"), tiffFixture(1)...))...)
+	body = append(body, riffChunk("XMP ", []byte(fixtureXMP))...)
+	return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+}
+
+// assertGone fails for every piece of identifying metadata still in b.
+func assertGone(t *testing.T, b []byte) {
+	t.Helper()
+	for _, s := range []string{fixtureMake, fixtureSerial, "GPSLatitude", fixtureIPTC, fixtureNote, "Photoshop 3.0", "http://ns.adobe.com/"} {
+		if bytes.Contains(b, []byte(s)) {
+			t.Errorf("%q is still in the stripped file", s)
+		}
+	}
+}
+
+func TestStripJPEG(t *testing.T) {
+	want := []string{"camera_make", "camera_serial", "comment", "exif", "gps_location", "iptc", "xmp"}
+	for _, orientation := range []int{1, 6} {
+		in := jpegFixture(t, orientation)
+		out, removed := stripJPEG(in)
+		if got := tidy(removed); !slices.Equal(got, want) {
+			t.Errorf("orientation %d: removed %v, want %v", orientation, got, want)
+		}
+		assertGone(t, out)
+
+		img, err := jpeg.Decode(bytes.NewReader(out))
+		if err != nil {
+			t.Fatalf("orientation %d: stripped file does not decode: %v", orientation, err)
+		}
+		if b := img.Bounds(); b.Dx() != 8 || b.Dy() != 4 {
+			t.Errorf("orientation %d: stripped image is %v", orientation, b)
+		}
+		// the photo stays upright: the orientation is kept in a fresh EXIF, and only when it is not the default.
+		if got := readOrientation(bytes.NewReader(out)); got != orientation {
+			t.Errorf("orientation %d: stripped file has orientation %d", orientation, got)
+		}
+		if hasExif := bytes.Contains(out, []byte("Exif\x00\x00")); hasExif != (orientation != 1) {
+			t.Errorf("orientation %d: EXIF in the stripped file: %v", orientation, hasExif)
+		}
+	}
+
+	// anything else, and a JPEG without metadata, is left alone.
+	if out, removed := stripJPEG([]byte("not a jpeg")); removed != nil || string(out) != "not a jpeg" {
+		t.Errorf("not a JPEG: removed %v", removed)
+	}
+	plain, _ := stripJPEG(jpegFixture(t, 1))
+	if again, removed := stripJPEG(plain); removed != nil || !bytes.Equal(again, plain) {
+		t.Errorf("stripping twice removed %v", removed)
+	}
+}
+
+func TestStripPNG(t *testing.T) {
+	out, removed := stripPNG(pngFixture(t))
+	want := []string{"camera_make", "camera_serial", "date_time", "exif", "gps_location", "text", "xmp"}
+	if got := tidy(removed); !slices.Equal(got, want) {
+		t.Errorf("removed %v, want %v", got, want)
+	}
+	assertGone(t, out)
+	for _, kind := range []string{"eXIf", "iTXt", "tEXt", "tIME"} {
+		if bytes.Contains(out, []byte(kind)) {
+			t.Errorf("%s chunk is still there", kind)
+		}
+	}
+	if _, err := png.Decode(bytes.NewReader(out)); err != nil {
+		t.Errorf("stripped file does not decode: %v", err)
+	}
+	if again, removed := stripPNG(out); removed != nil || !bytes.Equal(again, out) {
+		t.Errorf("stripping twice removed %v", removed)
+	}
+}
+
+func TestStripWebP(t *testing.T) {
+	out, removed := stripWebP(webpFixture())
+	want := []string{"camera_make", "camera_serial", "exif", "gps_location", "xmp"}
+	if got := tidy(removed); !slices.Equal(got, want) {
+		t.Errorf("removed %v, want %v", got, want)
+	}
+	assertGone(t, out)
+	if size := int(binary.LittleEndian.Uint32(out[4:8])); size != len(out)-8 {
+		t.Errorf("RIFF size %d, file is %d", size, len(out))
+	}
+	if flags := out[20]; flags&(0x08|0x04) != 0 {
+		t.Errorf("VP8X still announces metadata: flags %#x", flags)
+	}
+	if !bytes.Contains(out, riffChunk("VP8L", []byte("pixels!"))) {
+		t.Error("the image data was dropped")
+	}
+}
+
+// Clean keeps the original as it is and publishes a rendition, whose Stripped says what it lost.
+func TestCleanReportsStripped(t *testing.T) {
+	dir, _ := useLibrary(t)
+	t.Setenv("FFprobePath", filepath.Join(dir, "missing"))
+	t.Setenv("FFmpegPath", filepath.Join(dir, "missing"))
+
+	path, err := StagingPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := Save(bytes.NewReader(jpegFixture(t, 6)), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, _, err := Add(saved, "holiday.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := Metadata(context.Background(), original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clean, err := Clean(context.Background(), original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clean.ID == original.ID || clean.Source != original.ID {
+		t.Fatalf("clean copy %+v of %s", clean, original.ID)
+	}
+	if !slices.Equal(clean.Stripped, found) || !slices.Contains(found, "gps_location") {
+		t.Errorf("stripped %v, metadata was %v", clean.Stripped, found)
+	}
+	if clean.Orientation != 6 || clean.Width != original.Width || clean.Height != original.Height {
+		t.Errorf("clean copy is %dx%d orientation %d, original %dx%d orientation %d",
+			clean.Width, clean.Height, clean.Orientation, original.Width, original.Height, original.Orientation)
+	}
+	// all that is left is the EXIF holding the orientation.
+	if left, err := Metadata(context.Background(), clean); err != nil || !slices.Equal(left, []string{"exif"}) {
+		t.Errorf("metadata of the clean copy: %v, %v", left, err)
+	}
+}
@@ -0,0 +1,171 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// video and audio are probed with ffprobe (it ships with ffmpeg) for their duration, resolution, codecs and frame rate.
+// without ffprobe only mp4/mov files are inspected, by reading their moov box (inspect.go), which gives duration and size.
+//
+//	FFprobePath  ffprobe binary to run (default "ffprobe" from PATH)
+
+// ErrNoFFprobe is returned when ffprobe is not installed.
+var ErrNoFFprobe = errors.New("ffprobe is not installed (set FFprobePath if it is not on PATH)")
+
+const probeTimeout = 30 * time.Second
+
+func ffprobePath() string {
+	if v := os.Getenv("FFprobePath"); v != "" {
+		return v
+	}
+	return "ffprobe"
+}
+
+// probeInfo is what ffprobe found in a file.
+type probeInfo struct {
+	Duration   float64
+	Width      int // as displayed, after rotation
+	Height     int
+	VideoCodec string
+	AudioCodec string
+	FrameRate  float64
+	Bitrate    int64    // bits per second, whole file
+	Tags       []string // names of the metadata tags of the file and its streams, lowercased
+}
+
+// the parts of ffprobe's -print_format json output we read.
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType    string            `json:"codec_type"`
+		CodecName    string            `json:"codec_name"`
+		Width        int               `json:"width"`
+		Height       int               `json:"height"`
+		AvgFrameRate string            `json:"avg_frame_rate"`
+		RFrameRate   string            `json:"r_frame_rate"`
+		Tags         map[string]string `json:"tags"`
+		SideDataList []struct {
+			Rotation float64 `json:"rotation"`
+		} `json:"side_data_list"`
+		Disposition struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+	} `json:"streams"`
+	Format struct {
+		Duration string            `json:"duration"`
+		BitRate  string            `json:"bit_rate"`
+		Tags     map[string]string `json:"tags"`
+	} `json:"format"`
+}
+
+// probe runs ffprobe on the file at path.
+func probe(ctx context.Context, path string) (probeInfo, error) {
+	ffprobe, err := exec.LookPath(ffprobePath())
+	if err != nil {
+		return probeInfo{}, ErrNoFFprobe
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, ffprobe, "-v", "error", "-print_format", "json", "-show_format", "-show_streams", path)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &limitedBuffer{buf: &stderr, limit: 4096}
+	if err := cmd.Run(); err != nil {
+		return probeInfo{}, errors.New("ffprobe failed: " + err.Error() + ": " + strings.TrimSpace(stderr.String()))
+	}
+
+	var out ffprobeOutput
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return probeInfo{}, err
+	}
+
+	var info probeInfo
+	info.Duration, _ = strconv.ParseFloat(out.Format.Duration, 64)
+	info.Bitrate, _ = strconv.ParseInt(out.Format.BitRate, 10, 64)
+	for tag := range out.Format.Tags {
+		info.Tags = append(info.Tags, strings.ToLower(tag))
+	}
+	for _, s := range out.Streams {
+		for tag := range s.Tags {
+			info.Tags = append(info.Tags, strings.ToLower(tag))
+		}
+		switch {
+		case s.CodecType == "video" && s.Disposition.AttachedPic == 0 && info.VideoCodec == "":
+			info.VideoCodec = s.CodecName
+			info.Width, info.Height = s.Width, s.Height
+			info.FrameRate = parseRate(s.AvgFrameRate)
+			if info.FrameRate == 0 {
+				info.FrameRate = parseRate(s.RFrameRate)
+			}
+			// phone videos are often stored sideways with a rotation to apply when playing.
+			rotation, _ := strconv.ParseFloat(s.Tags["rotate"], 64)
+			for _, side := range s.SideDataList {
+				if side.Rotation != 0 {
+					rotation = side.Rotation
+				}
+			}
+			if math.Mod(math.Abs(rotation), 180) == 90 {
+				info.Width, info.Height = info.Height, info.Width
+			}
+		case s.CodecType == "audio" && info.AudioCodec == "":
+			info.AudioCodec = s.CodecName
+		}
+	}
+	return info, nil
+}
+
+// parseRate reads ffprobe frame rates like "30000/1001".
+func parseRate(rate string) float64 {
+	num, den, found := strings.Cut(rate, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	if !found {
+		return n
+	}
+	d, err := strconv.ParseFloat(den, 64)
+	if err != nil || d == 0 {
+		return 0
+	}
+	return math.Round(n/d*1000) / 1000
+}
+
+// Reprobe inspects an item's file again, e.g. after installing ffprobe, and stores what it finds.
+func Reprobe(ctx context.Context, id string) (Item, error) {
+	current, err := Get(id)
+	if err != nil {
+		return Item{}, err
+	}
+	path, cleanup, err := LocalFile(ctx, current)
+	if err != nil {
+		return Item{}, err
+	}
+	defer cleanup()
+
+	probed := current
+	inspect(&probed, path)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	item, ok := items[id]
+	if !ok || item.Deleted {
+		return Item{}, ErrNotFound
+	}
+	item.Width, item.Height, item.Duration = probed.Width, probed.Height, probed.Duration
+	item.Orientation = probed.Orientation
+	item.VideoCodec, item.AudioCodec = probed.VideoCodec, probed.AudioCodec
+	item.FrameRate, item.Bitrate = probed.FrameRate, probed.Bitrate
+	return item.copy(), save()
+}
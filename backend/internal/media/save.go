@@ -0,0 +1,91 @@
+package media
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrEmptyFile is returned by Save when there is nothing to save.
+var ErrEmptyFile = errors.New("file is empty")
+
+// TooLargeError is returned when a file goes over the limit for its kind.
+type TooLargeError struct {
+	Kind  string
+	Limit int64
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("%s files are limited to %d MB", e.Kind, e.Limit>>20)
+}
+
+// Saved describes a file written by Save.
+type Saved struct {
+	Path     string
+	Size     int64
+	MimeType string
+	Checksum string // sha256, hex encoded
+}
+
+// Save streams r to path without buffering it in memory. The type is sniffed from the first bytes,
+// the size limit for that type is enforced while copying, and the sha256 is computed on the way through.
+// If anything fails the partial file is removed.
+func Save(r io.Reader, path string) (Saved, error) {
+	br := bufio.NewReaderSize(r, SniffLen)
+	head, err := br.Peek(SniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return Saved{}, err
+	}
+	if len(head) == 0 {
+		return Saved{}, ErrEmptyFile
+	}
+
+	mimeType := DetectType(head)
+	kind := Kind(mimeType)
+	limit := LimitFor(kind)
+
+	dst, err := os.Create(path)
+	if err != nil {
+		return Saved{}, err
+	}
+
+	hash := sha256.New()
+	// read one byte past the limit so we can tell "exactly at the limit" from "over it".
+	n, err := io.Copy(io.MultiWriter(dst, hash), io.LimitReader(br, limit+1))
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > limit {
+		err = &TooLargeError{Kind: kind, Limit: limit}
+	}
+	if err != nil {
+		os.Remove(path)
+		return Saved{}, err
+	}
+
+	return Saved{
+		Path:     path,
+		Size:     n,
+		MimeType: mimeType,
+		Checksum: hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// checksumFile returns the hex sha256 of the file at path.
+func checksumFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
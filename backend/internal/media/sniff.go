@@ -0,0 +1,47 @@
+package media
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+)
+
+// we never trust the Content-Type the client sends, the type comes from the first bytes of the file.
+
+// SniffLen is how many bytes DetectType needs to look at.
+const SniffLen = 512
+
+// DetectType returns the MIME type of a file given its first bytes.
+// It wraps http.DetectContentType and adds the ISO media containers it does not know about (quicktime, heic).
+func DetectType(head []byte) string {
+	if len(head) >= 12 && bytes.Equal(head[4:8], []byte("ftyp")) {
+		switch string(head[8:12]) {
+		case "qt  ":
+			return "video/quicktime"
+		case "heic", "heix", "hevc", "hevx", "mif1", "msf1":
+			return "image/heic"
+		case "M4A ":
+			return "audio/mp4"
+		}
+	}
+
+	mimeType := http.DetectContentType(head)
+	// drop parameters like "; charset=utf-8"
+	if i := strings.Index(mimeType, ";"); i >= 0 {
+		mimeType = strings.TrimSpace(mimeType[:i])
+	}
+	return mimeType
+}
+
+// Kind groups a MIME type into "image", "video", "audio" or "other".
+func Kind(mimeType string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return "image"
+	case strings.HasPrefix(mimeType, "video/"):
+		return "video"
+	case strings.HasPrefix(mimeType, "audio/"):
+		return "audio"
+	}
+	return "other"
+}
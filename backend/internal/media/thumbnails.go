@@ -0,0 +1,86 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// candidate thumbnails (poster frames) are grabbed from a video with ffmpeg at chosen timestamps. each frame is a
+// JPEG rendition of the video keyed "frame@<seconds>", so it has a media id of its own, is made only once and goes
+// away with the video. a publish request picks a thumbnail per platform by media id ("thumbnails"), any uploaded
+// image works too. before it is sent the thumbnail gets the platform's image variant like every other image.
+
+// maxFrames is how many frames one request may extract.
+const maxFrames = 20
+
+// ErrInvalidFrameTime is returned for a timestamp before the start or after the end of the video.
+var ErrInvalidFrameTime = errors.New("frame times must be within the video")
+
+// ErrTooManyFrames is returned when more than maxFrames frames are asked for at once.
+var ErrTooManyFrames = fmt.Errorf("at most %d frames can be extracted at once", maxFrames)
+
+const framePrefix = "frame@"
+
+// defaultFrameTimes spreads a few candidates over the video, skipping the very start (often black).
+func defaultFrameTimes(duration float64) []float64 {
+	if duration <= 0 {
+		return []float64{0}
+	}
+	times := []float64{}
+	for _, f := range []float64{0.1, 0.3, 0.5, 0.7, 0.9} {
+		times = append(times, math.Round(duration*f*10)/10)
+	}
+	return times
+}
+
+// Frames extracts a frame of the video with the given id at every time (seconds from the start) and returns them
+// as image items, in the same order. Without times a few are picked across the video.
+func Frames(ctx context.Context, id string, times []float64) ([]Item, error) {
+	src, err := Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if src.Kind != "video" {
+		return nil, ErrNotTranscodable
+	}
+	if len(times) == 0 {
+		times = defaultFrameTimes(src.Duration)
+	}
+	if len(times) > maxFrames {
+		return nil, ErrTooManyFrames
+	}
+	for _, t := range times {
+		if t < 0 || math.IsNaN(t) || (src.Duration > 0 && t > src.Duration) {
+			return nil, ErrInvalidFrameTime
+		}
+	}
+
+	frames := []Item{}
+	for _, t := range times {
+		at := strconv.FormatFloat(math.Round(t*1000)/1000, 'f', -1, 64)
+		name := strings.TrimSuffix(src.OriginalName, path.Ext(src.OriginalName)) + "-frame-" + at + "s.jpg"
+		frame, err := derive(ctx, src, framePrefix+at, name, func(ctx context.Context, input string, output string) error {
+			// -ss before the input seeks by keyframe and then decodes up to the exact time, which is fast on long videos.
+			return runFFmpegWith(ctx, []string{"-ss", at}, input, []string{"-frames:v", "1", "-q:v", "2", "-f", "image2", output})
+		})
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// FrameTime returns the time (seconds) a frame extracted by Frames was taken at in the video it came from.
+func FrameTime(item Item) (float64, bool) {
+	if item.Source == "" || !strings.HasPrefix(item.Rendition, framePrefix) {
+		return 0, false
+	}
+	t, err := strconv.ParseFloat(strings.TrimPrefix(item.Rendition, framePrefix), 64)
+	return t, err == nil
+}
@@ -0,0 +1,334 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// every network wants video in a slightly different shape. instead of exporting a file per platform by hand,
+// a video is transcoded with the local ffmpeg into a rendition that fits the platform's profile below.
+// renditions are library items of their own (Source points at the original), so each one is only made once
+// and later posts to the same platform reuse it.
+//
+// settings, read from the environment (config/.env):
+//
+//	FFmpegPath               ffmpeg binary to run (default "ffmpeg" from PATH)
+//	TranscodeTimeoutMinutes  how long a single transcode may take (default 30)
+
+// ErrNoFFmpeg is returned when ffmpeg is not installed. Publishing then falls back to the original file.
+var ErrNoFFmpeg = errors.New("ffmpeg is not installed (set FFmpegPath if it is not on PATH)")
+
+// ErrUnknownProfile is returned when there is no video or image profile for a platform.
+var ErrUnknownProfile = errors.New("no media profile for this platform")
+
+// ErrNotTranscodable is returned for media that has nothing to transcode (images, audio, documents).
+var ErrNotTranscodable = errors.New("only video can be transcoded")
+
+// Profile describes the video a platform accepts. Output is always H.264/AAC in an mp4.
+type Profile struct {
+	Width        int     `json:"width"`  // with Crop, the exact output size. otherwise the largest allowed, in landscape
+	Height       int     `json:"height"` // (a portrait source is held to the same box turned on its side)
+	Crop         bool    `json:"crop"`   // fill Width x Height exactly, cropping the edges, e.g. 9:16 for reels
+	MaxFPS       int     `json:"max_fps"`
+	MaxBitrate   int     `json:"max_bitrate"`   // video, kbit/s
+	AudioBitrate int     `json:"audio_bitrate"` // kbit/s
+	MaxDuration  float64 `json:"max_duration"`  // seconds, longer videos are cut. 0 for no limit
+}
+
+// Profiles holds the transcoding profile of every platform that takes video. A MaxDuration is the same as the
+// platform's rule (PlatformRules), so only videos the compliance check already refuses would be cut.
+var Profiles = map[string]Profile{
+	"instagram": {Width: 1080, Height: 1920, Crop: true, MaxFPS: 30, MaxBitrate: 8000, AudioBitrate: 128, MaxDuration: 90},
+	"youtube":   {Width: 1920, Height: 1080, MaxFPS: 60, MaxBitrate: 12000, AudioBitrate: 192},
+	"pinterest": {Width: 1080, Height: 1920, MaxFPS: 30, MaxBitrate: 8000, AudioBitrate: 128, MaxDuration: 900},
+	"linkedin":  {Width: 1920, Height: 1080, MaxFPS: 30, MaxBitrate: 8000, AudioBitrate: 128, MaxDuration: 1800},
+	"reddit":    {Width: 1920, Height: 1080, MaxFPS: 30, MaxBitrate: 8000, AudioBitrate: 128, MaxDuration: 900},
+}
+
+// renditionLocks makes sure two posts needing the same rendition do not both run ffmpeg for it.
+var renditionLocks sync.Map // source id + rendition -> *sync.Mutex
+
+func ffmpegPath() string {
+	if v := os.Getenv("FFmpegPath"); v != "" {
+		return v
+	}
+	return "ffmpeg"
+}
+
+func transcodeTimeout() time.Duration {
+	if v := os.Getenv("TranscodeTimeoutMinutes"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return time.Duration(n) * time.Minute
+		}
+	}
+	return 30 * time.Minute
+}
+
+// outputArgs are the ffmpeg options (everything after the input) that turn src into this profile.
+func (p Profile) outputArgs(src Item) []string {
+	var filter string
+	if p.Crop {
+		filter = fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d,setsar=1", p.Width, p.Height, p.Width, p.Height)
+	} else {
+		w, h := p.Width, p.Height
+		if src.Height > src.Width {
+			w, h = h, w
+		}
+		// only ever scale down, keeping the aspect ratio. x264 needs even dimensions.
+		filter = fmt.Sprintf("scale=w='min(%d,iw)':h='min(%d,ih)':force_original_aspect_ratio=decrease:force_divisible_by=2,setsar=1", w, h)
+	}
+
+	args := []string{
+		"-map", "0:v:0", "-map", "0:a:0?",
+		"-vf", filter,
+		"-c:v", "libx264", "-preset", "medium", "-profile:v", "high", "-pix_fmt", "yuv420p", "-crf", "23",
+		"-maxrate", fmt.Sprintf("%dk", p.MaxBitrate), "-bufsize", fmt.Sprintf("%dk", 2*p.MaxBitrate),
+		"-c:a", "aac", "-b:a", fmt.Sprintf("%dk", p.AudioBitrate), "-ar", "48000", "-ac", "2",
+	}
+	if p.MaxFPS > 0 {
+		args = append(args, "-fpsmax", strconv.Itoa(p.MaxFPS))
+	}
+	if p.MaxDuration > 0 {
+		args = append(args, "-t", strconv.FormatFloat(p.MaxDuration, 'f', -1, 64))
+	}
+	return append(args, "-movflags", "+faststart", "-f", "mp4")
+}
+
+// renditionKey names a rendition after the platform and the exact ffmpeg options used,
+// so changing a profile makes new renditions instead of reusing stale ones.
+func renditionKey(platform string, args []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(args, "\x00")))
+	return platform + "@" + hex.EncodeToString(sum[:4])
+}
+
+// findRendition returns the live rendition of source with the given key, if it was made before.
+func findRendition(source string, key string) (Item, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, item := range items {
+		if item.Source == source && item.Rendition == key && !item.Deleted {
+			return item.copy(), true
+		}
+	}
+	return Item{}, false
+}
+
+// Renditions returns everything made from the item with the given id.
+func Renditions(id string) []Item {
+	mu.Lock()
+	defer mu.Unlock()
+
+	list := []Item{}
+	for _, item := range items {
+		if item.Source == id && !item.Deleted {
+			list = append(list, item.copy())
+		}
+	}
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].Rendition < list[b].Rendition
+	})
+	return list
+}
+
+// markRendition records that the item with the given id was made from source.
+func markRendition(id string, source string, key string) (Item, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	item, ok := items[id]
+	if !ok {
+		return Item{}, ErrNotFound
+	}
+	item.Source = source
+	item.Rendition = key
+	return item.copy(), save()
+}
+
+// Transcode returns the rendition of the video with the given id for platform, running ffmpeg if it does not exist yet.
+func Transcode(ctx context.Context, id string, platform string) (Item, error) {
+	src, err := Get(id)
+	if err != nil {
+		return Item{}, err
+	}
+	if src.Kind != "video" {
+		return Item{}, ErrNotTranscodable
+	}
+	profile, ok := Profiles[platform]
+	if !ok {
+		return Item{}, ErrUnknownProfile
+	}
+
+	args := profile.outputArgs(src)
+	name := strings.TrimSuffix(src.OriginalName, path.Ext(src.OriginalName)) + "-" + platform + ".mp4"
+	return derive(ctx, src, renditionKey(platform, args), name, func(ctx context.Context, input string, output string) error {
+		return runFFmpeg(ctx, input, append(args, output))
+	})
+}
+
+// derive returns the rendition of src with the given key, making it with produce (input is a local copy of src,
+// output the path to write) and adding the result to the library as name if it does not exist yet.
+func derive(ctx context.Context, src Item, key string, name string, produce func(ctx context.Context, input string, output string) error) (Item, error) {
+	lock, _ := renditionLocks.LoadOrStore(src.ID+"/"+key, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	if rendition, ok := findRendition(src.ID, key); ok {
+		return rendition, nil
+	}
+
+	input, cleanup, err := LocalFile(ctx, src)
+	if err != nil {
+		return Item{}, err
+	}
+	defer cleanup()
+
+	output, err := StagingPath()
+	if err != nil {
+		return Item{}, err
+	}
+	output += path.Ext(name)
+	defer os.Remove(output)
+
+	started := time.Now()
+	if err := produce(ctx, input, output); err != nil {
+		return Item{}, err
+	}
+	log.Infof("made %s from %s in %s", name, src.ID, time.Since(started).Round(time.Millisecond))
+
+	saved, err := savedFromFile(output)
+	if err != nil {
+		return Item{}, err
+	}
+	created, duplicate, err := Add(saved, name)
+	if err != nil {
+		return Item{}, err
+	}
+	if duplicate {
+		// the result is an item already: uploaded on its own, the original itself, or a rendition of another
+		// source that came out byte for byte the same. it is used as it is, re-parenting it would take it away
+		// from whatever it belongs to now.
+		return created, nil
+	}
+	return markRendition(created.ID, src.ID, key)
+}
+
+// runFFmpeg runs ffmpeg with the given arguments after the input, e.g. output options and the output path.
+func runFFmpeg(ctx context.Context, input string, args []string) error {
+	return runFFmpegWith(ctx, nil, input, args)
+}
+
+// runFFmpegWith is runFFmpeg with options that go before the input, e.g. "-ss" to seek.
+func runFFmpegWith(ctx context.Context, inputArgs []string, input string, args []string) error {
+	ffmpeg, err := exec.LookPath(ffmpegPath())
+	if err != nil {
+		return ErrNoFFmpeg
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, transcodeTimeout())
+	defer cancel()
+
+	full := append([]string{"-hide_banner", "-loglevel", "error", "-nostdin", "-y"}, inputArgs...)
+	full = append(append(full, "-i", input), args...)
+	cmd := exec.CommandContext(ctx, ffmpeg, full...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &limitedBuffer{buf: &stderr, limit: 4096}
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return fmt.Errorf("ffmpeg failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it, enough for ffmpeg's error message.
+type limitedBuffer struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (l *limitedBuffer) Write(p []byte) (int, error) {
+	if room := l.limit - l.buf.Len(); room > 0 {
+		if len(p) > room {
+			l.buf.Write(p[:room])
+		} else {
+			l.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// PublishOptions change what OpenFor makes of an item.
+type PublishOptions struct {
+	KeepMetadata bool   // send the file with its metadata (see Clean)
+	Watermark    string // watermark profile to apply (see ApplyWatermark), "" for none
+	Cover        string // media id of the image audio is rendered over (see RenderAudio), "" to send audio as is
+	Waveform     bool   // draw the audio's waveform over the cover
+}
+
+// OpenFor returns the file to publish to platform for a media reference (see Resolve): the rendition or variant
+// made for that platform (see ForPlatform), or for audio with a cover the video rendered from both, watermarked
+// if opts asks for it, and without its metadata unless opts.KeepMetadata is set (see Clean).
+// Without ffmpeg a video is used as is. The caller closes it.
+func OpenFor(ctx context.Context, ref string, platform string, opts PublishOptions) (io.ReadCloser, Item, error) {
+	item, err := Resolve(ref)
+	if err != nil {
+		return nil, Item{}, err
+	}
+
+	var converted Item
+	if item.Kind == "audio" && opts.Cover != "" {
+		// already made at the platform's size, so it is not transcoded again.
+		converted, err = RenderAudio(ctx, item.ID, opts.Cover, opts.Waveform, platform)
+	} else {
+		converted, err = ForPlatform(ctx, item, platform)
+	}
+	switch {
+	case errors.Is(err, ErrNoFFmpeg) && item.Kind != "audio":
+		log.Warnf("not transcoding %s for %s: %v", item.ID, platform, err)
+		converted = item
+	case err != nil:
+		return nil, Item{}, err
+	}
+	if opts.Watermark != "" {
+		marked, err := ApplyWatermark(ctx, converted, opts.Watermark)
+		switch {
+		case errors.Is(err, ErrNoFFmpeg):
+			log.Warnf("not watermarking %s for %s: %v", item.ID, platform, err)
+		case err != nil:
+			return nil, Item{}, err
+		default:
+			converted = marked
+		}
+	}
+	if !opts.KeepMetadata {
+		converted, err = cleanForPublish(ctx, item, converted)
+		if err != nil {
+			return nil, Item{}, err
+		}
+	}
+	item = converted
+
+	r, err := mediaStore.Open(ctx, item.Filename)
+	if err != nil {
+		return nil, Item{}, err
+	}
+	return r, item, nil
+}
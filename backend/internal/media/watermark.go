@@ -0,0 +1,332 @@
+package media
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/image/draw"
+
+	"github.com/TanishqM1/SocialContentDistributer/internal/store"
+)
+
+// watermark profiles put a logo over images (and, if the profile says so, videos) before they are published.
+// a profile is picked per post, or per platform inside a post; the watermarked file is a rendition of what would
+// have been sent otherwise (the platform's variant or transcode), so the original is never touched and the same
+// profile on the same file is only applied once. profiles are saved to watermarks.json in the data directory,
+// and every profile holds a reference on its logo so GC leaves it alone.
+//
+// images are composited in Go. videos need ffmpeg and are re-encoded, which is slow, so it is opt-in per profile.
+
+// ErrWatermarkNotFound is returned for a profile name that does not exist.
+var ErrWatermarkNotFound = errors.New("watermark profile not found")
+
+// InvalidWatermarkError says what is wrong with a profile.
+type InvalidWatermarkError struct {
+	Reason string
+}
+
+func (e *InvalidWatermarkError) Error() string {
+	return "invalid watermark profile: " + e.Reason
+}
+
+// positions a logo can be placed at.
+var watermarkPositions = []string{"top-left", "top-right", "bottom-left", "bottom-right", "center"}
+
+// Watermark is an overlay profile.
+type Watermark struct {
+	Name     string  `json:"name"`
+	Logo     string  `json:"logo"`     // media id of the logo, a PNG with transparency works best
+	Position string  `json:"position"` // one of watermarkPositions, default "bottom-right"
+	Opacity  float64 `json:"opacity"`  // 0 to 1, default 1
+	Margin   float64 `json:"margin"`   // distance from the edges, as a fraction of the image width
+	Scale    float64 `json:"scale"`    // logo width as a fraction of the image width, default 0.15
+	Video    bool    `json:"video"`    // burn the logo into videos too
+}
+
+var (
+	watermarksMu sync.Mutex
+	watermarks   = map[string]Watermark{}
+)
+
+func watermarksPath() string {
+	return store.Path("watermarks.json")
+}
+
+// LoadWatermarks reads watermarks.json. Call it once on startup.
+func LoadWatermarks() error {
+	watermarksMu.Lock()
+	defer watermarksMu.Unlock()
+	return store.Load(watermarksPath(), &watermarks)
+}
+
+// validate fills in defaults and checks the profile.
+func (wm *Watermark) validate() error {
+	if wm.Position == "" {
+		wm.Position = "bottom-right"
+	}
+	if wm.Opacity == 0 {
+		wm.Opacity = 1
+	}
+	if wm.Scale == 0 {
+		wm.Scale = 0.15
+	}
+
+	switch {
+	case wm.Name == "" || strings.ContainsAny(wm.Name, "/\\") || len(wm.Name) > 64:
+		return &InvalidWatermarkError{Reason: "name must be 1 to 64 characters without slashes"}
+	case !contains(watermarkPositions, wm.Position):
+		return &InvalidWatermarkError{Reason: "position must be one of " + strings.Join(watermarkPositions, ", ")}
+	case wm.Opacity < 0 || wm.Opacity > 1:
+		return &InvalidWatermarkError{Reason: "opacity must be between 0 and 1"}
+	case wm.Margin < 0 || wm.Margin > 0.25:
+		return &InvalidWatermarkError{Reason: "margin must be between 0 and 0.25"}
+	case wm.Scale < 0 || wm.Scale > 1:
+		return &InvalidWatermarkError{Reason: "scale must be between 0 and 1"}
+	}
+
+	logo, err := Get(wm.Logo)
+	if err != nil {
+		return &InvalidWatermarkError{Reason: "logo must be the media id of an image"}
+	}
+	if logo.Kind != "image" || !convertible(logo.MimeType) {
+		return &InvalidWatermarkError{Reason: "logo must be a PNG, JPEG, WebP, BMP or TIFF image (or HEIC when ffmpeg is installed)"}
+	}
+	return nil
+}
+
+// SaveWatermark creates or replaces a profile.
+func SaveWatermark(wm Watermark) (Watermark, error) {
+	if err := wm.validate(); err != nil {
+		return Watermark{}, err
+	}
+
+	watermarksMu.Lock()
+	defer watermarksMu.Unlock()
+
+	// the new logo is retained before the profile is saved, and the old one only released after, so GC never sees
+	// a logo a saved profile points at without a reference.
+	old, existed := watermarks[wm.Name]
+	newLogo := !existed || old.Logo != wm.Logo
+	if newLogo {
+		if err := Retain(wm.Logo); err != nil {
+			return Watermark{}, err
+		}
+	}
+	watermarks[wm.Name] = wm
+	if err := store.Save(watermarksPath(), watermarks); err != nil {
+		if existed {
+			watermarks[wm.Name] = old
+		} else {
+			delete(watermarks, wm.Name)
+		}
+		if newLogo {
+			releaseLogo(wm.Name, wm.Logo)
+		}
+		return Watermark{}, err
+	}
+	if existed && newLogo {
+		releaseLogo(wm.Name, old.Logo)
+	}
+	return wm, nil
+}
+
+// releaseLogo drops a profile's reference on its logo. the profile change is already made (or undone) by then, so a
+// failure only leaves the logo with a reference too many, which keeps it from GC.
+func releaseLogo(name string, logo string) {
+	if err := Release(logo); err != nil {
+		log.Warnf("releasing logo %s of watermark %s: %v", logo, name, err)
+	}
+}
+
+// GetWatermark returns the profile with the given name.
+func GetWatermark(name string) (Watermark, error) {
+	watermarksMu.Lock()
+	defer watermarksMu.Unlock()
+
+	wm, ok := watermarks[name]
+	if !ok {
+		return Watermark{}, ErrWatermarkNotFound
+	}
+	return wm, nil
+}
+
+// ListWatermarks returns every profile, by name.
+func ListWatermarks() []Watermark {
+	watermarksMu.Lock()
+	defer watermarksMu.Unlock()
+
+	list := make([]Watermark, 0, len(watermarks))
+	for _, wm := range watermarks {
+		list = append(list, wm)
+	}
+	sort.Slice(list, func(a, b int) bool {
+		return list[a].Name < list[b].Name
+	})
+	return list
+}
+
+// DeleteWatermark removes a profile. Files it was already applied to stay.
+func DeleteWatermark(name string) error {
+	watermarksMu.Lock()
+	defer watermarksMu.Unlock()
+
+	wm, ok := watermarks[name]
+	if !ok {
+		return ErrWatermarkNotFound
+	}
+	delete(watermarks, name)
+	if err := store.Save(watermarksPath(), watermarks); err != nil {
+		watermarks[name] = wm
+		return err
+	}
+	releaseLogo(name, wm.Logo)
+	return nil
+}
+
+// placement returns where a logo of size lw x lh goes on a w x h image.
+func (wm Watermark) placement(w int, h int, lw int, lh int) image.Point {
+	m := int(math.Round(wm.Margin * float64(w)))
+	x, y := m, m
+	switch wm.Position {
+	case "top-right":
+		x = w - lw - m
+	case "bottom-left":
+		y = h - lh - m
+	case "bottom-right":
+		x, y = w-lw-m, h-lh-m
+	case "center":
+		x, y = (w-lw)/2, (h-lh)/2
+	}
+	return image.Pt(x, y)
+}
+
+// logoWidth is how wide the logo is drawn on an image w pixels wide.
+func (wm Watermark) logoWidth(w int) int {
+	return max(1, int(math.Round(wm.Scale*float64(w))))
+}
+
+// renderImage draws the logo at logoPath over the image at input and writes it to output, in the input's format.
+func (wm Watermark) renderImage(ctx context.Context, input string, logoPath string, output string, mimeType string) error {
+	src, err := decodeUpright(ctx, input)
+	if err != nil {
+		return err
+	}
+	logo, err := decodeUpright(ctx, logoPath)
+	if err != nil {
+		return err
+	}
+
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+
+	lb := logo.Bounds()
+	lw := wm.logoWidth(b.Dx())
+	lh := max(1, int(math.Round(float64(lw)*float64(lb.Dy())/float64(lb.Dx()))))
+	at := wm.placement(b.Dx(), b.Dy(), lw, lh)
+	scaled := image.NewRGBA(image.Rect(0, 0, lw, lh))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), logo, lb, draw.Src, nil)
+	mask := image.NewUniform(color.Alpha{A: uint8(math.Round(wm.Opacity * 255))})
+	draw.DrawMask(dst, image.Rect(at.X, at.Y, at.X+lw, at.Y+lh), scaled, image.Point{}, mask, image.Point{}, draw.Over)
+
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if mimeType == "image/png" {
+		err = png.Encode(out, dst)
+	} else {
+		err = jpeg.Encode(out, dst, &jpeg.Options{Quality: 90})
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// videoArgs are the ffmpeg options that overlay the logo (input 0) on the video (input 1) of the given width.
+func (wm Watermark) videoArgs(width int) []string {
+	m := strconv.Itoa(int(math.Round(wm.Margin * float64(width))))
+	x, y := m, m
+	switch wm.Position {
+	case "top-right":
+		x = "main_w-overlay_w-" + m
+	case "bottom-left":
+		y = "main_h-overlay_h-" + m
+	case "bottom-right":
+		x, y = "main_w-overlay_w-"+m, "main_h-overlay_h-"+m
+	case "center":
+		x, y = "(main_w-overlay_w)/2", "(main_h-overlay_h)/2"
+	}
+	filter := fmt.Sprintf("[0:v]scale=%d:-1,format=rgba,colorchannelmixer=aa=%.3f[logo];[1:v][logo]overlay=%s:%s:format=auto,format=yuv420p[v]",
+		wm.logoWidth(width), wm.Opacity, x, y)
+	return []string{
+		"-filter_complex", filter,
+		"-map", "[v]", "-map", "1:a?",
+		"-c:v", "libx264", "-preset", "medium", "-crf", "20",
+		"-c:a", "copy",
+		"-movflags", "+faststart", "-f", "mp4",
+	}
+}
+
+// ApplyWatermark returns item with the named profile's logo on it, making that rendition if it does not exist yet.
+// GIFs, and videos when the profile does not cover video, are returned as they are.
+func ApplyWatermark(ctx context.Context, item Item, name string) (Item, error) {
+	wm, err := GetWatermark(name)
+	if err != nil {
+		return Item{}, err
+	}
+	switch {
+	case item.Kind == "image" && convertible(item.MimeType):
+	case item.Kind == "video" && wm.Video:
+	default:
+		return item, nil
+	}
+
+	logo, err := Get(wm.Logo)
+	if err != nil {
+		return Item{}, err
+	}
+	// the key changes with the profile and the logo's content, so editing a profile makes new renditions.
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%+v %s", wm, logo.Checksum)))
+	key := "watermark@" + hex.EncodeToString(sum[:4])
+
+	logoPath, cleanup, err := LocalFile(ctx, logo)
+	if err != nil {
+		return Item{}, err
+	}
+	defer cleanup()
+
+	base := strings.TrimSuffix(item.OriginalName, path.Ext(item.OriginalName)) + "-" + wm.Name
+	if item.Kind == "video" {
+		width := item.Width
+		if width == 0 {
+			width = 1080 // not probed, size the logo for a typical phone video
+		}
+		return derive(ctx, item, key, base+".mp4", func(ctx context.Context, input string, output string) error {
+			return runFFmpegWith(ctx, []string{"-i", logoPath}, input, append(wm.videoArgs(width), output))
+		})
+	}
+	ext, mimeType := ".jpg", "image/jpeg"
+	if item.MimeType == "image/png" {
+		ext, mimeType = ".png", "image/png"
+	}
+	return derive(ctx, item, key, base+ext, func(ctx context.Context, input string, output string) error {
+		return wm.renderImage(ctx, input, logoPath, output, mimeType)
+	})
+}
@@ -0,0 +1,236 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/TanishqM1/SocialContentDistributer/internal/store"
+)
+
+func TestWatermarkPlacement(t *testing.T) {
+	// a 150x50 logo on a 1000x500 image, with a margin of 2% of the width (20 pixels).
+	cases := []struct {
+		position string
+		margin   float64
+		want     image.Point
+	}{
+		{"top-left", 0.02, image.Pt(20, 20)},
+		{"top-right", 0.02, image.Pt(830, 20)},
+		{"bottom-left", 0.02, image.Pt(20, 430)},
+		{"bottom-right", 0.02, image.Pt(830, 430)},
+		{"center", 0.02, image.Pt(425, 225)},
+		{"bottom-right", 0, image.Pt(850, 450)},
+		{"top-left", 0.0125, image.Pt(13, 13)}, // 12.5 pixels rounds up
+	}
+	for _, c := range cases {
+		wm := Watermark{Position: c.position, Margin: c.margin}
+		if got := wm.placement(1000, 500, 150, 50); got != c.want {
+			t.Errorf("%s with margin %v: %v, want %v", c.position, c.margin, got, c.want)
+		}
+	}
+}
+
+func TestLogoWidth(t *testing.T) {
+	cases := []struct {
+		scale float64
+		width int
+		want  int
+	}{
+		{0.15, 1000, 150},
+		{0.15, 1080, 162},
+		{1, 640, 640},
+		{0.01, 10, 1}, // never narrower than a pixel
+	}
+	for _, c := range cases {
+		if got := (Watermark{Scale: c.scale}).logoWidth(c.width); got != c.want {
+			t.Errorf("scale %v of %d: %d, want %d", c.scale, c.width, got, c.want)
+		}
+	}
+}
+
+func solidPNG(t *testing.T, w int, h int, c color.Color) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writePNG(t *testing.T, path string, w int, h int, c color.Color) {
+	t.Helper()
+	if err := os.WriteFile(path, solidPNG(t, w, h, c), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRenderImage(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("FFmpegPath", filepath.Join(dir, "no-ffmpeg"))
+	input, logo := filepath.Join(dir, "photo.png"), filepath.Join(dir, "logo.png")
+	writePNG(t, input, 200, 100, color.White)
+	writePNG(t, logo, 20, 10, color.NRGBA{R: 255, A: 255})
+
+	// the logo is drawn 40x20 (20% of the width), 10 pixels (5%) from the bottom right corner: at (150,70)-(190,90).
+	cases := []struct {
+		mimeType string
+		opacity  float64
+		decode   func(*os.File) (image.Image, error)
+		red      color.NRGBA // what the middle of the logo looks like
+	}{
+		{"image/png", 1, func(f *os.File) (image.Image, error) { return png.Decode(f) }, color.NRGBA{255, 0, 0, 255}},
+		{"image/png", 0.5, func(f *os.File) (image.Image, error) { return png.Decode(f) }, color.NRGBA{255, 127, 127, 255}},
+		{"image/jpeg", 1, func(f *os.File) (image.Image, error) { return jpeg.Decode(f) }, color.NRGBA{255, 0, 0, 255}},
+	}
+	for _, c := range cases {
+		wm := Watermark{Position: "bottom-right", Opacity: c.opacity, Margin: 0.05, Scale: 0.2}
+		output := filepath.Join(dir, "out")
+		if err := wm.renderImage(context.Background(), input, logo, output, c.mimeType); err != nil {
+			t.Fatalf("%s: %v", c.mimeType, err)
+		}
+		f, err := os.Open(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := c.decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: output does not decode: %v", c.mimeType, err)
+		}
+
+		if b := img.Bounds(); b.Dx() != 200 || b.Dy() != 100 {
+			t.Errorf("%s: output is %v, want 200x100", c.mimeType, b)
+		}
+		pixels := []struct {
+			at   image.Point
+			want color.NRGBA
+		}{
+			{image.Pt(170, 80), c.red},
+			{image.Pt(140, 80), color.NRGBA{255, 255, 255, 255}}, // left of the logo
+			{image.Pt(170, 95), color.NRGBA{255, 255, 255, 255}}, // in the margin below it
+			{image.Pt(10, 10), color.NRGBA{255, 255, 255, 255}},
+		}
+		for _, p := range pixels {
+			if got := color.NRGBAModel.Convert(img.At(p.at.X, p.at.Y)).(color.NRGBA); !near(got, p.want) {
+				t.Errorf("%s at opacity %v: pixel %v is %v, want %v", c.mimeType, c.opacity, p.at, got, p.want)
+			}
+		}
+	}
+}
+
+// near allows for JPEG's rounding.
+func near(a color.NRGBA, b color.NRGBA) bool {
+	diff := func(x, y uint8) bool { return max(x, y)-min(x, y) <= 8 }
+	return diff(a.R, b.R) && diff(a.G, b.G) && diff(a.B, b.B) && diff(a.A, b.A)
+}
+
+// addLogo puts a small PNG in the library.
+func addLogo(t *testing.T, c color.Color) Item {
+	t.Helper()
+	path, err := StagingPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, err := Save(bytes.NewReader(solidPNG(t, 4, 4, c)), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, _, err := Add(saved, "logo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+func logoRefs(t *testing.T, id string) int {
+	t.Helper()
+	item, err := Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return item.Refs
+}
+
+// a profile that could not be saved leaves the profiles and the logos' references as they were.
+func TestSaveWatermarkRollsBack(t *testing.T) {
+	dir, _ := useLibrary(t)
+	t.Setenv("FFprobePath", filepath.Join(dir, "no-ffprobe"))
+	watermarksMu.Lock()
+	oldWatermarks := watermarks
+	watermarks = map[string]Watermark{}
+	watermarksMu.Unlock()
+	t.Cleanup(func() {
+		watermarksMu.Lock()
+		watermarks = oldWatermarks
+		watermarksMu.Unlock()
+	})
+
+	first, second := addLogo(t, color.White), addLogo(t, color.Black)
+	if _, err := SaveWatermark(Watermark{Name: "brand", Logo: first.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if got := logoRefs(t, first.ID); got != 1 {
+		t.Fatalf("refs on the logo: %d", got)
+	}
+
+	// watermarks.json can't be replaced while it is a directory, the media index still saves fine.
+	path := store.Path("watermarks.json")
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(path, "blocked"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := SaveWatermark(Watermark{Name: "brand", Logo: second.ID}); err == nil {
+		t.Fatal("saving the profile worked")
+	}
+	if wm, err := GetWatermark("brand"); err != nil || wm.Logo != first.ID {
+		t.Errorf("profile after the failed save: %+v, %v", wm, err)
+	}
+	if _, err := SaveWatermark(Watermark{Name: "other", Logo: second.ID}); err == nil {
+		t.Fatal("saving the profile worked")
+	}
+	if _, err := GetWatermark("other"); err != ErrWatermarkNotFound {
+		t.Errorf("unsaved profile is kept: %v", err)
+	}
+	if err := DeleteWatermark("brand"); err == nil {
+		t.Fatal("deleting the profile worked")
+	}
+	if _, err := GetWatermark("brand"); err != nil {
+		t.Errorf("profile is gone from memory: %v", err)
+	}
+	if a, b := logoRefs(t, first.ID), logoRefs(t, second.ID); a != 1 || b != 0 {
+		t.Errorf("refs after the failed saves: %d on the old logo, %d on the new one", a, b)
+	}
+
+	// once it can be saved, changing the logo moves the reference over, and deleting gives it back.
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SaveWatermark(Watermark{Name: "brand", Logo: second.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if a, b := logoRefs(t, first.ID), logoRefs(t, second.ID); a != 0 || b != 1 {
+		t.Errorf("refs after changing the logo: %d on the old one, %d on the new one", a, b)
+	}
+	if err := DeleteWatermark("brand"); err != nil {
+		t.Fatal(err)
+	}
+	if got := logoRefs(t, second.ID); got != 0 {
+		t.Errorf("refs after deleting the profile: %d", got)
+	}
+}
@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"errors"
+	"path"
+	"strings"
+)
+
+// ErrInvalidKey is returned for keys that could point outside the store (absolute paths, "..", backslashes, ...).
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// CheckKey makes sure key is a clean, relative, slash separated path that stays inside the store.
+// Every backend calls it before touching a key, so nothing a client sends can reach a file outside the storage root.
+func CheckKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.ContainsAny(key, "\\\x00") {
+		return ErrInvalidKey
+	}
+	if path.Clean(key) != key {
+		return ErrInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+	}
+	// windows drive letters ("C:...") are absolute there.
+	if len(key) >= 2 && key[1] == ':' {
+		return ErrInvalidKey
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocalStore keeps media as files under a directory on local disk.
+// its presigned URLs point back at this server (GET /media/file/{key}) and are signed with an HMAC so they cannot be forged.
+type LocalStore struct {
+	Root    string
+	BaseURL string // public address of this server, for presigned URLs
+	secret  []byte
+}
+
+// NewLocalStore returns a store rooted at root. If secret is empty a random one is used,
+// which means presigned URLs stop working when the server restarts.
+func NewLocalStore(root string, baseURL string, secret string) *LocalStore {
+	if baseURL == "" {
+		baseURL = "http://localhost:8000"
+	}
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	return &LocalStore{Root: root, BaseURL: strings.TrimSuffix(baseURL, "/"), secret: key}
+}
+
+// LocalPath returns the file backing key. It refuses keys that would resolve outside Root, including through symlinks.
+func (l *LocalStore) LocalPath(key string) (string, error) {
+	if err := CheckKey(key); err != nil {
+		return "", err
+	}
+	root, err := filepath.Abs(l.Root)
+	if err != nil {
+		return "", err
+	}
+	p := filepath.Join(root, filepath.FromSlash(key))
+	if !within(root, p) {
+		return "", ErrInvalidKey
+	}
+
+	// follow symlinks for whatever part of the path already exists.
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return p, nil
+		}
+		return "", err
+	}
+	existing := p
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		existing = parent
+	}
+	realExisting, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", err
+	}
+	if !within(realRoot, realExisting) {
+		return "", ErrInvalidKey
+	}
+	return p, nil
+}
+
+// within reports whether path is root or inside it.
+func within(root string, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+func (l *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	path, err := l.LocalPath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// write next to the destination and rename, so readers never see a half written file.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".put-*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ImportFile moves a local file into the store.
+func (l *LocalStore) ImportFile(ctx context.Context, key string, path string) error {
+	dst, err := l.LocalPath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(path, dst); err != nil {
+		// different filesystem, fall back to copying.
+		f, openErr := os.Open(path)
+		if openErr != nil {
+			return err
+		}
+		defer f.Close()
+		if err := l.Put(ctx, key, f, -1, ""); err != nil {
+			return err
+		}
+		f.Close()
+		return os.Remove(path)
+	}
+	return nil
+}
+
+func (l *LocalStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := l.LocalPath(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotExist
+	}
+	return f, err
+}
+
+func (l *LocalStore) Stat(ctx context.Context, key string) (Object, error) {
+	path, err := l.LocalPath(key)
+	if err != nil {
+		return Object{}, err
+	}
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Object{}, ErrNotExist
+	}
+	if err != nil {
+		return Object{}, err
+	}
+	return Object{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (l *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := l.LocalPath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *LocalStore) List(ctx context.Context, prefix string) ([]Object, error) {
+	objects := []Object{}
+	err := filepath.WalkDir(l.Root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(l.Root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return objects, nil
+	}
+	return objects, err
+}
+
+// PresignGet returns a signed link to GET /media/file/{key} on this server.
+func (l *LocalStore) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	if err := CheckKey(key); err != nil {
+		return "", err
+	}
+	expiry := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expiry)
+	query.Set("signature", l.sign(key, expiry))
+	return l.BaseURL + "/media/file/" + (&url.URL{Path: key}).EscapedPath() + "?" + query.Encode(), nil
+}
+
+// VerifyURL checks the expires and signature query parameters of a link made by PresignGet.
+func (l *LocalStore) VerifyURL(key string, expires string, signature string) bool {
+	expiry, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiry {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(l.sign(key, expires)))
+}
+
+func (l *LocalStore) sign(key string, expires string) string {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
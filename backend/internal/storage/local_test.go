@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var traversalKeys = []string{
+	"",
+	"..",
+	"../secret.txt",
+	"../../etc/passwd",
+	"ab/../../secret.txt",
+	"ab/../cd/file.jpg",
+	"./file.jpg",
+	"ab//file.jpg",
+	"ab/",
+	"/etc/passwd",
+	"..\\secret.txt",
+	"ab\\..\\..\\secret.txt",
+	"C:/Windows/win.ini",
+	"file.jpg\x00.png",
+}
+
+func TestCheckKeyRejectsTraversal(t *testing.T) {
+	for _, key := range traversalKeys {
+		if err := CheckKey(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("CheckKey(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func TestCheckKeyAcceptsContentKeys(t *testing.T) {
+	for _, key := range []string{"ab/abcdef.jpg", "file.mp4", "a/b/c.png", "ab/..hidden"} {
+		if err := CheckKey(key); err != nil {
+			t.Errorf("CheckKey(%q) = %v, want nil", key, err)
+		}
+	}
+}
+
+func TestLocalStoreStaysInsideRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "media")
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(dir, "secret.txt")
+	if err := os.WriteFile(secret, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewLocalStore(root, "", "test")
+	ctx := context.Background()
+	for _, key := range traversalKeys {
+		if _, err := s.LocalPath(key); err == nil {
+			t.Errorf("LocalPath(%q) succeeded", key)
+		}
+		if f, err := s.Open(ctx, key); err == nil {
+			f.Close()
+			t.Errorf("Open(%q) succeeded", key)
+		}
+		if err := s.Put(ctx, key, strings.NewReader("x"), 1, ""); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+		if err := s.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) succeeded", key)
+		}
+		if _, err := s.PresignGet(ctx, key, 0); err == nil {
+			t.Errorf("PresignGet(%q) succeeded", key)
+		}
+	}
+
+	if data, err := os.ReadFile(secret); err != nil || string(data) != "secret" {
+		t.Fatalf("file outside the root was touched: %q, %v", data, err)
+	}
+}
+
+func TestLocalStoreRejectsSymlinkEscape(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "media")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{root, outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "ab")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	s := NewLocalStore(root, "", "test")
+	ctx := context.Background()
+	if f, err := s.Open(ctx, "ab/secret.txt"); err == nil {
+		f.Close()
+		t.Error("Open followed a symlink out of the root")
+	}
+	if err := s.Put(ctx, "ab/new.txt", strings.NewReader("x"), 1, ""); err == nil {
+		t.Error("Put followed a symlink out of the root")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new.txt")); err == nil {
+		t.Error("file was written outside the root")
+	}
+}
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	s := NewLocalStore(t.TempDir(), "", "test")
+	ctx := context.Background()
+	if err := s.Put(ctx, "ab/abcdef.txt", strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	obj, err := s.Stat(ctx, "ab/abcdef.txt")
+	if err != nil || obj.Size != 5 {
+		t.Fatalf("Stat = %+v, %v", obj, err)
+	}
+	if _, err := s.Stat(ctx, "ab/missing.txt"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("Stat(missing) = %v, want ErrNotExist", err)
+	}
+}
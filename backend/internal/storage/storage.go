@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// a MediaStore is where media files live. the server only talks to this interface, so uploads, uploaders and the
+// media library work the same whether files sit on local disk or in an S3-compatible bucket (AWS, MinIO, R2, ...).
+//
+// keys are slash separated paths like "ab/abcdef....jpg".
+
+// ErrNotExist is returned when a key is not in the store.
+var ErrNotExist = errors.New("object does not exist")
+
+// Object describes a stored file.
+type Object struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// MediaStore is implemented by every storage backend.
+type MediaStore interface {
+	// Put stores size bytes read from r under key, replacing anything already there.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open returns the contents of key. The caller closes it.
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (Object, error)
+	Delete(ctx context.Context, key string) error
+	// List returns every object whose key starts with prefix.
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// PresignGet returns a URL anyone can download key from until it expires.
+	PresignGet(ctx context.Context, key string, expires time.Duration) (string, error)
+}
+
+// FileImporter is implemented by stores that can take ownership of a local file faster than copying it (e.g. a rename).
+type FileImporter interface {
+	ImportFile(ctx context.Context, key string, path string) error
+}
+
+// LocalPather is implemented by stores that keep objects as local files, so tools like ffmpeg can read them in place.
+type LocalPather interface {
+	LocalPath(key string) (string, error)
+}
+
+// PutFile stores the local file at path under key. The file is moved if the store supports it, copied otherwise.
+func PutFile(ctx context.Context, s MediaStore, key string, path string, contentType string) error {
+	if importer, ok := s.(FileImporter); ok {
+		return importer.ImportFile(ctx, key, path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := s.Put(ctx, key, f, info.Size(), contentType); err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(path)
+}
+
+// FromEnv builds the store selected by MediaStore in the environment ("local", the default, or "s3").
+//
+//	local: MediaDir (default uploads/media), PublicURL and MediaURLSecret for signed download links
+//	s3:    S3Endpoint, S3Region, S3Bucket, S3AccessKey, S3SecretKey, S3PathStyle
+func FromEnv() (MediaStore, error) {
+	switch kind := strings.ToLower(os.Getenv("MediaStore")); kind {
+	case "", "local":
+		dir := os.Getenv("MediaDir")
+		if dir == "" {
+			dir = "uploads/media"
+		}
+		return NewLocalStore(dir, os.Getenv("PublicURL"), os.Getenv("MediaURLSecret")), nil
+	case "s3":
+		return NewS3Store(S3Config{
+			Endpoint:  os.Getenv("S3Endpoint"),
+			Region:    os.Getenv("S3Region"),
+			Bucket:    os.Getenv("S3Bucket"),
+			AccessKey: os.Getenv("S3AccessKey"),
+			SecretKey: os.Getenv("S3SecretKey"),
+			PathStyle: os.Getenv("S3PathStyle") != "false",
+		})
+	default:
+		return nil, fmt.Errorf("unknown MediaStore %q (expected local or s3)", kind)
+	}
+}
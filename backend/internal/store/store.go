@@ -0,0 +1,53 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// small helpers for the json files the server keeps its state in.
+// everything lives under the data directory ("uploads" unless DataDir is set), next to uploaded media.
+
+// DataDir returns the directory server state is written to.
+func DataDir() string {
+	if dir := os.Getenv("DataDir"); dir != "" {
+		return dir
+	}
+	return "uploads"
+}
+
+// Path joins name onto the data directory.
+func Path(name string) string {
+	return filepath.Join(DataDir(), name)
+}
+
+// Load decodes the json file at path into v. A missing file is not an error (v is left untouched).
+func Load(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Save writes v to path as json. It writes to a temp file first and renames it, so a crash never leaves a half written file.
+func Save(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
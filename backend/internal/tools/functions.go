@@ -1,9 +1,17 @@
 package tools
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"path"
+	"strings"
 	"sync"
 
+	"github.com/TanishqM1/SocialContentDistributer/internal/jobs"
+	"github.com/TanishqM1/SocialContentDistributer/internal/media"
+
 	instagram "github.com/TanishqM1/SocialContentDistributer/uploads/instagram"
 	linkedin "github.com/TanishqM1/SocialContentDistributer/uploads/linkedin"
 	pinterest "github.com/TanishqM1/SocialContentDistributer/uploads/pintrest"
@@ -16,12 +24,19 @@ func (y YouTubeUploader) BuildAPI() map[string]interface{} {
 	return map[string]interface{}{
 		"access_token":   y.AccessToken,
 		"platform_name":  y.PlatformName,
+		"target":         y.Target,
+		"account":        y.Account,
 		"title":          y.Title,
 		"description":    y.Description,
 		"tags":           y.Tags,
 		"category_id":    y.CategoryID,
 		"privacy_status": y.PrivacyStatus,
 		"media_file":     y.MediaFile,
+		"keep_metadata":  y.KeepMetadata,
+		"thumbnail":      y.Thumbnail,
+		"watermark":      y.Watermark,
+		"cover_image":    y.CoverImage,
+		"waveform":       y.Waveform,
 	}
 }
 
@@ -30,9 +45,15 @@ func (i InstagramUploader) BuildAPI() map[string]interface{} {
 	return map[string]interface{}{
 		"access_token":  i.AccessToken,
 		"platform_name": i.PlatformName,
+		"target":        i.Target,
+		"account":       i.Account,
 		"image_url":     i.ImageURL,
 		"caption":       i.Caption,
 		"user_tags":     i.UserTags,
+		"keep_metadata": i.KeepMetadata,
+		"watermark":     i.Watermark,
+		"cover_image":   i.CoverImage,
+		"waveform":      i.Waveform,
 	}
 }
 
@@ -41,9 +62,16 @@ func (p PinterestUploader) BuildAPI() map[string]interface{} {
 	return map[string]interface{}{
 		"access_token":  p.AccessToken,
 		"platform_name": p.PlatformName,
+		"target":        p.Target,
+		"account":       p.Account,
 		"title":         p.Title,
 		"description":   p.Description,
 		"link":          p.Link,
+		"keep_metadata": p.KeepMetadata,
+		"thumbnail":     p.Thumbnail,
+		"watermark":     p.Watermark,
+		"cover_image":   p.CoverImage,
+		"waveform":      p.Waveform,
 		"media_source": map[string]interface{}{
 			"source_type": p.SourceType, // e.g. "image_url"
 			"url":         p.ImageURL,
@@ -56,6 +84,8 @@ func (r RedditUploader) BuildAPI() map[string]interface{} {
 	body := map[string]interface{}{
 		"access_token":  r.AccessToken,
 		"platform_name": r.PlatformName,
+		"target":        r.Target,
+		"account":       r.Account,
 		"sr":            r.Subreddit,
 		"kind":          r.PostType, // "self", "link", or "image"
 		"title":         r.Title,
@@ -78,6 +108,8 @@ func (l LinkedInUploader) BuildAPI() map[string]interface{} {
 	return map[string]interface{}{
 		"access_token":   l.AccessToken,
 		"platform_name":  l.PlatformName,
+		"target":         l.Target,
+		"account":        l.Account,
 		"author":         l.Author,
 		"lifecycleState": l.LifecycleState, // usually "PUBLISHED"
 		"specificContent": map[string]interface{}{
@@ -103,33 +135,61 @@ func (l LinkedInUploader) BuildAPI() map[string]interface{} {
 // basic implementation
 
 // to make SendAPI concurrent, we can simply run all the functions in parallel, as we don't care which ones run when, and we aren't appending anything.
-func SendAPI(u UploadContent, wg *sync.WaitGroup) {
+// the outcome of each platform is recorded against postID in the jobs package.
+func SendAPI(u UploadContent, postID string, wg *sync.WaitGroup) {
+	defer wg.Done()
+
 	// implement SendAPI
 	body := u.BuildAPI()
 	// jsonData, _ := json.Marshal(body) --> this is a byte array!
 	platform := body["platform_name"]
+	// results are kept per target, so two accounts on the same platform do not overwrite each other.
+	target := getStringValue(body, "target")
+	if target == "" {
+		target, _ = platform.(string)
+	}
 
 	switch platform {
 	case "youtube":
+		// youtube posts to the channel of the oauth token, an account in the target only tells results apart.
 		title := getStringValue(body, "title")
 		description := getStringValue(body, "description")
 		category := getStringValue(body, "category_id")
 		privacy := getStringValue(body, "privacy_status")
-		filename := getStringValue(body, "media_file")
-		tagslist := getStringArrayValue(body, "tags")
-		var tags string
-		for _, v := range tagslist {
-			tags += v
-		}
+		mediaID := getStringValue(body, "media_file")
+		// youtube takes the keywords comma separated.
+		tags := strings.Join(getStringArrayValue(body, "tags"), ",")
 
-		// Only proceed if we have a valid filename
-		if filename != "" && filename != "blank" {
-			// Use the file path from uploads folder
-			filePath := fmt.Sprintf("uploads/media/%s", filename)
-			youtube.UploadYoutube(title, description, category, privacy, filePath, tags)
+		// Only proceed if we have a media id
+		if mediaID != "" && mediaID != "blank" {
+			// Read the video from the media store, transcoded for youtube
+			video, item, err := media.OpenFor(context.Background(), mediaID, "youtube", publishOptions(body))
+			if err != nil {
+				jobs.Fail(postID, target, err)
+				break
+			}
+			defer video.Close()
+			jobs.MetadataRemoved(postID, target, item.Stripped, item.MetadataWarning)
+
+			// the custom thumbnail goes through the youtube image variant (1280x720 jpeg).
+			var thumbnail io.Reader
+			if ref := getStringValue(body, "thumbnail"); ref != "" {
+				file, _, err := media.OpenFor(context.Background(), ref, "youtube", media.PublishOptions{KeepMetadata: getBoolValue(body, "keep_metadata")})
+				if err != nil {
+					jobs.Fail(postID, target, fmt.Errorf("thumbnail: %w", err))
+					break
+				}
+				defer file.Close()
+				thumbnail = file
+			}
+			if err := youtube.UploadYoutube(title, description, category, privacy, video, tags, thumbnail); err != nil {
+				jobs.Fail(postID, target, err)
+				break
+			}
+			jobs.Complete(postID, target)
 		} else {
-			fmt.Println("Skipping YouTube upload - no valid filename provided")
-			fmt.Printf("Filename received: '%s'\n", filename)
+			fmt.Println("Skipping YouTube upload - no media id provided")
+			jobs.Fail(postID, target, errors.New("no media id provided"))
 		}
 
 	case "instagram":
@@ -139,7 +199,20 @@ func SendAPI(u UploadContent, wg *sync.WaitGroup) {
 		caption := getStringValue(body, "caption")
 		userTags := getStringValue(body, "user_tags")
 
-		instagram.UploadInstagram(imageURL, caption, userTags)
+		file, item, err := media.OpenFor(context.Background(), imageURL, "instagram", publishOptions(body))
+		if err != nil {
+			jobs.Fail(postID, target, err)
+			break
+		}
+		defer file.Close()
+		jobs.MetadataRemoved(postID, target, item.Stripped, item.MetadataWarning)
+
+		requestID, err := instagram.UploadInstagram(file, item.Size, path.Base(item.Filename), caption, userTags, getStringValue(body, "account"))
+		if err != nil {
+			jobs.Fail(postID, target, err)
+			break
+		}
+		jobs.Processing(postID, target, requestID)
 
 	case "pinterest":
 
@@ -149,10 +222,32 @@ func SendAPI(u UploadContent, wg *sync.WaitGroup) {
 		description := body["description"].(string)
 		sourceType := body["media_source"].(map[string]interface{})["source_type"].(string)
 		imageURL := body["media_source"].(map[string]interface{})["url"].(string)
-		imagePath := imageURL
+
+		image, item, err := media.OpenFor(context.Background(), imageURL, "pinterest", publishOptions(body))
+		if err != nil {
+			jobs.Fail(postID, target, err)
+			break
+		}
+		defer image.Close()
+		jobs.MetadataRemoved(postID, target, item.Stripped, item.MetadataWarning)
+
+		video := item.Kind == "video"
+		var cover *pinterest.Cover
+		if ref := getStringValue(body, "thumbnail"); ref != "" && video {
+			cover, err = pinterestCover(ref, imageURL, getBoolValue(body, "keep_metadata"))
+			if err != nil {
+				jobs.Fail(postID, target, fmt.Errorf("thumbnail: %w", err))
+				break
+			}
+		}
 
 		// pinterest.UploadPinterest(title, description, imagePath, sourceType, imageURL, boardID)
-		pinterest.UploadPinterest(title, description, imagePath, sourceType, imageURL)
+		requestID, err := pinterest.UploadPinterest(title, description, image, item.Size, path.Base(item.Filename), sourceType, video, cover, getStringValue(body, "account"))
+		if err != nil {
+			jobs.Fail(postID, target, err)
+			break
+		}
+		jobs.Processing(postID, target, requestID)
 
 	case "reddit":
 		subreddit := body["sr"].(string)
@@ -168,13 +263,54 @@ func SendAPI(u UploadContent, wg *sync.WaitGroup) {
 			url = body["url"].(string)
 		}
 
-		reddit.UploadReddit(subreddit, postType, title, text, url, resubmit, nsfw)
+		if err := reddit.UploadReddit(subreddit, postType, title, text, url, resubmit, nsfw); err != nil {
+			jobs.Fail(postID, target, err)
+			break
+		}
+		jobs.Complete(postID, target)
 
 	case "linkedin":
-		linkedin.UploadLinkedIn()
+		if err := linkedin.UploadLinkedIn(); err != nil {
+			jobs.Fail(postID, target, err)
+			break
+		}
+		jobs.Complete(postID, target)
 
 	}
-	wg.Done()
+}
+
+// pinterestCover reads the cover of a video pin. if the thumbnail is a frame of the pinned video,
+// pinterest is also told where in the video it was taken.
+func pinterestCover(ref string, videoRef string, keepMetadata bool) (*pinterest.Cover, error) {
+	file, _, err := media.OpenFor(context.Background(), ref, "pinterest", media.PublishOptions{KeepMetadata: keepMetadata})
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, media.LimitFor("image")))
+	if err != nil {
+		return nil, err
+	}
+
+	cover := &pinterest.Cover{Image: data, KeyFrameTime: -1}
+	frame, err := media.Resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := media.FrameTime(frame); ok && frame.Source == videoRef {
+		cover.KeyFrameTime = t
+	}
+	return cover, nil
+}
+
+// publishOptions reads how the media of an upload is prepared (see media.OpenFor).
+func publishOptions(body map[string]interface{}) media.PublishOptions {
+	return media.PublishOptions{
+		KeepMetadata: getBoolValue(body, "keep_metadata"),
+		Watermark:    getStringValue(body, "watermark"),
+		Cover:        getStringValue(body, "cover_image"),
+		Waveform:     getBoolValue(body, "waveform"),
+	}
 }
 
 // Helper functions to safely extract values from map
@@ -187,6 +323,15 @@ func getStringValue(body map[string]interface{}, key string) string {
 	return ""
 }
 
+func getBoolValue(body map[string]interface{}, key string) bool {
+	if val, ok := body[key]; ok && val != nil {
+		if b, ok := val.(bool); ok {
+			return b
+		}
+	}
+	return false
+}
+
 func getStringArrayValue(body map[string]interface{}, key string) []string {
 	if val, ok := body[key]; ok && val != nil {
 		if arr, ok := val.([]string); ok {
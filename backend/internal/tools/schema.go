@@ -8,40 +8,62 @@ package tools
 type YouTubeUploader struct {
 	AccessToken   string
 	PlatformName  string
+	Target        string // entry of platforms this is for, e.g. "instagram:brand2"
+	Account       string // "" for the default account
 	Title         string
 	Description   string
 	Tags          []string
 	CategoryID    string
 	PrivacyStatus string // "public", "private", or "unlisted"
-	MediaFile     string // binary video data
+	MediaFile     string // media id of the video
+	KeepMetadata  bool   // publish the file with its metadata (location, camera...)
+	Thumbnail     string // media id of the custom thumbnail, optional
+	Watermark     string // watermark profile, optional
+	CoverImage    string // media id of the artwork, if MediaFile is audio
+	Waveform      bool
 }
 
 // ===== Instagram =====
 type InstagramUploader struct {
 	AccessToken  string
 	PlatformName string
-	ImageURL     string
+	Target       string // entry of platforms this is for, e.g. "instagram:brand2"
+	Account      string // "" for the default account
+	ImageURL     string // media id of the image or video
 	Caption      string
 	LocationID   string
 	UserTags     string
+	KeepMetadata bool
+	Watermark    string
+	CoverImage   string
+	Waveform     bool
 }
 
 // ===== Pinterest =====
 type PinterestUploader struct {
 	AccessToken  string
 	PlatformName string
+	Target       string // entry of platforms this is for, e.g. "instagram:brand2"
+	Account      string // "" for the default account
 	BoardID      string
 	Title        string
 	Description  string
 	Link         string // unneeded if locally upoading
 	SourceType   string // e.g., "image/jpeg"
-	ImageURL     string // unneeded if locally uploading
+	ImageURL     string // media id of the image or video
+	KeepMetadata bool
+	Thumbnail    string // media id of the cover of a video pin, optional
+	Watermark    string
+	CoverImage   string
+	Waveform     bool
 }
 
 // ===== Reddit =====
 type RedditUploader struct {
 	AccessToken  string
 	PlatformName string
+	Target       string // entry of platforms this is for, e.g. "instagram:brand2"
+	Account      string // "" for the default account
 	Subreddit    string
 	PostType     string // "self", "link", or "image"
 	Title        string
@@ -55,6 +77,8 @@ type RedditUploader struct {
 type LinkedInUploader struct {
 	AccessToken    string
 	PlatformName   string
+	Target         string // entry of platforms this is for, e.g. "instagram:brand2"
+	Account        string // "" for the default account
 	Author         string // URN of person/org
 	LifecycleState string // "PUBLISHED"
 	Text           string
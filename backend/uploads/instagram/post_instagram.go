@@ -1,81 +1,54 @@
 package instagram
 
 import (
-	"bytes"
 	"fmt"
 	"io"
-	"log"
-	"mime/multipart"
 	"net/http"
-	"os"
 
-	"github.com/joho/godotenv"
+	"github.com/TanishqM1/SocialContentDistributer/uploads/uploadpost"
 )
 
 // WORKS INDEPENDENTLY, NEED TO HOOKUP W/ FRONTEND AND BACKEND
 
-func UploadInstagram(mediaPath string, title string, userTags string) {
+// UploadInstagram submits the post asynchronously and returns the upload-post request_id to poll.
+// media is read from the media store by the caller, filename is only used to name the part (upload-post looks at the extension).
+// user is the upload-post profile to post as, "" for the default one.
+func UploadInstagram(media io.Reader, size int64, filename string, title string, userTags string, user string) (string, error) {
 
-	fmt.Printf("\n Retrieved the following fields: \n MediaPath: %v \n Title: %v  \n userTags: %v", mediaPath, title, userTags)
+	fmt.Printf("\n Retrieved the following fields: \n Filename: %v \n Title: %v  \n userTags: %v", filename, title, userTags)
 
-	apiURL := "https://api.upload-post.com/api/upload"
-	err := godotenv.Load("config/.env")
+	apiURL := uploadpost.BaseURL + "/upload"
+	apiKey, err := uploadpost.APIKey()
 	if err != nil {
-		log.Fatal("Cannot Load .ENV (UploadPinterest())")
+		return "", err
 	}
-	apiKey := os.Getenv("UploadsAPI")
-	fmt.Println(apiKey)
-	user := "SocialContentDistributer"
 
-	// === Create multipart form ===
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-
-	// Attach the media file (image or video)
-	file, err := os.Open(mediaPath)
-	if err != nil {
-		panic(err)
-	}
-	defer file.Close()
-
-	part, err := writer.CreateFormFile("video", mediaPath)
-	if err != nil {
-		panic(err)
-	}
-	_, err = io.Copy(part, file)
-	if err != nil {
-		panic(err)
-	}
+	// === Attach the media file (image or video), streamed from the media store ===
+	filePart := uploadpost.FilePart{Field: "video", Filename: filename, Reader: media, Size: size}
 
 	// Add form fields
-	writer.WriteField("title", title)
-	writer.WriteField("user", user)
-	writer.WriteField("platform[]", "instagram") // ✅ target platform
-
-	writer.Close()
+	fields := []uploadpost.Field{
+		{Name: "title", Value: title},
+		{Name: "user", Value: uploadpost.Profile(user)},
+		{Name: "platform[]", Value: "instagram"}, // ✅ target platform
+		{Name: "async_upload", Value: "true"},
+	}
 
 	// === Build HTTP request ===
-	req, err := http.NewRequest("POST", apiURL, body)
+	req, err := uploadpost.NewMultipartRequest(apiURL, fields, filePart)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
 	req.Header.Set("Authorization", "Apikey "+apiKey)
-	req.Header.Set("Content-Type", writer.FormDataContentType())
 
 	// === Send request ===
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		panic(err)
-	}
-
-	fmt.Println("Status:", resp.Status)
-	fmt.Println("Response:", string(respBody))
+	return uploadpost.ParseSubmitResponse(resp)
 }
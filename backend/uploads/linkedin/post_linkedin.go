@@ -1,8 +1,11 @@
 package linkedin
 
-import "fmt"
+import "errors"
 
-func UploadLinkedIn() {
-	fmt.Print("LinkedIn!")
-	return
+// ErrNotSupported is returned until posting to linkedin is built.
+var ErrNotSupported = errors.New("linkedin uploads are not supported yet")
+
+// UploadLinkedIn does not post anything yet, so the target is reported as failed rather than sent.
+func UploadLinkedIn() error {
+	return ErrNotSupported
 }
@@ -1,86 +1,86 @@
 package instagram
 
 import (
-	"bytes"
+	"encoding/base64"
 	"fmt"
 	"io"
-	"log"
-	"mime/multipart"
 	"net/http"
-	"os"
+	"strconv"
 
-	"github.com/joho/godotenv"
+	"github.com/TanishqM1/SocialContentDistributer/uploads/uploadpost"
 )
 
 // WORKS INDEPENDENTLY, NEED TO HOOKUP W/ FRONTEND AND BACKEND
-// need imagepath, title, boardID. compatible with jpg as of now.
+// need imagepath, title, boardID. images are converted to jpg by the media pipeline (internal/media/images.go) before they get here.
 
-func UploadPinterest(title string, caption string, imagePath string, sourceType string, imageURL string) {
-
-	fmt.Printf("\n Retrieved the following fields: \n Title: %v \n Caption: %v \n imagePath: %v \n SourceType: %v \n ImageURL: %v ", title, caption, imagePath, sourceType, imageURL)
+// Cover is the cover image of a video pin.
+type Cover struct {
+	Image        []byte  // jpeg
+	KeyFrameTime float64 // seconds into the video the image was taken from, -1 if it is not a frame of the video
+}
 
-	apiURL := "https://api.upload-post.com/api/upload_photos"
-	err := godotenv.Load("config/.env")
-	if err != nil {
-		log.Fatal("Cannot Load .ENV (UploadPinterest())")
-	}
-	apiKey := os.Getenv("UploadsAPI")
-	fmt.Println(apiKey)
-	user := "SocialContentDistributer"
-	boardID := "1126462994236750396"
+// UploadPinterest submits the pin asynchronously and returns the upload-post request_id to poll.
+// image is read from the media store by the caller, filename is only used to name the part.
+// video pins go to the video endpoint and may have a cover (nil lets pinterest pick one).
+// user is the upload-post profile to post as, "" for the default one.
+func UploadPinterest(title string, caption string, image io.Reader, size int64, filename string, sourceType string, video bool, cover *Cover, user string) (string, error) {
 
-	// === Create multipart body ===
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+	fmt.Printf("\n Retrieved the following fields: \n Title: %v \n Caption: %v \n Filename: %v \n SourceType: %v ", title, caption, filename, sourceType)
 
-	// Attach image file
-	file, err := os.Open(imagePath)
-	if err != nil {
-		panic(err)
+	apiURL := uploadpost.BaseURL + "/upload_photos"
+	if video {
+		apiURL = uploadpost.BaseURL + "/upload"
 	}
-	defer file.Close()
-
-	part, err := writer.CreateFormFile("photos[]", imagePath)
+	apiKey, err := uploadpost.APIKey()
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-	_, err = io.Copy(part, file)
-	if err != nil {
-		panic(err)
+	boardID := "1126462994236750396"
+
+	// === Attach image file (streamed from the media store, never held in memory) ===
+	filePart := uploadpost.FilePart{Field: "photos[]", Filename: filename, Reader: image, Size: size}
+	if video {
+		filePart.Field = "video"
 	}
 
-	// === Required Pinterest fields ===
-	writer.WriteField("user", user)
-	writer.WriteField("title", caption)
-	writer.WriteField("platform[]", "pinterest")
-	writer.WriteField("async_upload", "false")
+	fields := []uploadpost.Field{
+		// === Required Pinterest fields ===
+		{Name: "user", Value: uploadpost.Profile(user)},
+		{Name: "title", Value: caption},
+		{Name: "platform[]", Value: "pinterest"},
+		{Name: "async_upload", Value: "true"},
 
-	// Pinterest-specific metadata
-	writer.WriteField("pinterest_board_id", boardID)
-	writer.WriteField("pinterest_title", title)
-	writer.WriteField("pinterest_cover_image_content_type", "image/jpeg")
-	// writer.WriteField("pinterest_cover_image_data", imagePath)
-	writer.WriteField("pinterest_cover_image_key_frame_time", "0e5171886886126120206342978")
+		// Pinterest-specific metadata
+		{Name: "pinterest_board_id", Value: boardID},
+		{Name: "pinterest_title", Value: title},
+	}
 
-	writer.Close()
+	// the cover is sent inline, it is a small jpeg made by the media pipeline.
+	if video && cover != nil {
+		fields = append(fields,
+			uploadpost.Field{Name: "pinterest_cover_image_content_type", Value: "image/jpeg"},
+			uploadpost.Field{Name: "pinterest_cover_image_data", Value: base64.StdEncoding.EncodeToString(cover.Image)},
+		)
+		if cover.KeyFrameTime >= 0 {
+			// milliseconds
+			fields = append(fields, uploadpost.Field{Name: "pinterest_cover_image_key_frame_time", Value: strconv.Itoa(int(cover.KeyFrameTime * 1000))})
+		}
+	}
 
 	// === Build and send request ===
-	req, err := http.NewRequest("POST", apiURL, body)
+	req, err := uploadpost.NewMultipartRequest(apiURL, fields, filePart)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
 	req.Header.Set("Authorization", "Apikey "+apiKey)
-	req.Header.Set("Content-Type", writer.FormDataContentType())
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 	defer resp.Body.Close()
 
-	respBody, _ := io.ReadAll(resp.Body)
-	fmt.Println("Status:", resp.Status)
-	fmt.Println("Response:", string(respBody))
+	return uploadpost.ParseSubmitResponse(resp)
 }
@@ -3,8 +3,8 @@ package reddit
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"net/url"
 	"os"
@@ -13,7 +13,8 @@ import (
 	"github.com/joho/godotenv"
 )
 
-func UploadReddit(subreddit, postType, title, text, link string, resubmit, nsfw bool) {
+// UploadReddit submits a post to subreddit. it returns an error if reddit did not take the post.
+func UploadReddit(subreddit, postType, title, text, link string, resubmit, nsfw bool) error {
 	fmt.Println("📢 UploadReddit() called with:")
 	fmt.Printf("  Subreddit: %s\n", subreddit)
 	fmt.Printf("  Post Type: %s\n", postType)
@@ -26,7 +27,7 @@ func UploadReddit(subreddit, postType, title, text, link string, resubmit, nsfw
 
 	err := godotenv.Load("config/.env")
 	if err != nil {
-		log.Fatal("Cannot Load .ENV (UploadPinterest())")
+		return errors.New("cannot load config/.env")
 	}
 	clientID := os.Getenv("clientID")
 	clientSecret := os.Getenv("clientSecret")
@@ -42,7 +43,7 @@ func UploadReddit(subreddit, postType, title, text, link string, resubmit, nsfw
 
 	req, err := http.NewRequest("POST", "https://www.reddit.com/api/v1/access_token", bytes.NewBufferString(data.Encode()))
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	req.SetBasicAuth(clientID, clientSecret)
 	req.Header.Set("User-Agent", "windows:SocialContentDistributer:v1.0 (by /u/"+username+")")
@@ -50,18 +51,18 @@ func UploadReddit(subreddit, postType, title, text, link string, resubmit, nsfw
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer resp.Body.Close()
 
 	var tokenResp map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	token, ok := tokenResp["access_token"].(string)
 	if !ok {
-		log.Fatalf("❌ Could not get access_token: %+v\n", tokenResp)
+		return fmt.Errorf("could not get access_token: %+v", tokenResp)
 	}
 
 	fmt.Println("✅ Access token received!")
@@ -73,7 +74,7 @@ func UploadReddit(subreddit, postType, title, text, link string, resubmit, nsfw
 
 	resp2, err := http.DefaultClient.Do(req2)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer resp2.Body.Close()
 
@@ -82,10 +83,10 @@ func UploadReddit(subreddit, postType, title, text, link string, resubmit, nsfw
 	fmt.Println("👤 Authenticated as:", me["name"])
 
 	// Step 3: Create the post
-	post(token, subreddit, postType, title, text, link, resubmit, nsfw)
+	return post(token, subreddit, postType, title, text, link, resubmit, nsfw)
 }
 
-func post(accessToken, subreddit, postType, title, text, link string, resubmit, nsfw bool) {
+func post(accessToken, subreddit, postType, title, text, link string, resubmit, nsfw bool) error {
 	data := url.Values{}
 	data.Set("sr", subreddit)
 	data.Set("kind", postType)
@@ -102,7 +103,7 @@ func post(accessToken, subreddit, postType, title, text, link string, resubmit,
 
 	req, err := http.NewRequest("POST", "https://oauth.reddit.com/api/submit", strings.NewReader(data.Encode()))
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	req.Header.Set("Authorization", "bearer "+accessToken)
@@ -111,12 +112,26 @@ func post(accessToken, subreddit, postType, title, text, link string, resubmit,
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	defer resp.Body.Close()
 
 	fmt.Println("🔹 Status:", resp.Status)
-	var res map[string]interface{}
-	json.NewDecoder(resp.Body).Decode(&res)
+	var res struct {
+		JSON struct {
+			Errors [][]interface{} `json:"errors"`
+		} `json:"json"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return err
+	}
 	fmt.Printf("🧩 Reddit Response: %+v\n", res)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("reddit returned %s", resp.Status)
+	}
+	// reddit answers 200 for a rejected submission too, the reasons are in json.errors.
+	if len(res.JSON.Errors) > 0 {
+		return fmt.Errorf("reddit rejected the post: %v", res.JSON.Errors)
+	}
+	return nil
 }
@@ -0,0 +1,110 @@
+package uploadpost
+
+import (
+	"io"
+	"mime/multipart"
+	"net/http"
+	"sync"
+)
+
+// outbound uploads used to build the whole multipart body in a bytes.Buffer, so a 1 GB video cost 1 GB of RAM per upload.
+// here the body is written through an io.Pipe while the request is being sent, so only a small copy buffer is ever held in memory.
+// the file comes in as a plain io.Reader, so it can be streamed from whatever media store it lives in.
+
+// Field is a plain form field. Order is kept, and the same name may appear more than once (e.g. "platform[]").
+type Field struct {
+	Name  string
+	Value string
+}
+
+// FilePart is the file attached to a multipart body.
+type FilePart struct {
+	Field    string
+	Filename string
+	Reader   io.Reader
+	Size     int64 // -1 if unknown, the request is then sent chunked
+}
+
+// NewMultipartRequest builds a POST request whose multipart body is streamed from file.Reader.
+// When file.Size is known the Content-Length is computed up front, so the request is not chunked.
+func NewMultipartRequest(apiURL string, fields []Field, file FilePart) (*http.Request, error) {
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+
+	// measure everything except the file contents by writing the body with an empty file.
+	var length int64 = -1
+	if file.Size >= 0 {
+		counter := &countingWriter{}
+		if err := writeMultipart(counter, boundary, fields, file.Field, file.Filename, eofReader{}); err != nil {
+			return nil, err
+		}
+		length = counter.n + file.Size
+	}
+
+	pr, pw := io.Pipe()
+	body := &pipeBody{pr: pr, start: func() {
+		go func() {
+			// if the transport stops reading (request failed), the write fails and we exit.
+			pw.CloseWithError(writeMultipart(pw, boundary, fields, file.Field, file.Filename, file.Reader))
+		}()
+	}}
+
+	req, err := http.NewRequest("POST", apiURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = length
+	req.Header.Set("Content-Type", "multipart/form-data; boundary="+boundary)
+	return req, nil
+}
+
+// pipeBody starts writing the body on the first Read, so a request that is built but never sent (or fails
+// before its body is read) leaves no goroutine behind. Close stops a writer that already started.
+type pipeBody struct {
+	pr    *io.PipeReader
+	once  sync.Once
+	start func()
+}
+
+func (b *pipeBody) Read(p []byte) (int, error) {
+	b.once.Do(b.start)
+	return b.pr.Read(p)
+}
+
+func (b *pipeBody) Close() error {
+	return b.pr.Close()
+}
+
+func writeMultipart(w io.Writer, boundary string, fields []Field, fileField string, filename string, content io.Reader) error {
+	writer := multipart.NewWriter(w)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return err
+	}
+
+	for _, f := range fields {
+		if err := writer.WriteField(f.Name, f.Value); err != nil {
+			return err
+		}
+	}
+
+	part, err := writer.CreateFormFile(fileField, filename)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) { return 0, io.EOF }
@@ -0,0 +1,144 @@
+package uploadpost
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/iotest"
+)
+
+// received is what the test server saw of one multipart request.
+type received struct {
+	contentLength    int64
+	transferEncoding []string
+	read             int64
+	fields           []Field
+	filename         string
+	file             []byte
+}
+
+func multipartServer(t *testing.T) (*httptest.Server, chan received) {
+	t.Helper()
+	got := make(chan received, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rec := received{contentLength: r.ContentLength, transferEncoding: r.TransferEncoding, read: int64(len(body))}
+
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			data, _ := io.ReadAll(part)
+			if part.FileName() != "" {
+				rec.filename, rec.file = part.FileName(), data
+			} else {
+				rec.fields = append(rec.fields, Field{part.FormName(), string(data)})
+			}
+		}
+		got <- rec
+	}))
+	t.Cleanup(srv.Close)
+	return srv, got
+}
+
+func TestNewMultipartRequest(t *testing.T) {
+	srv, got := multipartServer(t)
+
+	content := make([]byte, 3<<20+17) // bigger than any copy buffer
+	if _, err := rand.Read(content); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fields := []Field{{"user", User}, {"platform[]", "instagram"}, {"platform[]", "pinterest"}, {"title", "über ☕"}}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	cases := []struct {
+		name string
+		file FilePart
+	}{
+		{"known size", FilePart{Field: "video", Filename: "video.mp4", Reader: f, Size: int64(len(content))}},
+		// a plain reader hides the file's size, like a stream from a remote store.
+		{"unknown size", FilePart{Field: "video", Filename: "video.mp4", Reader: io.MultiReader(bytes.NewReader(content)), Size: -1}},
+	}
+	for _, c := range cases {
+		req, err := NewMultipartRequest(srv.URL, fields, c.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: server answered %s", c.name, resp.Status)
+		}
+		rec := <-got
+
+		if c.file.Size >= 0 {
+			if rec.contentLength != rec.read || len(rec.transferEncoding) != 0 {
+				t.Errorf("%s: Content-Length %d, %d bytes read, transfer encoding %v", c.name, rec.contentLength, rec.read, rec.transferEncoding)
+			}
+		} else if rec.contentLength != -1 || !slices.Equal(rec.transferEncoding, []string{"chunked"}) {
+			t.Errorf("%s: Content-Length %d, transfer encoding %v, want a chunked body", c.name, rec.contentLength, rec.transferEncoding)
+		}
+		if !slices.Equal(rec.fields, fields) {
+			t.Errorf("%s: fields %v", c.name, rec.fields)
+		}
+		if rec.filename != "video.mp4" || !bytes.Equal(rec.file, content) {
+			t.Errorf("%s: file %q of %d bytes", c.name, rec.filename, len(rec.file))
+		}
+	}
+}
+
+// a file that can't be read fails the request instead of sending a truncated body.
+func TestNewMultipartRequestReadError(t *testing.T) {
+	srv, got := multipartServer(t)
+
+	broken := io.MultiReader(bytes.NewReader(make([]byte, 1000)), iotest.ErrReader(errors.New("disk on fire")))
+	req, err := NewMultipartRequest(srv.URL, nil, FilePart{Field: "photo", Filename: "a.jpg", Reader: broken, Size: 2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		resp.Body.Close()
+		t.Fatalf("request with an unreadable file was sent: %s", resp.Status)
+	}
+	select {
+	case rec := <-got:
+		t.Errorf("server accepted %d bytes", rec.read)
+	default:
+	}
+}
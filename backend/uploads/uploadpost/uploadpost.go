@@ -0,0 +1,140 @@
+package uploadpost
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+	log "github.com/sirupsen/logrus"
+)
+
+// this package holds the pieces shared by every uploader that goes through upload-post.com (instagram, pinterest).
+// uploads are submitted with async_upload=true, so the api answers right away with a request_id that we poll for the final result.
+
+const User = "SocialContentDistributer"
+
+// BaseURL is where the upload-post api lives, a var so tests can point it at a local server.
+var BaseURL = "https://api.upload-post.com/api"
+
+// statuses reported by the upload-post status endpoint.
+const (
+	StatusPending    = "pending"
+	StatusInProgress = "in_progress"
+	StatusCompleted  = "completed"
+	StatusFailed     = "failed"
+)
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// Profile returns the upload-post profile (the "user" field) to post as. Each profile has its own connected
+// social accounts, so posting to "instagram:brand2" posts as the profile named brand2.
+func Profile(account string) string {
+	if account == "" {
+		return User
+	}
+	return account
+}
+
+// APIKey loads the upload-post key from config/.env.
+func APIKey() (string, error) {
+	if err := godotenv.Load("config/.env"); err != nil {
+		return "", fmt.Errorf("cannot load config/.env: %w", err)
+	}
+	apiKey := os.Getenv("UploadsAPI")
+	if apiKey == "" {
+		return "", errors.New("UploadsAPI is not set in config/.env")
+	}
+	return apiKey, nil
+}
+
+// SubmitResponse is what upload-post returns when an upload is accepted.
+type SubmitResponse struct {
+	Success   bool   `json:"success"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id"`
+}
+
+// ParseSubmitResponse reads the body of an upload call and returns the request_id to poll.
+func ParseSubmitResponse(resp *http.Response) (string, error) {
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	log.Debugf("upload-post answered %s: %s", resp.Status, respBody)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("upload-post returned %s: %s", resp.Status, string(respBody))
+	}
+
+	var submitted SubmitResponse
+	if err := json.Unmarshal(respBody, &submitted); err != nil {
+		return "", fmt.Errorf("cannot decode upload-post response: %w", err)
+	}
+	if !submitted.Success && submitted.RequestID == "" {
+		return "", fmt.Errorf("upload-post rejected the upload: %s", submitted.Message)
+	}
+	if submitted.RequestID == "" {
+		return "", errors.New("upload-post response did not include a request_id")
+	}
+	return submitted.RequestID, nil
+}
+
+// PlatformResult is the per-platform outcome inside a status response.
+type PlatformResult struct {
+	Platform string `json:"platform"`
+	Success  bool   `json:"success"`
+	Error    string `json:"error"`
+	URL      string `json:"url"`
+}
+
+// Status is the body of GET /uploadposts/status.
+type Status struct {
+	RequestID string           `json:"request_id"`
+	Status    string           `json:"status"`
+	Message   string           `json:"message"`
+	Completed int              `json:"completed"`
+	Total     int              `json:"total"`
+	Results   []PlatformResult `json:"results"`
+}
+
+// Done reports whether upload-post has finished with the request (either way).
+func (s Status) Done() bool {
+	return s.Status == StatusCompleted || s.Status == StatusFailed
+}
+
+// GetStatus asks upload-post how an async upload is doing.
+func GetStatus(apiKey string, requestID string) (Status, error) {
+	statusURL := BaseURL + "/uploadposts/status?request_id=" + url.QueryEscape(requestID)
+
+	req, err := http.NewRequest("GET", statusURL, nil)
+	if err != nil {
+		return Status{}, err
+	}
+	req.Header.Set("Authorization", "Apikey "+apiKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Status{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(resp.Body)
+		return Status{}, fmt.Errorf("status check returned %s: %s", resp.Status, string(respBody))
+	}
+
+	var status Status
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return Status{}, err
+	}
+	if status.RequestID == "" {
+		status.RequestID = requestID
+	}
+	return status, nil
+}
@@ -0,0 +1,79 @@
+package uploadpost
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStatusDone(t *testing.T) {
+	cases := []struct {
+		status string
+		done   bool
+	}{
+		{StatusPending, false},
+		{StatusInProgress, false},
+		{"", false},
+		{StatusCompleted, true},
+		{StatusFailed, true},
+	}
+	for _, c := range cases {
+		if got := (Status{Status: c.status}).Done(); got != c.done {
+			t.Errorf("Done() with status %q = %v, want %v", c.status, got, c.done)
+		}
+	}
+}
+
+func TestParseSubmitResponse(t *testing.T) {
+	cases := []struct {
+		code      int
+		body      string
+		requestID string
+	}{
+		{200, `{"success":true,"request_id":"r1"}`, "r1"},
+		{202, `{"success":false,"message":"queued","request_id":"r2"}`, "r2"},
+		{200, `{"success":false,"message":"no account connected"}`, ""},
+		{200, `{"success":true}`, ""},
+		{200, `not json`, ""},
+		{401, `{"message":"bad key"}`, ""},
+	}
+	for _, c := range cases {
+		resp := &http.Response{StatusCode: c.code, Status: http.StatusText(c.code), Body: io.NopCloser(strings.NewReader(c.body))}
+		got, err := ParseSubmitResponse(resp)
+		if got != c.requestID || (err == nil) != (c.requestID != "") {
+			t.Errorf("%d %s: %q, %v", c.code, c.body, got, err)
+		}
+	}
+}
+
+func TestGetStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/uploadposts/status" || r.Header.Get("Authorization") != "Apikey key" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		switch r.URL.Query().Get("request_id") {
+		case "a&b":
+			io.WriteString(w, `{"status":"completed","results":[{"platform":"instagram","success":true}]}`)
+		default:
+			http.Error(w, "no such request", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	old := BaseURL
+	BaseURL = srv.URL
+	defer func() { BaseURL = old }()
+
+	status, err := GetStatus("key", "a&b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Done() || status.RequestID != "a&b" || len(status.Results) != 1 || !status.Results[0].Success {
+		t.Errorf("status: %+v", status)
+	}
+	if _, err := GetStatus("key", "missing"); err == nil {
+		t.Error("a 404 from the status endpoint is not an error")
+	}
+}
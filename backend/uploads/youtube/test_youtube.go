@@ -4,8 +4,8 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"net"
 	"net/http"
 	"net/url"
@@ -60,19 +60,19 @@ https://developers.google.com/api-client-library/python/guide/aaa_client_secrets
 
 // getClient uses a Context and Config to retrieve a Token
 // then generate a Client. It returns the generated Client.
-func getClient(scope string) *http.Client {
+func getClient(scope string) (*http.Client, error) {
 	ctx := context.Background()
 
 	b, err := ioutil.ReadFile("config/client_secret.json")
 	if err != nil {
-		log.Fatalf("Unable to read client secret file: %v", err)
+		return nil, fmt.Errorf("unable to read client secret file: %w", err)
 	}
 
 	// If modifying the scope, delete your previously saved credentials
 	// at ~/.credentials/youtube-go.json
 	config, err := google.ConfigFromJSON(b, scope)
 	if err != nil {
-		log.Fatalf("Unable to parse client secret file to config: %v", err)
+		return nil, fmt.Errorf("unable to parse client secret file to config: %w", err)
 	}
 
 	// Use a redirect URI like this for a web app. The redirect URI must be a
@@ -83,7 +83,7 @@ func getClient(scope string) *http.Client {
 
 	cacheFile, err := tokenCacheFile()
 	if err != nil {
-		log.Fatalf("Unable to get path to cached credential file. %v", err)
+		return nil, fmt.Errorf("unable to get path to cached credential file: %w", err)
 	}
 	tok, err := tokenFromFile(cacheFile)
 	if err != nil {
@@ -95,11 +95,12 @@ func getClient(scope string) *http.Client {
 			fmt.Println("Trying to get token from prompt")
 			tok, err = getTokenFromPrompt(config, authURL)
 		}
-		if err == nil {
-			saveToken(cacheFile, tok)
+		if err != nil {
+			return nil, err
 		}
+		saveToken(cacheFile, tok)
 	}
-	return config.Client(ctx, tok)
+	return config.Client(ctx, tok), nil
 }
 
 // startWebServer starts a web server that listens on http://localhost:8080.
@@ -145,7 +146,7 @@ func openURL(url string) error {
 func exchangeToken(config *oauth2.Config, code string) (*oauth2.Token, error) {
 	tok, err := config.Exchange(oauth2.NoContext, code)
 	if err != nil {
-		log.Fatalf("Unable to retrieve token %v", err)
+		return nil, fmt.Errorf("unable to retrieve token: %w", err)
 	}
 	return tok, nil
 }
@@ -159,7 +160,7 @@ func getTokenFromPrompt(config *oauth2.Config, authURL string) (*oauth2.Token, e
 		"line: \n%v\n", authURL)
 
 	if _, err := fmt.Scan(&code); err != nil {
-		log.Fatalf("Unable to read authorization code %v", err)
+		return nil, fmt.Errorf("unable to read authorization code: %w", err)
 	}
 	fmt.Println(authURL)
 	return exchangeToken(config, code)
@@ -176,10 +177,10 @@ func getTokenFromWeb(config *oauth2.Config, authURL string) (*oauth2.Token, erro
 
 	err = openURL(authURL)
 	if err != nil {
-		log.Fatalf("Unable to open authorization URL in web server: %v", err)
+		return nil, fmt.Errorf("unable to open authorization URL in web server: %w", err)
 	} else {
 		fmt.Println("Your browser has been opened to an authorization URL.",
-			" This program will resume once authorization has been provided.\n")
+			" This program will resume once authorization has been provided.")
 		fmt.Println(authURL)
 	}
 
@@ -221,21 +222,28 @@ func saveToken(file string, token *oauth2.Token) {
 	fmt.Printf("Saving credential file to: %s\n", file)
 	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
-		log.Fatalf("Unable to cache oauth token: %v", err)
+		// the token still works for this upload, it is only asked for again next time.
+		fmt.Printf("Unable to cache oauth token: %v\n", err)
+		return
 	}
 	defer f.Close()
 	json.NewEncoder(f).Encode(token)
 }
 
-func UploadYoutube(title string, description string, category string, privacy string, filename string, keywords string) {
+// UploadYoutube uploads video (read from the media store by the caller) to the authorised channel.
+// thumbnail, if not nil, is set as the video's custom thumbnail (jpeg or png, at most 2 MB).
+func UploadYoutube(title string, description string, category string, privacy string, video io.Reader, keywords string, thumbnail io.Reader) error {
 	fmt.Printf("\n UploadYoutube() function")
 	flag.Parse()
 
-	client := getClient(youtube.YoutubeUploadScope)
+	client, err := getClient(youtube.YoutubeUploadScope)
+	if err != nil {
+		return err
+	}
 
 	service, err := youtube.New(client)
 	if err != nil {
-		log.Fatalf("Error creating YouTube client: %v", err)
+		return fmt.Errorf("error creating YouTube client: %w", err)
 	}
 
 	upload := &youtube.Video{
@@ -254,17 +262,21 @@ func UploadYoutube(title string, description string, category string, privacy st
 
 	call := service.Videos.Insert([]string{"snippet", "status"}, upload)
 
-	file, err := os.Open(filename)
-	defer file.Close()
-	if err != nil {
-		log.Fatalf("Error opening %v: %v", filename, err)
-	}
-
-	response, err := call.Media(file).Do()
+	response, err := call.Media(video).Do()
 	if err != nil {
-		log.Fatalf("Upload failed: %v", err)
+		return fmt.Errorf("upload failed: %w", err)
 	}
 
 	fmt.Printf("\nUpload successful! Video ID: %v\n", response.Id)
 
+	// custom thumbnails need a verified channel, the video is up either way so this only warns.
+	if thumbnail != nil {
+		if _, err := service.Thumbnails.Set(response.Id).Media(thumbnail).Do(); err != nil {
+			fmt.Printf("\nSetting the thumbnail failed: %v\n", err)
+		} else {
+			fmt.Printf("\nThumbnail set for video %v\n", response.Id)
+		}
+	}
+
+	return nil
 }
@@ -75,14 +75,14 @@ export default function ComposePage() {
         if (response.ok) {
           const result = await response.json();
           console.log('File uploaded successfully:', result);
-          // Store the file path and filename for later use
+          // Store the media id for later use, the backend only accepts media by id
           const fileWithMetadata = Object.assign(file, {
             path: result.file_path,
-            savedName: result.filename
+            mediaId: result.media_id
           });
           setSelectedVideo(fileWithMetadata);
           
-          // Auto-populate image_url with the uploaded file path
+          // Auto-populate image_url with the uploaded file path (only shown and validated here, the id is what gets sent)
           setValue('image_url', result.file_path);
           
           toast({
@@ -119,8 +119,8 @@ export default function ComposePage() {
         ...data,
         // user_tags is already a string from the form input
         user_tags: data.user_tags || '',
-        // Add video file path if a file was selected
-        media_file: selectedVideo && (selectedVideo as any).savedName ? (selectedVideo as any).savedName : '',
+        // Reference the uploaded file by its media id
+        media_id: selectedVideo && (selectedVideo as any).mediaId ? (selectedVideo as any).mediaId : '',
         // Auto-set source_type for Pinterest
         source_type: selectedPlatforms.includes('pinterest') ? 'image_url' : (data.source_type || '')
       };